@@ -0,0 +1,73 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"unicode"
+)
+
+// Browse prints the name of every artist in the Music folders to w,
+// grouped under headings for the first letter of their names. An artist
+// in more than one folder is printed once.
+func Browse(w io.Writer) error {
+	l, err := DefaultLibrary()
+	if err != nil {
+		return err
+	}
+	artists, _, err := l.artists()
+	if err != nil {
+		return err
+	}
+	sortNatural(artists)
+
+	var names []string
+	for i, a := range artists {
+		if i > 0 && a.Name() == artists[i-1].Name() {
+			continue
+		}
+		names = append(names, a.Name())
+	}
+	printGroups(w, names)
+	return nil
+}
+
+// printGroups prints names to w under a heading for each first letter.
+// Names which don't start with a letter go under "#", ahead of the rest.
+func printGroups(w io.Writer, names []string) {
+	groups := map[string][]string{}
+	for _, n := range names {
+		k := initial(n)
+		groups[k] = append(groups[k], n)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintln(w, k)
+		for _, n := range groups[k] {
+			fmt.Fprintln(w, "\t"+n)
+		}
+	}
+}
+
+// initial returns the upper-cased first letter of s, or "#" if
+// its first letter or digit isn't a letter. With ignoreThe, a leading
+// "The" is skipped.
+func initial(s string) string {
+	for _, r := range withoutThe(s) {
+		if unicode.IsLetter(r) {
+			return string(unicode.ToUpper(r))
+		}
+		if unicode.IsDigit(r) {
+			break
+		}
+	}
+	return "#"
+}
@@ -0,0 +1,19 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintGroups(t *testing.T) {
+	names := []string{"10,000 Maniacs", "AC/DC", "Bob Dylan", "abba", "The Who", "!!!"}
+	want := "#\n\t10,000 Maniacs\n\t!!!\nA\n\tAC/DC\n\tabba\nB\n\tBob Dylan\nT\n\tThe Who\n"
+
+	var buf bytes.Buffer
+	printGroups(&buf, names)
+	if buf.String() != want {
+		t.Errorf("printGroups should print\n%s\nbut got\n%s", want, buf.String())
+	}
+}
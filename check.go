@@ -0,0 +1,117 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// A problem is something wrong with the way the folder or
+// track at Path is laid out in the Library.
+type problem struct {
+	Path string
+	What string
+}
+
+// check returns the problems with the layout of l's folders: tracks
+// which aren't by any artist, artists without albums or tracks, albums
+// without tracks, and folders nested more deeply than the discs of an
+// album. Tracks loose in an artist's folder are fine, since they're
+// played as an album of their own.
+func (l *Library) check() ([]problem, error) {
+	if _, _, err := l.artists(); err != nil {
+		return nil, err
+	}
+
+	var probs []problem
+	for _, f := range l.folders {
+		ps, err := l.checkFolder(f.root, 0)
+		if err != nil {
+			return nil, err
+		}
+		probs = append(probs, ps...)
+	}
+	return probs, nil
+}
+
+// The depths of the folders in a Library, beneath the Music folder.
+const (
+	musicDepth = iota
+	artistDepth
+	albumDepth
+	discDepth
+)
+
+// checkFolder returns the problems with the folder at path, and those
+// within it, where it's depth folders beneath the Music folder.
+func (l *Library) checkFolder(path string, depth int) ([]problem, error) {
+	tracks, err := l.subFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := l.subDirs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var probs []problem
+	if depth == musicDepth {
+		for _, t := range tracks {
+			probs = append(probs, problem{filepath.Join(path, t.Name()), "is a track which isn't by any artist"})
+		}
+	}
+	if depth == discDepth {
+		for _, d := range dirs {
+			probs = append(probs, problem{filepath.Join(path, d.Name()), "is nested too deeply to be played; only albums, and their discs, can hold tracks"})
+		}
+		return probs, nil
+	}
+	if depth == artistDepth && len(dirs) == 0 && len(tracks) == 0 {
+		probs = append(probs, problem{path, "is an artist with no albums or tracks"})
+	}
+
+	if depth == albumDepth && len(tracks) == 0 {
+		discTracks := 0
+		for _, d := range dirs {
+			ts, err := l.subFiles(filepath.Join(path, d.Name()))
+			if err != nil {
+				return nil, err
+			}
+			discTracks += len(ts)
+		}
+		if discTracks == 0 {
+			probs = append(probs, problem{path, "is an album with no tracks"})
+		}
+	}
+
+	for _, d := range dirs {
+		ps, err := l.checkFolder(filepath.Join(path, d.Name()), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		probs = append(probs, ps...)
+	}
+	return probs, nil
+}
+
+// printCheck checks the layout of lib, printing any problems to w.
+// It returns an error if there were any.
+func printCheck(w io.Writer, lib *Library) error {
+	probs, err := lib.check()
+	if err != nil {
+		return err
+	}
+	for _, p := range probs {
+		fmt.Fprintf(w, "%s %s.\n", p.Path, p.What)
+	}
+	switch len(probs) {
+	case 0:
+		fmt.Fprintln(w, "Everything looks fine.")
+		return nil
+	case 1:
+		return newError("I found 1 problem.")
+	}
+	return newError("I found %d problems.", len(probs))
+}
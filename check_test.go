@@ -0,0 +1,60 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/cover.jpg",
+		"Pixies/Surfer Rosa/cover.jpg",
+		"Pixies/Come On Pilgrim/.keep",
+		"Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg",
+		"Pixies/Trompe le Monde/Disc 1/Extras/1 Planet of Sound.ogg",
+		"Pixies/Trompe le Monde/Disc 2/1 Alec Eiffel.ogg",
+		"Pixies/Where Is My Mind.ogg",
+		"The Who/.keep",
+		"Weezer/Undone.ogg",
+		"Debaser.ogg",
+	)
+	probs, err := l.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := func(p string) string { return filepath.Join(l.root(), filepath.FromSlash(p)) }
+	want := []problem{
+		{path("Debaser.ogg"), "is a track which isn't by any artist"},
+		{path("Pixies/Come On Pilgrim"), "is an album with no tracks"},
+		{path("Pixies/Surfer Rosa"), "is an album with no tracks"},
+		{path("Pixies/Trompe le Monde/Disc 1/Extras"), "is nested too deeply to be played; only albums, and their discs, can hold tracks"},
+		{path("The Who"), "is an artist with no albums or tracks"},
+	}
+	if !reflect.DeepEqual(probs, want) {
+		t.Errorf("Expected the problems\n%v\nbut got\n%v", want, probs)
+	}
+
+	var b bytes.Buffer
+	if err := printCheck(&b, l); err == nil || err.Error() != "I found 5 problems." {
+		t.Errorf("Expected printCheck to say there were 5 problems, but got %v", err)
+	}
+
+	b.Reset()
+	fine := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg",
+		"Weezer/Undone.ogg",
+	)
+	if err := printCheck(&b, fine); err != nil {
+		t.Error("Expected no problems, but got", err)
+	}
+	if b.String() != "Everything looks fine.\n" {
+		t.Errorf("Expected to be told everything was fine, but got %q", b.String())
+	}
+}
@@ -0,0 +1,63 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+// useColor is true iff the names of artists and albums, and of the
+// track being played, are colored with ANSI escape codes.
+var useColor = false
+
+// The colors of names, as ANSI escape codes.
+const (
+	artistColor  = "\x1b[36m"   // cyan
+	albumColor   = "\x1b[33m"   // yellow
+	playingColor = "\x1b[1;32m" // bold green
+	resetColor   = "\x1b[0m"
+)
+
+// A colorFlag is when to color names: always, never, or auto, which
+// colors them only when they're printed to a terminal.
+type colorFlag string
+
+func (c *colorFlag) String() string {
+	return string(*c)
+}
+
+func (c *colorFlag) Set(s string) error {
+	switch s {
+	case "auto", "always", "never":
+		*c = colorFlag(s)
+		return nil
+	}
+	return newError("-color should be auto, always, or never, but got %q", s)
+}
+
+// enabled returns whether to color names, given whether they're printed
+// to a terminal, and the value of $NO_COLOR, which turns off auto if set.
+func (c colorFlag) enabled(terminal bool, noColor string) bool {
+	switch c {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return terminal && noColor == ""
+}
+
+// paint returns s in the given color, if useColor is set,
+// or just s otherwise.
+func paint(color, s string) string {
+	if !useColor || s == "" {
+		return s
+	}
+	return color + s + resetColor
+}
+
+// paintTrack returns the name of a track, as track.name gives it,
+// with its artist and album painted their colors, and its song too,
+// as the track being played, if playing is set.
+func paintTrack(artist, album, song string, playing bool) string {
+	if playing {
+		song = paint(playingColor, song)
+	}
+	return paint(artistColor, artist) + "/" + paint(albumColor, album) + "/" + song
+}
@@ -0,0 +1,95 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestColorFlag(t *testing.T) {
+	tests := []struct {
+		value    string
+		terminal bool
+		noColor  string
+		want     bool
+	}{
+		{"auto", true, "", true},
+		{"auto", false, "", false},
+		{"auto", true, "1", false},
+		{"always", false, "", true},
+		{"always", true, "1", true},
+		{"never", true, "", false},
+	}
+	for _, test := range tests {
+		var c colorFlag
+		if err := c.Set(test.value); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.enabled(test.terminal, test.noColor); got != test.want {
+			t.Errorf("Expected -color %s, with terminal=%v and NO_COLOR=%q, to give %v, but got %v",
+				test.value, test.terminal, test.noColor, test.want, got)
+		}
+	}
+
+	var c colorFlag
+	if err := c.Set("sometimes"); err == nil {
+		t.Error("Expected an error for -color sometimes")
+	}
+}
+
+func TestColoredNames(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Bossanova/1 Cecilia Ann.ogg",
+	)
+	defer func(s bool) { shuffleAlbums = s }(shuffleAlbums)
+	shuffleAlbums = false
+	defer func(l *logger) { logs = l }(logs)
+	defer func() { useColor = false }()
+
+	pixies := filepath.Join(l.root(), "Pixies")
+	debaser := filepath.Join(pixies, "Doolittle", "1 Debaser.ogg")
+	output := func() (listing, playing string) {
+		var list, out bytes.Buffer
+		if err := newArtist(l, pixies).List(&list, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := newTrack(l, debaser).List(&list, ""); err != nil {
+			t.Fatal(err)
+		}
+		logs = &logger{Out: &out, Err: &out}
+		p, _ := fakePlayer(t, "mpv")
+		p.Tracks = true
+		if err := newAlbum(l, filepath.Dir(debaser), true).Play(context.Background(), p, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := newTrack(l, debaser).Play(context.Background(), p, ""); err != nil {
+			t.Fatal(err)
+		}
+		return list.String(), out.String()
+	}
+
+	useColor = false
+	listing, playing := output()
+	if strings.Contains(listing+playing, "\x1b") {
+		t.Errorf("Expected no escape codes with -color never, but got %q and %q", listing, playing)
+	}
+
+	useColor = true
+	listing, playing = output()
+	wantListing := "\x1b[33mBossanova\x1b[0m\n" +
+		"\x1b[33mDoolittle\x1b[0m\n" +
+		"\x1b[36mPixies\x1b[0m/\x1b[33mDoolittle\x1b[0m/1 Debaser\n"
+	if listing != wantListing {
+		t.Errorf("Expected the listing %q, but got %q", wantListing, listing)
+	}
+	wantPlaying := "\x1b[33mDoolittle\x1b[0m/\x1b[1;32m1 Debaser\x1b[0m\n" +
+		"\x1b[36mPixies\x1b[0m/\x1b[33mDoolittle\x1b[0m/\x1b[1;32m1 Debaser\x1b[0m\n"
+	if playing != wantPlaying {
+		t.Errorf("Expected the tracks played to be printed as %q, but got %q", wantPlaying, playing)
+	}
+}
@@ -0,0 +1,146 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// bashCompletion completes splay's arguments in bash, with the
+// names printed by splay __complete. Names are quoted, since many
+// have spaces in them.
+const bashCompletion = `# bash completion for splay; load it with
+#	source <(splay -completion bash)
+_splay() {
+	local cur=${COMP_WORDS[COMP_CWORD]} name
+	COMPREPLY=()
+	[[ $cur == -* ]] && return
+	while IFS= read -r name; do
+		COMPREPLY+=("$(printf '%q' "$name")")
+	done < <(splay __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null)
+}
+complete -F _splay splay
+`
+
+// zshCompletion completes splay's arguments in zsh, with the names
+// printed by splay __complete. They're compared to what's been typed
+// without regard to case or punctuation, so compadd is told not to
+// compare them again.
+const zshCompletion = `#compdef splay
+# zsh completion for splay; load it with
+#	source <(splay -completion zsh)
+_splay() {
+	[[ $PREFIX == -* ]] && return 1
+	local -a names
+	names=(${(f)"$(splay __complete ${words[2,CURRENT-1]} "$PREFIX" 2>/dev/null)"})
+	compadd -U -- $names
+}
+compdef _splay splay
+`
+
+// completionScript returns the script which completes the names of
+// artists and albums, as splay's arguments, in the given shell.
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	}
+	return "", newError("I don't know how to complete in %q; try bash or zsh.", shell)
+}
+
+// completeCommand is the hidden first argument which makes splay print
+// quickCompletions, for the completion scripts, rather than play anything.
+const completeCommand = "__complete"
+
+// printQuickCompletions prints quickCompletions of the last of args, after
+// the words before it, to w, one to a line. The flags among the words,
+// and their values, are parsed as splay's own, so that e.g. -dir's folder
+// isn't taken for a name. It's the whole of what splay does for
+// completeCommand, so it reads only the config file, for the music
+// folders, and prints nothing if there's no music there, or the flags
+// are bad or unfinished.
+func printQuickCompletions(w io.Writer, args []string) {
+	prefix := ""
+	if len(args) > 0 {
+		prefix, args = args[len(args)-1], args[:len(args)-1]
+	}
+	flags := flag.NewFlagSet("splay", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags.Var(f.Value, f.Name, f.Usage)
+	})
+	if err := flags.Parse(args); err != nil {
+		return
+	}
+	_ = loadConfig(flags)
+	includeHidden = *withHidden
+	lib, err := DefaultLibrary()
+	if err != nil {
+		return
+	}
+	for _, name := range lib.quickCompletions(flags.Args(), prefix) {
+		fmt.Fprintln(w, name)
+	}
+}
+
+// quickCompletions returns the names of the artists in l which start
+// with prefix, ignoring case, punctuation, and accents. If the last of
+// words name one of the artists, e.g. because they were completed
+// already, it's the names of the artist's albums instead. Nothing but
+// the artists' folders, and that artist's, is read, so that the shell
+// isn't kept waiting, and nothing is returned if they can't be.
+func (l *Library) quickCompletions(words []string, prefix string) []string {
+	artists, paths, err := l.artists()
+	if err != nil {
+		return nil
+	}
+	prefix = completionKey(prefix)
+
+	byKey := map[string][]string{}
+	for i, a := range artists {
+		key := completionKey(a.Name())
+		byKey[key] = append(byKey[key], paths[i])
+	}
+	for i := range words {
+		named := byKey[completionKey(strings.Join(words[i:], " "))]
+		if len(named) == 0 {
+			continue
+		}
+		var albums []os.FileInfo
+		for _, path := range named {
+			as, err := l.subDirs(path)
+			if err != nil {
+				return nil
+			}
+			albums = append(albums, as...)
+		}
+		return namesWithPrefix(albums, prefix)
+	}
+	return namesWithPrefix(artists, prefix)
+}
+
+// completionKey returns s as it's compared by quickCompletions.
+func completionKey(s string) string {
+	return strings.ToLower(clean(s))
+}
+
+// namesWithPrefix returns the names of fis whose completionKeys start
+// with prefix, which is already one, leaving out any repeats.
+func namesWithPrefix(fis []os.FileInfo, prefix string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, fi := range fis {
+		name := fi.Name()
+		if !seen[name] && strings.HasPrefix(completionKey(name), prefix) {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,109 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh"} {
+		s, err := completionScript(shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(s, "splay __complete") {
+			t.Errorf("Expected the %s script to call back into splay, but got\n%s", shell, s)
+		}
+	}
+	if _, err := completionScript("fish"); err == nil {
+		t.Error("Expected an error for a shell splay can't complete in")
+	}
+}
+
+func TestQuickCompletions(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"The Who/Tommy/1 Overture.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Wilco/Summerteeth/1 Can't Stand It.ogg",
+	)
+	l.Add(fstest.MapFS{
+		"Weezer/Green/1 Don't Let Go.ogg": &fstest.MapFile{},
+		"Björk/Post/1 Army of Me.ogg":     &fstest.MapFile{},
+	}, filepath.FromSlash("/more"))
+
+	tests := []struct {
+		words  []string
+		prefix string
+		want   []string
+	}{
+		{nil, "w", []string{"Weezer", "Wilco"}},
+		{nil, "WEE", []string{"Weezer"}},
+		{nil, "bjo", []string{"Björk"}},
+		{nil, "the w", []string{"The Who"}},
+		{nil, "who", nil},
+		{nil, "", []string{"Pixies", "The Who", "Weezer", "Wilco", "Björk"}},
+		{[]string{"weezer"}, "", []string{"Blue", "Pinkerton", "Green"}},
+		{[]string{"weezer"}, "p", []string{"Pinkerton"}},
+		{[]string{"mpv", "the", "who"}, "t", []string{"Tommy"}},
+		{[]string{"nobody"}, "pi", []string{"Pixies"}},
+	}
+	for _, test := range tests {
+		got := l.quickCompletions(test.words, test.prefix)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expected %q after %q to complete to %q, but got %q", test.prefix, test.words, test.want, got)
+		}
+	}
+}
+
+func TestQuickCompletionsWithoutMusic(t *testing.T) {
+	if got := mapLibrary().quickCompletions(nil, ""); got != nil {
+		t.Errorf("Expected no completions from an empty library, but got %q", got)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SPLAY_MUSIC_DIR", filepath.Join(t.TempDir(), "missing"))
+	var b bytes.Buffer
+	printQuickCompletions(&b, []string{"wee"})
+	if b.Len() != 0 {
+		t.Errorf("Expected nothing to be printed without a music folder, but got %q", b.String())
+	}
+}
+
+func TestPrintQuickCompletions(t *testing.T) {
+	music := t.TempDir()
+	for _, dir := range []string{"Weezer/Blue", "Wilco/Summerteeth"} {
+		if err := os.MkdirAll(filepath.Join(music, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SPLAY_MUSIC_DIR", filepath.Join(t.TempDir(), "missing"))
+	defer func() { musicdirs, *list = nil, false }()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-dir", music, "w"}, "Weezer\nWilco\n"},
+		{[]string{"-list", "-dir", music, "weezer", ""}, "Blue\n"},
+		{[]string{"-dir", ""}, ""},
+		{[]string{"-nonsense", "w"}, ""},
+	}
+	for _, test := range tests {
+		musicdirs = nil
+		var b bytes.Buffer
+		printQuickCompletions(&b, test.args)
+		if b.String() != test.want {
+			t.Errorf("Expected the completions of %q to be %q, but got %q", test.args, test.want, b.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configDir returns the folder where splay's configuration is kept:
+// splay in $XDG_CONFIG_HOME, or in ~/.config.
+func configDir() (string, error) {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", newError("I can't tell where splay's configuration is: %v", err)
+		}
+		config = filepath.Join(home, ".config")
+	}
+	return filepath.Join(config, "splay"), nil
+}
+
+// A setting is a flag, and its value, from the config file.
+type setting struct {
+	name, value string
+}
+
+// parseConfig parses a config file, of lines like "player=mpv" which
+// give flags their values, from r. A value may be quoted, as by
+// parseValue. Blank lines, and those starting with #, are ignored.
+// Settings of flags which don't exist, or with bad quoting, are
+// warned about, and skipped.
+func parseConfig(r io.Reader, flags *flag.FlagSet) ([]setting, error) {
+	var settings []setting
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			logs.Warn(newError("Line %d of the config isn't like name=value, so it's skipped.", n))
+			continue
+		}
+		if flags.Lookup(name) == nil {
+			logs.Warn(newError("There's no -%s flag, so line %d of the config is skipped.", name, n))
+			continue
+		}
+		value, err := parseValue(value)
+		if err != nil {
+			logs.Warn(newError("Line %d of the config is skipped: %v", n, err))
+			continue
+		}
+		settings = append(settings, setting{name, value})
+	}
+	return settings, s.Err()
+}
+
+// applyConfig sets flags to the values in settings, except
+// those which were set already, on the command line, so that the
+// command line has the last word.
+func applyConfig(flags *flag.FlagSet, settings []setting) error {
+	given := givenFlags(flags)
+	for _, s := range settings {
+		if given[s.name] {
+			continue
+		}
+		if err := flags.Set(s.name, s.value); err != nil {
+			return newError("The config's value for %s, %q, is bad: %v", s.name, s.value, err)
+		}
+	}
+	return nil
+}
+
+// givenFlags returns the names of the flags which have been set in flags.
+func givenFlags(flags *flag.FlagSet) map[string]bool {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	return given
+}
+
+// loadConfig sets the flags which weren't set on the command
+// line from the config file in the configDir, if there is one.
+func loadConfig(flags *flag.FlagSet) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Join(dir, "config"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	settings, err := parseConfig(f, flags)
+	if err != nil {
+		return err
+	}
+	return applyConfig(flags, settings)
+}
@@ -0,0 +1,100 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configFlags returns a FlagSet with some of splay's flags.
+func configFlags() (*flag.FlagSet, *string, *bool, *int64, *stringList) {
+	fs := flag.NewFlagSet("splay", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var dirs stringList
+	fs.Var(&dirs, "dir", "")
+	return fs, fs.String("player", "", ""), fs.Bool("shuffle", true, ""), fs.Int64("seed", 0, ""), &dirs
+}
+
+func TestParseConfig(t *testing.T) {
+	var errs bytes.Buffer
+	defer func(l *logger) { logs = l }(logs)
+	logs = &logger{Out: io.Discard, Err: &errs}
+
+	config := `# Where things are
+dir = /music
+dir=/more music
+
+player=mpv --no-video
+  # Not random
+shuffle=false
+colour=blue
+nonsense
+dir="/media/My Music"
+player='mpv
+`
+	fs, _, _, _, _ := configFlags()
+	settings, err := parseConfig(strings.NewReader(config), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []setting{
+		{"dir", "/music"},
+		{"dir", "/more music"},
+		{"player", "mpv --no-video"},
+		{"shuffle", "false"},
+		{"dir", "/media/My Music"},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("Expected the settings %q, but got %q", want, settings)
+	}
+	for _, warning := range []string{"no -colour flag", "Line 9", "Line 11"} {
+		if !strings.Contains(errs.String(), warning) {
+			t.Errorf("Expected a warning about %q, but got %q", warning, errs.String())
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	settings := []setting{
+		{"dir", "/music"},
+		{"dir", "/more music"},
+		{"player", "cvlc"},
+		{"shuffle", "false"},
+		{"seed", "7"},
+	}
+
+	fs, player, shuffle, seed, dirs := configFlags()
+	if err := fs.Parse([]string{"-player", "mpv", "-dir", "/elsewhere", "weezer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs, settings); err != nil {
+		t.Fatal(err)
+	}
+	if *player != "mpv" || !reflect.DeepEqual(*dirs, stringList{"/elsewhere"}) {
+		t.Errorf("The flags given should win over the config, but got -player %q and -dir %q", *player, *dirs)
+	}
+	if *shuffle || *seed != 7 {
+		t.Errorf("The config should set the flags not given, but got -shuffle=%v and -seed %d", *shuffle, *seed)
+	}
+	if fs.Arg(0) != "weezer" {
+		t.Errorf("The config shouldn't change the arguments, but got %q", fs.Args())
+	}
+
+	fs, _, _, _, dirs = configFlags()
+	if err := applyConfig(fs, settings); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*dirs, stringList{"/music", "/more music"}) {
+		t.Errorf("Expected every -dir in the config, but got %q", *dirs)
+	}
+
+	fs, _, _, _, _ = configFlags()
+	if err := applyConfig(fs, []setting{{"seed", "soon"}}); err == nil {
+		t.Error("Expected an error for a bad value in the config")
+	}
+}
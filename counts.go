@@ -0,0 +1,184 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultCounts returns where the number of times each track has
+// been played is kept: counts.json in the dataDir.
+func defaultCounts() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "counts.json"), nil
+}
+
+// A playCounts keeps the number of times each track has been played,
+// keyed by the track's path, as a JSON object in the file at its path.
+// It counts the same plays which would be scrobbled.
+type playCounts string
+
+func (c playCounts) Scrobble(path, artist, album, song string, started time.Time) error {
+	if err := c.add(path); err != nil {
+		return newError("Couldn't count the plays of %s: %v", song, err)
+	}
+	return nil
+}
+
+// add counts another play of the track at path.
+func (c playCounts) add(path string) error {
+	return updateTrackNumbers(string(c), func(counts map[string]int) {
+		counts[path]++
+	})
+}
+
+// Read returns the number of times each track has been played,
+// by path. If nothing's been counted yet, the map is empty.
+func (c playCounts) Read() (map[string]int, error) {
+	return readTrackNumbers(string(c))
+}
+
+// readTrackNumbers reads a JSON object of numbers, keyed by the paths
+// of tracks, from file. If there's no such file, the map is empty.
+func readTrackNumbers(file string) (map[string]int, error) {
+	nums := map[string]int{}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &nums); err != nil {
+		return nil, newError("I don't understand %s: %v", file, err)
+	}
+	return nums, nil
+}
+
+// updateTrackNumbers changes the numbers in file, as read by
+// readTrackNumbers, with f. The file is locked while it's changed,
+// and replaced all at once, so that several splays can change it
+// at once.
+func updateTrackNumbers(file string, f func(map[string]int)) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(file + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	nums, err := readTrackNumbers(file)
+	if err != nil {
+		return err
+	}
+	f(nums)
+	b, err := json.MarshalIndent(nums, "", "\t")
+	if err != nil {
+		return err
+	}
+	return replaceFile(file, append(b, '\n'))
+}
+
+// staleLock is how old a lock must be before it's assumed
+// that whatever took it has died without unlocking it.
+const staleLock = 10 * time.Second
+
+// lockFile takes the lock at path, by creating it, and returns a
+// function which releases it. It waits a while for the lock if it's
+// already been taken.
+func lockFile(path string) (func(), error) {
+	for wait := time.Millisecond; ; wait = min(2*wait, 100*time.Millisecond) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		fi, serr := os.Stat(path)
+		if serr == nil && time.Since(fi.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(wait)
+	}
+}
+
+// replaceFile replaces the contents of the file at path with b,
+// by writing them to a new file and renaming it, so that nothing
+// reading the file sees only some of them.
+func replaceFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// A trackCount is the number of times the track at Path has been played.
+type trackCount struct {
+	Path  string
+	Plays int
+}
+
+// mostPlayed returns the n tracks which have been played the most,
+// most played first. Tracks played the same number of times are in
+// order of their paths.
+func mostPlayed(counts map[string]int, n int) []trackCount {
+	tcs := make([]trackCount, 0, len(counts))
+	for path, plays := range counts {
+		tcs = append(tcs, trackCount{path, plays})
+	}
+	sort.Slice(tcs, func(i, j int) bool {
+		if tcs[i].Plays != tcs[j].Plays {
+			return tcs[i].Plays > tcs[j].Plays
+		}
+		return tcs[i].Path < tcs[j].Path
+	})
+	if n > 0 && len(tcs) > n {
+		tcs = tcs[:n]
+	}
+	return tcs
+}
+
+// printStats prints the n tracks which have been played the most,
+// according to counts, with the number of times each was played.
+func printStats(w io.Writer, counts playCounts, n int) error {
+	cs, err := counts.Read()
+	if err != nil {
+		return err
+	}
+	if len(cs) == 0 {
+		return newError("Nothing's been played yet.")
+	}
+	tcs := mostPlayed(cs, n)
+	width := len(fmt.Sprint(tcs[0].Plays))
+	for _, tc := range tcs {
+		fmt.Fprintf(w, "%*d  %s\n", width, tc.Plays, newTrack(nil, tc.Path).(*track).name())
+	}
+	return nil
+}
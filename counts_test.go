@@ -0,0 +1,115 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlayCounts(t *testing.T) {
+	counts := playCounts(filepath.Join(t.TempDir(), "new", "counts.json"))
+	if cs, err := counts.Read(); err != nil || len(cs) != 0 {
+		t.Fatalf("Expected no counts before any plays, but got %v, %v", cs, err)
+	}
+
+	debaser := filepath.FromSlash("/music/Pixies/Doolittle/1 Debaser.ogg")
+	tame := filepath.FromSlash("/music/Pixies/Doolittle/2 Tame.ogg")
+	for _, path := range []string{debaser, tame, debaser} {
+		if err := counts.Scrobble(path, "Pixies", "Doolittle", "", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A fresh playCounts reads what the last one wrote.
+	cs, err := playCounts(string(counts)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{debaser: 2, tame: 1}
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("Expected the counts %v, but got %v", want, cs)
+	}
+}
+
+func TestPlayCountsConcurrently(t *testing.T) {
+	counts := playCounts(filepath.Join(t.TempDir(), "counts.json"))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := counts.add(fmt.Sprint(i % 2)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cs, err := counts.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"0": 10, "1": 10}; !reflect.DeepEqual(cs, want) {
+		t.Errorf("Expected the counts %v, but got %v", want, cs)
+	}
+	if _, err := os.Stat(string(counts) + ".lock"); !os.IsNotExist(err) {
+		t.Error("The lock wasn't released")
+	}
+}
+
+func TestMostPlayed(t *testing.T) {
+	counts := map[string]int{"a": 3, "b": 7, "c": 3, "d": 1, "e": 12}
+	tests := []struct {
+		n    int
+		want []trackCount
+	}{
+		{3, []trackCount{{"e", 12}, {"b", 7}, {"a", 3}}},
+		{4, []trackCount{{"e", 12}, {"b", 7}, {"a", 3}, {"c", 3}}},
+		{10, []trackCount{{"e", 12}, {"b", 7}, {"a", 3}, {"c", 3}, {"d", 1}}},
+	}
+	for _, test := range tests {
+		if got := mostPlayed(counts, test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("The %d most played should be %v, but got %v", test.n, test.want, got)
+		}
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counts.json")
+	counts := map[string]int{
+		filepath.FromSlash("/music/Pixies/Doolittle/1 Debaser.ogg"):            12,
+		filepath.FromSlash("/music/Pixies/Doolittle/2 Tame.ogg"):               3,
+		filepath.FromSlash("/music/Pixies/Surfer Rosa/1 Bone Machine.ogg"):     7,
+		filepath.FromSlash("/music/Pixies/Surfer Rosa/2 Break My Body.ogg"):    1,
+		filepath.FromSlash("/music/Pixies/Doolittle/3 Wave of Mutilation.ogg"): 3,
+	}
+	for p, n := range counts {
+		for i := 0; i < n; i++ {
+			if err := playCounts(path).add(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := printStats(&b, playCounts(path), 3); err != nil {
+		t.Fatal(err)
+	}
+	want := "12  Pixies/Doolittle/1 Debaser\n" +
+		" 7  Pixies/Surfer Rosa/1 Bone Machine\n" +
+		" 3  Pixies/Doolittle/2 Tame\n"
+	if b.String() != want {
+		t.Errorf("Expected the stats\n%s\nbut got\n%s", want, b.String())
+	}
+
+	if err := printStats(&b, playCounts(filepath.Join(t.TempDir(), "none.json")), 3); err == nil {
+		t.Error("Expected an error when nothing's been played")
+	}
+}
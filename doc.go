@@ -16,6 +16,35 @@ playing music assume a conventional directory structure of
 				Album2/
 			…
 
+The Music folder can be elsewhere, if it is given by the -dir flag
+or the SPLAY_MUSIC_DIR environment variable, or by XDG_MUSIC_DIR in
+~/.config/user-dirs.dirs. There can be more than one, if -dir is
+repeated, or SPLAY_MUSIC_DIR is a list of folders separated like $PATH.
+
+Each track that is played is added to a history, in
+$XDG_DATA_HOME/splay/history.tsv, or ~/.local/share/splay/history.tsv,
+and counted in counts.json beside it, unless the -no-history flag
+is given. The -stats flag prints the tracks played the most.
+
+If splay is stopped partway through, what was left to play is kept
+in resume.json beside the history, and the -resume flag plays it,
+from the start of the track which was stopped, or, with mpv, from
+where in it playing stopped.
+
+Defaults for any of the flags can be given in ~/.config/splay/config,
+or splay/config in $XDG_CONFIG_HOME, with lines like
+
+	player=mpv --no-video
+	dir=/media/music
+	shuffle=false
+
+Flags given on the command line override them.
+
+Names of artists and albums can be completed in bash or zsh, with
+the script printed by the -completion flag, e.g.
+
+	source <(splay -completion bash)
+
 © 2012 Steve McCoy. Available under the MIT License.
 */
 package main
@@ -0,0 +1,318 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// listDurations is true iff the listings of albums give the duration
+// of each track, and of the whole album.
+var listDurations = false
+
+// readDuration returns how long the track whose contents are r plays
+// for, or false if that can't be told from its headers. FLAC, Ogg
+// Vorbis, Opus, WAV, MP4, and MP3 files are understood.
+func readDuration(r io.ReadSeeker) (time.Duration, bool) {
+	var magic [12]byte
+	n, _ := io.ReadFull(r, magic[:])
+	if _, err := r.Seek(0, io.SeekStart); err != nil || n < 4 {
+		return 0, false
+	}
+
+	switch {
+	case string(magic[:4]) == "fLaC":
+		return flacDuration(r)
+	case string(magic[:4]) == "OggS":
+		return oggDuration(r)
+	case n == 12 && string(magic[:4]) == "RIFF" && string(magic[8:12]) == "WAVE":
+		return wavDuration(r)
+	case n >= 8 && string(magic[4:8]) == "ftyp":
+		return mp4Duration(r)
+	}
+	return mp3Duration(r)
+}
+
+// fileDuration returns how long the track at path plays for,
+// or false if that can't be told.
+func fileDuration(path string) (time.Duration, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	return readDuration(f)
+}
+
+// durationOf returns how long it takes for n samples, or bytes,
+// to go by at rate of them per second.
+func durationOf(n, rate uint64) time.Duration {
+	return time.Duration(n/rate*uint64(time.Second) + n%rate*uint64(time.Second)/rate)
+}
+
+// flacDuration reads the duration from the STREAMINFO block,
+// which is always first, of the FLAC stream r.
+func flacDuration(r io.Reader) (time.Duration, bool) {
+	var b [4 + 4 + 34]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil || b[4]&0x7f != 0 {
+		return 0, false
+	}
+	info := b[8:]
+	rate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+	total := uint64(info[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	if rate == 0 || total == 0 {
+		return 0, false
+	}
+	return durationOf(total, rate), true
+}
+
+// oggDuration reads the sample rate from the identification header of
+// the Ogg Vorbis or Opus stream r, and the number of samples from the
+// granule position of its last page.
+func oggDuration(r io.ReadSeeker) (time.Duration, bool) {
+	var first [27 + 255 + 19]byte
+	n, _ := io.ReadFull(r, first[:])
+	if n < 28 || n < 27+int(first[26]) {
+		return 0, false
+	}
+	packet := first[27+int(first[26]) : n]
+
+	var rate, skip uint64
+	switch {
+	case len(packet) >= 16 && string(packet[:7]) == "\x01vorbis":
+		rate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+	case len(packet) >= 12 && string(packet[:8]) == "OpusHead":
+		// Opus always counts samples at 48kHz.
+		rate = 48000
+		skip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	}
+	if rate == 0 {
+		return 0, false
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	tail := min(end, 64*1024)
+	if _, err := r.Seek(-tail, io.SeekEnd); err != nil {
+		return 0, false
+	}
+	b := make([]byte, tail)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, false
+	}
+	i := bytes.LastIndex(b, []byte("OggS"))
+	if i < 0 || len(b)-i < 14 {
+		return 0, false
+	}
+	granule := binary.LittleEndian.Uint64(b[i+6 : i+14])
+	if granule <= skip || granule == ^uint64(0) {
+		return 0, false
+	}
+	return durationOf(granule-skip, rate), true
+}
+
+// wavDuration reads the duration from the "fmt " and "data" chunks
+// of the WAV file r.
+func wavDuration(r io.Reader) (time.Duration, bool) {
+	if _, err := io.CopyN(io.Discard, r, 12); err != nil {
+		return 0, false
+	}
+	var byteRate uint64
+	for {
+		var h [8]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return 0, false
+		}
+		size := int64(binary.LittleEndian.Uint32(h[4:]))
+		switch string(h[:4]) {
+		case "fmt ":
+			var f [16]byte
+			if size < 16 {
+				return 0, false
+			}
+			if _, err := io.ReadFull(r, f[:]); err != nil {
+				return 0, false
+			}
+			byteRate = uint64(binary.LittleEndian.Uint32(f[8:12]))
+			size -= 16
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			return durationOf(uint64(size), byteRate), true
+		}
+		// Chunks are padded to an even size.
+		if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+			return 0, false
+		}
+	}
+}
+
+// mp4Duration reads the duration from the movie header, the "mvhd"
+// box in the "moov" box, of the MP4 file r.
+func mp4Duration(r io.ReadSeeker) (time.Duration, bool) {
+	moov, ok := mp4Box(r, "moov", -1)
+	if !ok {
+		return 0, false
+	}
+	mvhd, ok := mp4Box(r, "mvhd", moov)
+	if !ok || mvhd < 4 {
+		return 0, false
+	}
+	var version [4]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return 0, false
+	}
+
+	var scale, length uint64
+	if version[0] == 1 {
+		var b [28]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, false
+		}
+		scale = uint64(binary.BigEndian.Uint32(b[16:20]))
+		length = binary.BigEndian.Uint64(b[20:28])
+	} else {
+		var b [16]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, false
+		}
+		scale = uint64(binary.BigEndian.Uint32(b[8:12]))
+		length = uint64(binary.BigEndian.Uint32(b[12:16]))
+	}
+	if scale == 0 || length == 0 {
+		return 0, false
+	}
+	return durationOf(length, scale), true
+}
+
+// mp4Box finds the MP4 box of the given type among the next n bytes
+// of r, or all of the rest of it if n is negative, and returns the size
+// of its contents, which r is left at the start of.
+func mp4Box(r io.ReadSeeker, kind string, n int64) (int64, bool) {
+	for n < 0 || n >= 8 {
+		var h [8]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return 0, false
+		}
+		size, head := int64(binary.BigEndian.Uint32(h[:4])), int64(8)
+		if size == 1 {
+			var big [8]byte
+			if _, err := io.ReadFull(r, big[:]); err != nil {
+				return 0, false
+			}
+			size, head = int64(binary.BigEndian.Uint64(big[:])), 16
+		}
+		if size < head {
+			return 0, false
+		}
+		if string(h[4:]) == kind {
+			return size - head, true
+		}
+		if _, err := r.Seek(size-head, io.SeekCurrent); err != nil {
+			return 0, false
+		}
+		if n >= 0 {
+			n -= size
+		}
+	}
+	return 0, false
+}
+
+// The bit rates, in kbit/s, of MPEG-1 and MPEG-2 Layer III frames.
+var (
+	mpeg1Rates = [16]uint64{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+	mpeg2Rates = [16]uint64{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+)
+
+// mp3Duration reads the duration of the MP3 file r from the Xing,
+// Info, or VBRI header in its first frame, if it has one, or else
+// estimates it from its size and the bit rate of its first frame.
+func mp3Duration(r io.ReadSeeker) (time.Duration, bool) {
+	var start int64
+	var id3 [10]byte
+	if _, err := io.ReadFull(r, id3[:]); err == nil && string(id3[:3]) == "ID3" {
+		start = 10 + int64(syncsafe(id3[6:10]))
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, false
+	}
+
+	b := make([]byte, 4096)
+	n, _ := io.ReadFull(r, b)
+	b = b[:n]
+	i := 0
+	for ; i+4 <= len(b); i++ {
+		if b[i] == 0xff && b[i+1]&0xe0 == 0xe0 && b[i+1]&0x06 == 0x02 {
+			break
+		}
+	}
+	if i+4 > len(b) {
+		return 0, false
+	}
+	start += int64(i)
+	frame := b[i:]
+
+	version := frame[1] >> 3 & 3 // 3 is MPEG-1, 2 MPEG-2, 0 MPEG-2.5
+	rateIndex := frame[2] >> 4
+	srIndex := frame[2] >> 2 & 3
+	mono := frame[3]>>6 == 3
+	if version == 1 || srIndex == 3 {
+		return 0, false
+	}
+
+	rates := mpeg2Rates
+	sampleRate := [3]uint64{22050, 24000, 16000}[srIndex]
+	perFrame := uint64(576)
+	side := 9
+	if !mono {
+		side = 17
+	}
+	switch version {
+	case 3:
+		rates = mpeg1Rates
+		sampleRate *= 2
+		perFrame = 1152
+		side = 32
+		if mono {
+			side = 17
+		}
+	case 0:
+		sampleRate /= 2
+	}
+
+	if x := 4 + side; len(frame) >= x+12 && (string(frame[x:x+4]) == "Xing" || string(frame[x:x+4]) == "Info") {
+		if binary.BigEndian.Uint32(frame[x+4:])&1 != 0 {
+			frames := uint64(binary.BigEndian.Uint32(frame[x+8:]))
+			return durationOf(frames*perFrame, sampleRate), frames > 0
+		}
+	}
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		frames := uint64(binary.BigEndian.Uint32(frame[36+14:]))
+		return durationOf(frames*perFrame, sampleRate), frames > 0
+	}
+
+	bitRate := rates[rateIndex] * 1000
+	end, err := r.Seek(0, io.SeekEnd)
+	if bitRate == 0 || err != nil || end <= start {
+		return 0, false
+	}
+	return durationOf(uint64(end-start)*8, bitRate), true
+}
+
+// formatDuration formats d as minutes and seconds, e.g. "03:07",
+// or "??:??" if it isn't known.
+func formatDuration(d time.Duration, ok bool) string {
+	if !ok {
+		return "??:??"
+	}
+	s := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
@@ -0,0 +1,184 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// flacOf returns a FLAC stream of n samples at rate per second.
+func flacOf(n, rate uint64) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(rate >> 12)
+	info[11] = byte(rate >> 4)
+	info[12] = byte(rate<<4) | 0x02 // 2 channels
+	info[13] = 0xf0 | byte(n>>32)   // 16 bits per sample
+	binary.BigEndian.PutUint32(info[14:], uint32(n))
+
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	b.Write([]byte{0x80, 0, 0, 34})
+	b.Write(info)
+	return b.Bytes()
+}
+
+// wavOf returns a WAV file of n bytes of audio at rate bytes per second.
+func wavOf(n, rate uint32) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	b.WriteString("abc\x00")
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, []uint32{16, 0x00020001, 44100, rate, 0x00100004})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, n)
+	return b.Bytes()
+}
+
+// oggOf returns an Ogg stream whose first packet is head, and whose
+// last page is at granule position n.
+func oggOf(head []byte, n uint64) []byte {
+	var b bytes.Buffer
+	page := func(granule uint64, packet []byte) {
+		b.WriteString("OggS\x00\x00")
+		binary.Write(&b, binary.LittleEndian, granule)
+		b.Write(make([]byte, 12))
+		b.WriteByte(1)
+		b.WriteByte(byte(len(packet)))
+		b.Write(packet)
+	}
+	page(0, head)
+	page(n/2, []byte("audio"))
+	page(n, []byte("audio"))
+	return b.Bytes()
+}
+
+// truncatedOgg returns an Ogg page which ends before its
+// segment table, which says it has 200 segments.
+func truncatedOgg() []byte {
+	b := oggOf(vorbisHead(44100), 44100*200)[:40]
+	b[26] = 200
+	return b
+}
+
+func vorbisHead(rate uint32) []byte {
+	h := []byte("\x01vorbis\x00\x00\x00\x00\x02")
+	h = binary.LittleEndian.AppendUint32(h, rate)
+	return append(h, make([]byte, 14)...)
+}
+
+func opusHead(skip uint16) []byte {
+	h := []byte("OpusHead\x01\x02")
+	h = binary.LittleEndian.AppendUint16(h, skip)
+	return binary.LittleEndian.AppendUint32(h, 44100)
+}
+
+// mp4Of returns an MP4 file lasting n units of the given time scale.
+func mp4Of(n, scale uint32) []byte {
+	box := func(kind string, body []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+		return append(append(b, kind...), body...)
+	}
+	mvhd := make([]byte, 20+80)
+	binary.BigEndian.PutUint32(mvhd[12:], scale)
+	binary.BigEndian.PutUint32(mvhd[16:], n)
+	var b []byte
+	b = append(b, box("ftyp", []byte("M4A \x00\x00\x00\x00"))...)
+	b = append(b, box("free", nil)...)
+	b = append(b, box("moov", append(box("udta", []byte("xyz")), box("mvhd", mvhd)...))...)
+	return append(b, box("mdat", []byte("audio"))...)
+}
+
+// mp3Of returns an MPEG-1 Layer III stream of stereo 44.1kHz frames at
+// 128kbit/s, with a Xing header saying how many frames it has, if
+// frames is positive, or else n bytes of frames.
+func mp3Of(frames uint32, n int) []byte {
+	frame := []byte{0xff, 0xfb, 0x90, 0x00}
+	var b []byte
+	b = append(b, id3v2(3, "TIT2", "\x00Debaser")...)
+	b = b[:len(b)-len("\xff\xfb audio")]
+	start := len(b)
+	b = append(b, frame...)
+	if frames > 0 {
+		b = append(b, make([]byte, 32)...)
+		b = append(b, "Xing\x00\x00\x00\x01"...)
+		b = binary.BigEndian.AppendUint32(b, frames)
+	}
+	for len(b)-start < n {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestReadDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		d    time.Duration
+		ok   bool
+	}{
+		{"FLAC", flacOf(44100*187, 44100), 187 * time.Second, true},
+		{"FLAC of unknown length", flacOf(0, 44100), 0, false},
+		{"WAV", wavOf(176400*90+88200, 176400), 90*time.Second + 500*time.Millisecond, true},
+		{"Ogg Vorbis", oggOf(vorbisHead(44100), 44100*200), 200 * time.Second, true},
+		{"Opus", oggOf(opusHead(312), 48000*61+312), 61 * time.Second, true},
+		{"MP4", mp4Of(600*245, 600), 245 * time.Second, true},
+		{"VBR MP3", mp3Of(38*60, 0), 1152 * 38 * 60 * time.Second / 44100, true},
+		{"CBR MP3", mp3Of(0, 16000*30), 30 * time.Second, true},
+		{"truncated Ogg", truncatedOgg(), 0, false},
+		{"empty", nil, 0, false},
+		{"text", []byte("This isn't music."), 0, false},
+	}
+	for _, test := range tests {
+		d, ok := readDuration(bytes.NewReader(test.data))
+		if d != test.d || ok != test.ok {
+			t.Errorf("The %s duration should be %v, %v, but got %v, %v", test.name, test.d, test.ok, d, ok)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		ok   bool
+		text string
+	}{
+		{0, true, "00:00"},
+		{187 * time.Second, true, "03:07"},
+		{59*time.Second + 600*time.Millisecond, true, "01:00"},
+		{72 * time.Minute, true, "72:00"},
+		{0, false, "??:??"},
+	}
+	for _, test := range tests {
+		if s := formatDuration(test.d, test.ok); s != test.text {
+			t.Errorf("formatDuration(%v, %v) should be %q, but got %q", test.d, test.ok, test.text, s)
+		}
+	}
+}
+
+func TestListDurations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Pixies/Doolittle/1 Debaser.flac": &fstest.MapFile{Data: flacOf(44100*172, 44100)},
+		"Pixies/Doolittle/2 Tame.ogg":     &fstest.MapFile{Data: oggOf(vorbisHead(48000), 48000*115)},
+		"Pixies/Doolittle/3 Wave.mp3":     &fstest.MapFile{},
+	}
+	l := NewLibrary(fsys, filepath.FromSlash("/music"))
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+
+	defer func() { listDurations = false }()
+	listDurations = true
+	var buf bytes.Buffer
+	if err := doolittle.List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "02:52  1 Debaser.flac\n01:55  2 Tame.ogg\n??:??  3 Wave.mp3\n04:47  Total\n"
+	if buf.String() != want {
+		t.Errorf("Expected the listing %q, but got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,108 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// An exportedTrack is the record of a track in an export of a Library.
+type exportedTrack struct {
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+	Track  string `json:"track"`
+	Path   string `json:"path"`
+}
+
+// exportTracks returns the records of every track in l, in order
+// of their artists, albums, and paths.
+func (l *Library) exportTracks() ([]exportedTrack, error) {
+	artists, paths, err := l.artists()
+	if err != nil {
+		return nil, err
+	}
+
+	ts := []exportedTrack{}
+	add := func(artistName, albumName string, songs []os.FileInfo, spaths []string) error {
+		for j, song := range songs {
+			abs, err := filepath.Abs(spaths[j])
+			if err != nil {
+				return err
+			}
+			ts = append(ts, exportedTrack{
+				Artist: artistName,
+				Album:  albumName,
+				Track:  l.title(song, spaths[j]),
+				Path:   abs,
+			})
+		}
+		return nil
+	}
+	for i, artist := range artists {
+		albums, err := l.subDirs(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, al := range albums {
+			songs, spaths, err := (&album{lib: l, path: filepath.Join(paths[i], al.Name())}).songs()
+			if err != nil {
+				return nil, err
+			}
+			if err := add(artist.Name(), al.Name(), songs, spaths); err != nil {
+				return nil, err
+			}
+		}
+
+		// Tracks loose in the artist's folder are an album of their
+		// own, named for the artist, as when the artist is played.
+		loose, err := l.subFiles(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		lpaths := make([]string, len(loose))
+		for j, song := range loose {
+			lpaths[j] = filepath.Join(paths[i], song.Name())
+		}
+		if err := add(artist.Name(), artist.Name(), loose, lpaths); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(ts, func(i, j int) bool {
+		switch {
+		case ts[i].Artist != ts[j].Artist:
+			return ts[i].Artist < ts[j].Artist
+		case ts[i].Album != ts[j].Album:
+			return ts[i].Album < ts[j].Album
+		}
+		return ts[i].Path < ts[j].Path
+	})
+	return ts, nil
+}
+
+// export writes a record of every track in lib to w, in the given
+// format: "csv", with a header, or "json".
+func export(w io.Writer, lib *Library, format string) error {
+	if format != "csv" && format != "json" {
+		return newError("I can only export csv or json, not %q.", format)
+	}
+	ts, err := lib.exportTracks()
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return writeJSON(w, ts)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"artist", "album", "track", "path"})
+	for _, t := range ts {
+		cw.Write([]string{t.Artist, t.Album, t.Track, t.Path})
+	}
+	cw.Flush()
+	return cw.Error()
+}
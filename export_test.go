@@ -0,0 +1,71 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	l := mapLibrary(
+		"Weezer/Pinkerton/2 Getchoo.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/cover.jpg",
+		"Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg",
+		"Pixies/Bossanova/Disc 2/1 Rock Music, Too.ogg",
+		"The Who/.keep",
+		"Weezer/Undone.ogg",
+	)
+	path := func(p string) string {
+		abs, err := filepath.Abs(filepath.Join(l.root(), filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return abs
+	}
+
+	var b bytes.Buffer
+	if err := export(&b, l, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"artist,album,track,path",
+		"Pixies,Bossanova,1 Cecilia Ann," + path("Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg"),
+		`Pixies,Bossanova,"1 Rock Music, Too","` + path("Pixies/Bossanova/Disc 2/1 Rock Music, Too.ogg") + `"`,
+		"Pixies,Doolittle,1 Debaser," + path("Pixies/Doolittle/1 Debaser.ogg"),
+		"Weezer,Pinkerton,1 Tired of Sex," + path("Weezer/Pinkerton/1 Tired of Sex.ogg"),
+		"Weezer,Pinkerton,2 Getchoo," + path("Weezer/Pinkerton/2 Getchoo.ogg"),
+		"Weezer,Weezer,Undone," + path("Weezer/Undone.ogg"),
+	}, "\n") + "\n"
+	if b.String() != want {
+		t.Errorf("Expected the CSV\n%s\nbut got\n%s", want, b.String())
+	}
+
+	b.Reset()
+	if err := export(&b, l, "json"); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, err := json.MarshalIndent([]exportedTrack{
+		{"Pixies", "Bossanova", "1 Cecilia Ann", path("Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg")},
+		{"Pixies", "Bossanova", "1 Rock Music, Too", path("Pixies/Bossanova/Disc 2/1 Rock Music, Too.ogg")},
+		{"Pixies", "Doolittle", "1 Debaser", path("Pixies/Doolittle/1 Debaser.ogg")},
+		{"Weezer", "Pinkerton", "1 Tired of Sex", path("Weezer/Pinkerton/1 Tired of Sex.ogg")},
+		{"Weezer", "Pinkerton", "2 Getchoo", path("Weezer/Pinkerton/2 Getchoo.ogg")},
+		{"Weezer", "Weezer", "Undone", path("Weezer/Undone.ogg")},
+	}, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != string(wantJSON)+"\n" {
+		t.Errorf("Expected the JSON\n%s\nbut got\n%s", wantJSON, b.String())
+	}
+
+	if err := export(&b, l, "xml"); err == nil {
+		t.Error("Expected an error exporting xml")
+	}
+}
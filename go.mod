@@ -0,0 +1,5 @@
+module github.com/mccoyst/splay
+
+go 1.25.0
+
+require golang.org/x/text v0.40.0
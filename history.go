@@ -0,0 +1,151 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dataDir returns the folder where splay keeps what it learns about
+// what's played: splay in $XDG_DATA_HOME, or in ~/.local/share.
+func dataDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", newError("I can't tell where to keep the history of what's played: %v. Give a file with -history, or use -no-history.", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "splay"), nil
+}
+
+// defaultHistory returns where the history of tracks played is kept
+// unless -history says otherwise: history.tsv in the dataDir.
+func defaultHistory() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.tsv"), nil
+}
+
+// A historyFile records the tracks which were played by appending a line
+// for each to the file at its path, with tab-separated columns for when it
+// started, its artist, its album, and its song. It records the same tracks
+// which would be scrobbled.
+type historyFile string
+
+func (h historyFile) Scrobble(path, artist, album, song string, started time.Time) error {
+	line := strings.Join([]string{
+		started.Format(time.RFC3339),
+		tsvField(artist),
+		tsvField(album),
+		tsvField(song),
+	}, "\t") + "\n"
+
+	if err := os.MkdirAll(filepath.Dir(string(h)), 0755); err != nil {
+		return newError("Couldn't keep the history of what's played: %v", err)
+	}
+	// Each line is appended with a single write, so that lines from
+	// several splays at once don't get mixed up.
+	f, err := os.OpenFile(string(h), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return newError("Couldn't keep the history of what's played: %v", err)
+	}
+	_, err = f.WriteString(line)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return newError("Couldn't keep the history of what's played: %v", err)
+	}
+	return nil
+}
+
+// tsvField returns s with any tabs or line breaks, which would
+// split it into more than one field, replaced by spaces.
+func tsvField(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\n', '\r':
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// A playedTrack identifies a track in the history by the names of
+// its artist, album, and song.
+type playedTrack struct {
+	artist, album, song string
+}
+
+// readHistory returns the tracks in the history r which were played
+// at or after since. Lines which can't be understood are ignored.
+func readHistory(r io.Reader, since time.Time) (map[playedTrack]bool, error) {
+	played := map[playedTrack]bool{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Split(s.Text(), "\t")
+		if len(f) != 4 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, f[0])
+		if err != nil || t.Before(since) {
+			continue
+		}
+		played[playedTrack{f[1], f[2], f[3]}] = true
+	}
+	return played, s.Err()
+}
+
+// recentlyPlayed returns the tracks in the history at path which were
+// played at or after since. If there's no history yet, none were.
+func recentlyPlayed(path string, since time.Time) (map[playedTrack]bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[playedTrack]bool{}, nil
+	}
+	if err != nil {
+		return nil, newError("Couldn't read the history of what's played: %v", err)
+	}
+	defer f.Close()
+	played, err := readHistory(f, since)
+	if err != nil {
+		return nil, newError("Couldn't read the history of what's played: %v", err)
+	}
+	return played, nil
+}
+
+// stale holds the tracks which shuffling skips, because they were played
+// too recently, as -fresh says. It is nil if none are skipped.
+var stale map[playedTrack]bool
+
+// fresh returns the songs, and their paths, which aren't stale.
+// If they all are, they're all returned.
+func fresh(lib *Library, songs []os.FileInfo, paths []string) ([]os.FileInfo, []string) {
+	if len(stale) == 0 {
+		return songs, paths
+	}
+	var fsongs []os.FileInfo
+	var fpaths []string
+	for i, path := range paths {
+		artist, album, song := newTrack(lib, path).(*track).names()
+		if !stale[playedTrack{tsvField(artist), tsvField(album), tsvField(song)}] {
+			fsongs = append(fsongs, songs[i])
+			fpaths = append(fpaths, path)
+		}
+	}
+	if len(fpaths) == 0 {
+		return songs, paths
+	}
+	return fsongs, fpaths
+}
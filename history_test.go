@@ -0,0 +1,130 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDefaultHistory(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", filepath.FromSlash("/data"))
+	if h, err := defaultHistory(); err != nil || h != filepath.FromSlash("/data/splay/history.tsv") {
+		t.Errorf("With $XDG_DATA_HOME set, expected history in /data/splay, but got %q, %v", h, err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	want := filepath.Join(home, ".local", "share", "splay", "history.tsv")
+	if h, err := defaultHistory(); err != nil || h != want {
+		t.Errorf("Expected history in %s, but got %q, %v", want, h, err)
+	}
+}
+
+func TestPlayHistory(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+	)
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+	path := filepath.Join(t.TempDir(), "new", "history.tsv")
+
+	now := time.Date(2012, 6, 1, 12, 0, 0, 0, time.UTC)
+	p, _ := fakePlayer(t, "mpg123")
+	p.now = func() time.Time { return now }
+	p.run = func(c *exec.Cmd) error {
+		if filepath.Base(c.Args[1]) == "2 Tame.ogg" {
+			// Skipped too soon to count.
+			now = now.Add(5 * time.Second)
+		} else {
+			now = now.Add(3 * time.Minute)
+		}
+		return nil
+	}
+	p.length = func(string) (time.Duration, bool) { return 3 * time.Minute, true }
+	p.Scrobblers = []scrobbler{historyFile(path)}
+
+	for i := 0; i < 2; i++ {
+		if err := doolittle.Play(context.Background(), p, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	historyFile(path).Scrobble("", "The\tPixies", "Doolittle", "Here Comes\nYour Man", now)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2012-06-01T12:00:00Z\tPixies\tDoolittle\t1 Debaser\n" +
+		"2012-06-01T12:03:05Z\tPixies\tDoolittle\t3 Wave of Mutilation\n" +
+		"2012-06-01T12:06:05Z\tPixies\tDoolittle\t1 Debaser\n" +
+		"2012-06-01T12:09:10Z\tPixies\tDoolittle\t3 Wave of Mutilation\n" +
+		"2012-06-01T12:12:10Z\tThe Pixies\tDoolittle\tHere Comes Your Man\n"
+	if string(b) != want {
+		t.Errorf("Expected the history\n%s\nbut got\n%s", want, b)
+	}
+}
+
+func TestFresh(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+	path := filepath.Join(t.TempDir(), "history.tsv")
+	history := "2012-05-30T12:00:00Z\tPixies\tDoolittle\t2 Tame\n" +
+		"2012-06-01T09:00:00Z\tPixies\tDoolittle\t1 Debaser\n" +
+		"not a line of history\n" +
+		"2012-06-01T10:00:00Z\tPixies\tSurfer Rosa\t2 Break My Body\n"
+	if err := os.WriteFile(path, []byte(history), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { stale = nil }()
+
+	now := time.Date(2012, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		within time.Duration
+		want   []string
+	}{
+		{time.Hour, []string{"1 Bone Machine.ogg", "1 Debaser.ogg", "2 Break My Body.ogg", "2 Tame.ogg"}},
+		{24 * time.Hour, []string{"1 Bone Machine.ogg", "2 Tame.ogg"}},
+		// Everything's been played, so everything's fresh again.
+		{72 * time.Hour, []string{"1 Bone Machine.ogg", "1 Debaser.ogg", "2 Break My Body.ogg", "2 Tame.ogg"}},
+	}
+	for _, test := range tests {
+		if test.within == 72*time.Hour {
+			historyFile(path).Scrobble("", "Pixies", "Surfer Rosa", "1 Bone Machine", now)
+		}
+		var err error
+		stale, err = recentlyPlayed(path, now.Add(-test.within))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths, err := newCollection(l, true).Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range paths {
+			got = append(got, filepath.Base(p))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Within %v, expected to shuffle %q, but shuffled %q", test.within, test.want, got)
+		}
+	}
+
+	if played, err := recentlyPlayed(filepath.Join(t.TempDir(), "none.tsv"), now); err != nil || len(played) != 0 {
+		t.Errorf("Without a history, expected nothing to have been played, but got %v, %v", played, err)
+	}
+}
@@ -0,0 +1,59 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// quitWindow is how soon a second interrupt must follow the first
+// for splay to quit, rather than skip another track.
+var quitWindow = 500 * time.Millisecond
+
+// handleInterrupts calls skip for each signal received from sigs,
+// or calls quit and returns if one follows the last within quitWindow.
+// The times of signals are given by now.
+func handleInterrupts(sigs <-chan os.Signal, skip, quit func(), now func() time.Time) {
+	var last time.Time
+	for range sigs {
+		t := now()
+		if !last.IsZero() && t.Sub(last) <= quitWindow {
+			quit()
+			return
+		}
+		last = t
+		skip()
+	}
+}
+
+// handleTerminations calls stop once a signal is received from sigs,
+// such as SIGTERM, meaning splay should stop playing and exit. stop
+// must kill the player, so that it doesn't go on playing without splay.
+func handleTerminations(sigs <-chan os.Signal, stop func()) {
+	if _, ok := <-sigs; ok {
+		stop()
+	}
+}
+
+// handleSignals arranges for interrupting splay once to call skip, and
+// twice to quit, as does terminating it, or it losing the terminal. It
+// returns a context which is done once it's time to quit, so that the
+// player is killed, rather than left playing after splay has gone.
+// Other reasons to quit can be given to the returned function.
+func handleSignals(skip func()) (context.Context, context.CancelCauseFunc) {
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+	cancel := func() { cancelCause(nil) }
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go handleInterrupts(sigs, skip, cancel, time.Now)
+
+	terms := make(chan os.Signal, 1)
+	signal.Notify(terms, syscall.SIGTERM, syscall.SIGHUP)
+	go handleTerminations(terms, cancel)
+	return ctx, cancelCause
+}
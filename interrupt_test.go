@@ -0,0 +1,49 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandleInterrupts(t *testing.T) {
+	begin := time.Now()
+	ms := func(n int) time.Time {
+		return begin.Add(time.Duration(n) * time.Millisecond)
+	}
+
+	tests := []struct {
+		times []time.Time
+		skips int
+		quit  bool
+	}{
+		{[]time.Time{ms(0)}, 1, false},
+		{[]time.Time{ms(0), ms(200)}, 1, true},
+		{[]time.Time{ms(0), ms(600), ms(1200)}, 3, false},
+		{[]time.Time{ms(0), ms(600), ms(700), ms(800)}, 2, true},
+		{[]time.Time{ms(0), ms(500)}, 1, true},
+	}
+
+	for _, test := range tests {
+		sigs := make(chan os.Signal, len(test.times))
+		for range test.times {
+			sigs <- os.Interrupt
+		}
+		close(sigs)
+
+		skips, quit := 0, false
+		i := 0
+		now := func() time.Time {
+			i++
+			return test.times[i-1]
+		}
+		handleInterrupts(sigs, func() { skips++ }, func() { quit = true }, now)
+
+		if skips != test.skips || quit != test.quit {
+			t.Errorf("Interrupts at %v should skip %d times and quit=%v, but skipped %d times and quit=%v",
+				test.times, test.skips, test.quit, skips, quit)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTerminationKillsPlayer(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("Can't find sh to play with:", err)
+	}
+	p, err := newPlayer(`sh -c "exec sleep 60" sh`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pids := make(chan int, 1)
+	p.run = func(c *exec.Cmd) error {
+		if err := c.Start(); err != nil {
+			return err
+		}
+		pids <- c.Process.Pid
+		return c.Wait()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	go handleTerminations(sigs, cancel)
+
+	played := make(chan error, 1)
+	go func() { played <- p.Play(ctx, "/music/Pixies/Doolittle/1 Debaser.ogg") }()
+
+	var pid int
+	select {
+	case pid = <-pids:
+	case err := <-played:
+		t.Fatal("The player didn't start:", err)
+	}
+	sigs <- syscall.SIGTERM
+
+	select {
+	case err := <-played:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected playing to be cancelled, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Playing went on after splay was terminated")
+	}
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("Expected the player to have been killed, but signalling it gave %v", err)
+	}
+}
+
+func TestPlayerProcessGroup(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("Can't find sh to play with:", err)
+	}
+	p, err := newPlayer(`sh -c "sleep 60; :" sh`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgids := make(chan int, 1)
+	p.run = func(c *exec.Cmd) error {
+		if err := c.Start(); err != nil {
+			return err
+		}
+		pgid, err := syscall.Getpgid(c.Process.Pid)
+		if err != nil {
+			pgid = -1
+		}
+		if pgid != c.Process.Pid {
+			t.Errorf("Expected the player to lead its own process group, but its group is %d, not %d", pgid, c.Process.Pid)
+		}
+		pgids <- pgid
+		return c.Wait()
+	}
+
+	played := make(chan error, 1)
+	go func() { played <- p.Play(context.Background(), "/music/Pixies/Doolittle/1 Debaser.ogg") }()
+	select {
+	case <-pgids:
+	case err := <-played:
+		t.Fatal("The player didn't start:", err)
+	}
+	p.Skip()
+
+	select {
+	case err := <-played:
+		if err != nil {
+			t.Errorf("Expected skipping to play on, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The player's group wasn't killed when it was skipped")
+	}
+}
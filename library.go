@@ -0,0 +1,729 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Library is one or more Music folders, each organized into folders
+// of artists, each holding folders of albums, each holding tracks.
+//
+// A Library reads each folder once, and remembers what it found
+// until it is refreshed.
+type Library struct {
+	folders []musicFolder
+
+	mu    sync.Mutex
+	cache map[string][]os.FileInfo // the entries of each folder read, by path
+	tagc  map[string]trackTags     // the tags of each track read, by path
+}
+
+// A musicFolder is one of the Music folders of a Library. Its contents
+// are read from fsys, which needn't be on disk, but its tracks are played
+// from the folder at root, so that's where the paths of its Music are.
+type musicFolder struct {
+	fsys fs.FS
+	root string
+}
+
+// NewLibrary returns a Library whose contents are read from fsys,
+// and whose Music has paths beneath root.
+func NewLibrary(fsys fs.FS, root string) *Library {
+	return &Library{folders: []musicFolder{{fsys, root}}}
+}
+
+// Add adds another Music folder to l, whose contents are read from fsys,
+// and whose Music has paths beneath root. Its artists are considered
+// along with those of l's other folders, even if they have the same
+// names. Add must be called before l is used.
+func (l *Library) Add(fsys fs.FS, root string) {
+	l.folders = append(l.folders, musicFolder{fsys, root})
+}
+
+// root returns the path of l's first Music folder.
+func (l *Library) root() string {
+	return l.folders[0].root
+}
+
+// Refresh forgets everything l has read, so that changes to
+// its folders are seen.
+func (l *Library) Refresh() {
+	l.mu.Lock()
+	l.cache = nil
+	l.tagc = nil
+	l.mu.Unlock()
+}
+
+// forget forgets what l has read of the folders at paths, so that
+// changes to them are seen.
+func (l *Library) forget(paths ...string) {
+	l.mu.Lock()
+	for _, p := range paths {
+		delete(l.cache, p)
+	}
+	l.mu.Unlock()
+}
+
+// DefaultLibrary returns the Library in the folders given by musiclocs.
+func DefaultLibrary() (*Library, error) {
+	mlocs, err := musiclocs()
+	if err != nil {
+		return nil, err
+	}
+	l := NewLibrary(os.DirFS(mlocs[0]), mlocs[0])
+	for _, mloc := range mlocs[1:] {
+		l.Add(os.DirFS(mloc), mloc)
+	}
+	return l, nil
+}
+
+// LocateArtist returns a Music object for the artist in l which best
+// matches pattern, or nil if none do.
+func (l *Library) LocateArtist(pattern string) (Music, error) {
+	paths, err := l.artistMatches(pattern)
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	return newArtist(l, paths[0]), nil
+}
+
+// LocateAlbum returns a Music object for the album in l which best
+// matches pattern, or nil if none do.
+func (l *Library) LocateAlbum(pattern string) (Music, error) {
+	paths, err := l.albumMatches(pattern)
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	return newAlbum(l, paths[0], false), nil
+}
+
+// LocateTrack returns a Music object for the track in l which best
+// matches pattern, or nil if none do.
+func (l *Library) LocateTrack(pattern string) (Music, error) {
+	paths, err := l.trackMatches(pattern)
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	return newTrack(l, paths[0]), nil
+}
+
+// Search returns a Music object for whatever in l best matches
+// pattern, whether it's an artist, an album, or a track, or nil if
+// nothing does. If several match equally well, the most specific is
+// returned: a track before an album, and an album before an artist.
+func (l *Library) Search(pattern string) (Music, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	levels := []struct {
+		all      func() ([]os.FileInfo, []string, error)
+		newMusic func(string) Music
+	}{
+		{
+			l.songs,
+			func(path string) Music { return newTrack(l, path) },
+		},
+		{
+			func() ([]os.FileInfo, []string, error) { return l.albums(false) },
+			func(path string) Music { return newAlbum(l, path, false) },
+		},
+		{
+			l.artists,
+			func(path string) Music { return newArtist(l, path) },
+		},
+	}
+
+	var best Music
+	bestScore := -1
+	for _, level := range levels {
+		fis, paths, err := level.all()
+		if err != nil {
+			return nil, err
+		}
+		i, score := findBest(fis, pattern, excludeTerms)
+		if i >= 0 && (best == nil || score < bestScore) {
+			best, bestScore = level.newMusic(paths[i]), score
+		}
+	}
+	return best, nil
+}
+
+// A Match is an artist or album which matches a pattern,
+// as returned by Library.Matches.
+type Match struct {
+	Name string
+	Kind string // "artist" or "album"
+	Path string
+
+	// Score is how well it matches; lower is better, and 0 is exact.
+	Score int
+}
+
+// Matches returns up to k of the artists and albums in l which match
+// pattern, best first, or all of them if k isn't positive. Of equally
+// good matches, artists come first, then albums, each in the order
+// LocateArtist and LocateAlbum would prefer them. An artist, or an
+// album by an artist, in more than one of l's folders is only returned
+// once; albums of the same name by different artists are each returned.
+func (l *Library) Matches(pattern string, k int) ([]Match, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	artists, apaths, err := l.artists()
+	if err != nil {
+		return nil, err
+	}
+	albums, alpaths, err := l.albums(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms []Match
+	seen := map[[2]string]bool{}
+	add := func(kind string, fis []os.FileInfo, paths []string) {
+		all, scores := findAllScored(fis, pattern)
+		for j, i := range all {
+			name := fis[i].Name()
+			key := [2]string{kind, name}
+			if kind == "album" {
+				key[1] = filepath.Join(filepath.Base(filepath.Dir(paths[i])), name)
+			}
+			if seen[key] || containsAny(name, excludeTerms) {
+				continue
+			}
+			seen[key] = true
+			ms = append(ms, Match{name, kind, paths[i], scores[j]})
+		}
+	}
+	add("artist", artists, apaths)
+	add("album", albums, alpaths)
+
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].Score < ms[j].Score })
+	if k > 0 && len(ms) > k {
+		ms = ms[:k]
+	}
+	return ms, nil
+}
+
+// All returns a Music object for every album in l. If mix is true,
+// the tracks of every album are shuffled together.
+func (l *Library) All(mix bool) Music {
+	return newCollection(l, mix)
+}
+
+// newestAlbum returns the album in l which was changed most recently,
+// which is likely the one added last. Of albums changed at the same
+// time, the first by name is returned.
+func (l *Library) newestAlbum() (Music, error) {
+	_, paths, err := l.artists()
+	if err != nil {
+		return nil, err
+	}
+	var newest os.FileInfo
+	var path string
+	for _, a := range paths {
+		albums, err := l.subDirs(a)
+		if err != nil {
+			return nil, err
+		}
+		for _, al := range albums {
+			if newest == nil || al.ModTime().After(newest.ModTime()) ||
+				al.ModTime().Equal(newest.ModTime()) && al.Name() < newest.Name() {
+				newest, path = al, filepath.Join(a, al.Name())
+			}
+		}
+	}
+	if newest == nil {
+		return nil, newError("I failed to find any albums in %s", l.root())
+	}
+	return newAlbum(l, path, false), nil
+}
+
+// randomAlbum returns an album in l picked at random. The pick
+// depends on shuffleSeed, so the same seed picks the same album.
+func (l *Library) randomAlbum() (Music, error) {
+	_, paths, err := (&collection{lib: l}).albums()
+	if err != nil {
+		return nil, err
+	}
+	return newAlbum(l, paths[shuffleRand("album").Intn(len(paths))], false), nil
+}
+
+// randomArtist returns an artist in l picked at random. The pick
+// depends on shuffleSeed, so the same seed picks the same artist.
+func (l *Library) randomArtist() (Music, error) {
+	_, paths, err := l.artists()
+	if err != nil {
+		return nil, err
+	}
+	return newArtist(l, paths[shuffleRand("artist").Intn(len(paths))]), nil
+}
+
+// artistMatches returns the paths of all the artists matching
+// pattern, best match first.
+func (l *Library) artistMatches(pattern string) ([]string, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	artists, alocs, err := l.artists()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, i := range findAllExcept(artists, pattern, excludeTerms) {
+		paths = append(paths, alocs[i])
+	}
+	return paths, nil
+}
+
+// albumMatches returns the paths of all the albums matching
+// pattern, best match first. If none do by their names alone,
+// they're matched by their artists' names and theirs together.
+func (l *Library) albumMatches(pattern string) ([]string, error) {
+	paths, err := l.matchAlbums(pattern, false)
+	if err != nil || len(paths) > 0 {
+		return paths, err
+	}
+	// The pattern may name the artist as well as the album,
+	// as in "weezer blue".
+	return l.matchAlbums(pattern, true)
+}
+
+// matchAlbums returns the paths of all the albums matching pattern,
+// best match first, by their names, or by their artists' names and
+// theirs together, e.g. "Weezer Blue", if withArtists is set.
+func (l *Library) matchAlbums(pattern string, withArtists bool) ([]string, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	allalbums, allnames, err := l.albums(withArtists)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, i := range findAllExcept(allalbums, pattern, excludeTerms) {
+		paths = append(paths, allnames[i])
+	}
+	return paths, nil
+}
+
+// albums returns FileInfos and paths for every album in l. The albums
+// are named by their artists' names and theirs together, e.g.
+// "Weezer Blue", if withArtists is set.
+func (l *Library) albums(withArtists bool) ([]os.FileInfo, []string, error) {
+	_, alocs, err := l.artists()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byArtist, err := l.artistAlbums(alocs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allalbums := []os.FileInfo{}
+	allnames := []string{}
+	for i, aloc := range alocs {
+		for _, album := range byArtist[i] {
+			allnames = append(allnames, filepath.Join(aloc, album.Name()))
+			if withArtists {
+				album = songName(filepath.Base(aloc) + " " + album.Name())
+			}
+			allalbums = append(allalbums, album)
+		}
+	}
+	return allalbums, allnames, nil
+}
+
+// artistAlbums returns the albums of each of the artists at paths, in
+// the same order, reading up to GOMAXPROCS artists' folders at once. If
+// any can't be read, no more are started, and the first error is returned.
+func (l *Library) artistAlbums(paths []string) ([][]os.FileInfo, error) {
+	albums := make([][]os.FileInfo, len(paths))
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	stop := make(chan struct{})
+	work := make(chan int)
+	for n := min(runtime.GOMAXPROCS(0), len(paths)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				as, err := l.subDirs(paths[i])
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+					return
+				}
+				albums[i] = as
+			}
+		}()
+	}
+
+feed:
+	for i := range paths {
+		select {
+		case work <- i:
+		case <-stop:
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return albums, nil
+}
+
+// trackMatches returns the paths of all the tracks matching
+// pattern, best match first.
+func (l *Library) trackMatches(pattern string) ([]string, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	allsongs, allnames, err := l.songs()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, i := range findAllExcept(allsongs, pattern, excludeTerms) {
+		paths = append(paths, allnames[i])
+	}
+	return paths, nil
+}
+
+// songs returns FileInfos, named by their titles, and paths
+// for every track in l.
+func (l *Library) songs() ([]os.FileInfo, []string, error) {
+	_, alocs, err := l.artists()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allsongs := []os.FileInfo{}
+	allnames := []string{}
+	for _, aloc := range alocs {
+		albums, err := l.subDirs(aloc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, a := range albums {
+			alloc := filepath.Join(aloc, a.Name())
+			songs, paths, err := newAlbum(l, alloc, false).(*album).songs()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for i, song := range songs {
+				allsongs = append(allsongs, songName(l.title(song, paths[i])))
+				allnames = append(allnames, paths[i])
+			}
+		}
+
+		// Tracks loose in the artist's folder count, too.
+		loose, err := l.subFiles(aloc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, song := range loose {
+			path := filepath.Join(aloc, song.Name())
+			allsongs = append(allsongs, songName(l.title(song, path)))
+			allnames = append(allnames, path)
+		}
+	}
+	return allsongs, allnames, nil
+}
+
+// artists returns the FileInfos and paths of the artists in all of
+// l's folders. It's an error if there aren't any, or if any of the
+// folders doesn't exist.
+func (l *Library) artists() ([]os.FileInfo, []string, error) {
+	var artists []os.FileInfo
+	var paths []string
+	var roots []string
+	for _, f := range l.folders {
+		as, err := l.subDirs(f.root)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, newError("There's no music folder at %s. Set SPLAY_MUSIC_DIR, or use -dir, to say where your music is.", f.root)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range as {
+			artists = append(artists, a)
+			paths = append(paths, filepath.Join(f.root, a.Name()))
+		}
+		roots = append(roots, f.root)
+	}
+	if len(artists) == 0 {
+		return nil, nil, newError("No music found in %s. Set SPLAY_MUSIC_DIR, or add some albums.", strings.Join(roots, " or "))
+	}
+	return artists, paths, nil
+}
+
+// subFiles returns a list of FileInfos for all audio files under path.
+func (l *Library) subFiles(path string) ([]os.FileInfo, error) {
+	return l.contents(path, func(f os.FileInfo) bool {
+		return !f.IsDir() && audioExts[strings.ToLower(filepath.Ext(f.Name()))]
+	})
+}
+
+// subDirs returns a list of FileInfos for all directories under path.
+func (l *Library) subDirs(path string) ([]os.FileInfo, error) {
+	return l.contents(path, func(f os.FileInfo) bool {
+		return f.IsDir()
+	})
+}
+
+// includeHidden is true iff hidden files and folders are treated
+// like any others, rather than ignored.
+var includeHidden = false
+
+// ignoredNames is the set of the lower-case names of files and folders
+// which, like dotfiles, are made by operating systems or other programs
+// and don't hold music.
+var ignoredNames = map[string]bool{
+	"thumbs.db":                 true,
+	"desktop.ini":               true,
+	"$recycle.bin":              true,
+	"system volume information": true,
+	"lost+found":                true,
+	"@eadir":                    true,
+}
+
+// hidden returns true iff the file or folder with the given name
+// should be ignored, unless includeHidden is set.
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") || ignoredNames[strings.ToLower(name)]
+}
+
+// contents returns a list of FileInfos for all acceptable
+// entries under the given path, which aren't hidden.
+func (l *Library) contents(path string, accept func(os.FileInfo) bool) ([]os.FileInfo, error) {
+	allsubs, err := l.readDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]os.FileInfo, 0, len(allsubs))
+	for _, f := range allsubs {
+		if hidden(f.Name()) && !includeHidden {
+			continue
+		}
+		if accept(f) {
+			subs = append(subs, f)
+		}
+	}
+
+	return subs, nil
+}
+
+// readDir returns the FileInfos of the entries of the folder at path,
+// in natural order, reading it only if it hasn't been read already.
+func (l *Library) readDir(path string) ([]os.FileInfo, error) {
+	l.mu.Lock()
+	fis, ok := l.cache[path]
+	l.mu.Unlock()
+	if ok {
+		return fis, nil
+	}
+
+	f, name, err := l.folder(path)
+	if err != nil {
+		return nil, err
+	}
+	fis, err = f.readEntries(name)
+	if err != nil {
+		return nil, err
+	}
+	sortNatural(fis)
+
+	l.mu.Lock()
+	if l.cache == nil {
+		l.cache = map[string][]os.FileInfo{}
+	}
+	l.cache[path] = fis
+	l.mu.Unlock()
+	return fis, nil
+}
+
+// title returns the name of the track at path, whose FileInfo is fi:
+// its title, if useTags is set and it has one, or else its file name,
+// without the extension.
+func (l *Library) title(fi os.FileInfo, path string) string {
+	if useTags {
+		if t, ok := l.tags(path); ok && t.Title != "" {
+			return t.Title
+		}
+	}
+	return trimExt(fi.Name())
+}
+
+// tags returns the tags of the track at path, if it has any,
+// reading them only if they haven't been read already.
+func (l *Library) tags(path string) (trackTags, bool) {
+	l.mu.Lock()
+	t, ok := l.tagc[path]
+	l.mu.Unlock()
+	if ok {
+		return t, t != trackTags{}
+	}
+
+	if file, err := l.open(path); err == nil {
+		t, _ = readTags(file)
+		file.Close()
+	}
+
+	l.mu.Lock()
+	if l.tagc == nil {
+		l.tagc = map[string]trackTags{}
+	}
+	l.tagc[path] = t
+	l.mu.Unlock()
+	return t, t != trackTags{}
+}
+
+// duration returns how long the track at path plays for,
+// or false if that can't be told.
+func (l *Library) duration(path string) (time.Duration, bool) {
+	file, err := l.open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	return readDuration(file)
+}
+
+// A seekFile is a file which can be read from anywhere.
+type seekFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// open opens the file at path, which must be seekable.
+func (l *Library) open(path string) (seekFile, error) {
+	f, name, err := l.folder(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	sf, ok := file.(seekFile)
+	if !ok {
+		file.Close()
+		return nil, &fs.PathError{Op: "seek", Path: name, Err: errors.New("not implemented")}
+	}
+	return sf, nil
+}
+
+// artistOf returns the name of the artist of the track at path: the
+// folder holding it in the Music folder.
+func (l *Library) artistOf(path string) string {
+	_, name, err := l.folder(path)
+	if err != nil {
+		return ""
+	}
+	artist, _, _ := strings.Cut(name, "/")
+	return artist
+}
+
+// folder returns the Music folder of l which holds the file at path,
+// and the file's name in that folder's fsys.
+func (l *Library) folder(path string) (musicFolder, string, error) {
+	var roots []string
+	for _, f := range l.folders {
+		if name, err := f.name(path); err == nil {
+			return f, name, nil
+		}
+		roots = append(roots, f.root)
+	}
+	return musicFolder{}, "", newError("%s isn't in the music folder %s", path, strings.Join(roots, " or "))
+}
+
+// readChunk is how many entries of a folder readEntries reads at once.
+const readChunk = 256
+
+// readEntries reads the FileInfos of the entries of the named folder,
+// a chunk at a time, following symbolic links. Entries which can't be
+// read are logged and skipped, as is the rest of the folder if reading
+// it fails part way through, so that one bad file doesn't hide the good
+// ones. Broken links are skipped quietly. It's only an error if the
+// folder can't be read at all.
+func (f musicFolder) readEntries(name string) ([]os.FileInfo, error) {
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dir, ok := file.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not implemented")}
+	}
+
+	fis := []os.FileInfo{}
+	for read := 0; ; {
+		entries, err := dir.ReadDir(readChunk)
+		read += len(entries)
+		for _, e := range entries {
+			fi, err := e.Info()
+			if err != nil {
+				logs.Error(newError("Skipping %s: %v", filepath.Join(f.root, filepath.FromSlash(name), e.Name()), err))
+				continue
+			}
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				// Follow the link, quietly skipping it if it's broken.
+				if fi, err = fs.Stat(f.fsys, path.Join(name, e.Name())); err != nil {
+					continue
+				}
+			}
+			fis = append(fis, fi)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if read == 0 {
+				return nil, err
+			}
+			logs.Error(newError("Skipping the rest of %s: %v", filepath.Join(f.root, filepath.FromSlash(name)), err))
+			break
+		}
+	}
+	return fis, nil
+}
+
+// name returns the name in f.fsys of the file at path.
+func (f musicFolder) name(path string) (string, error) {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if !fs.ValidPath(rel) {
+		return "", newError("%s isn't in the music folder %s", path, f.root)
+	}
+	return rel, nil
+}
@@ -0,0 +1,786 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// dirLibrary returns a Library of the Music folder at root, on disk.
+func dirLibrary(root string) *Library {
+	return NewLibrary(os.DirFS(root), root)
+}
+
+// mapLibrary returns a Library containing the given files, which are
+// paths relative to its root, without touching the disk.
+func mapLibrary(files ...string) *Library {
+	fsys := fstest.MapFS{}
+	for _, f := range files {
+		fsys[f] = &fstest.MapFile{}
+	}
+	return NewLibrary(fsys, filepath.FromSlash("/music"))
+}
+
+// A countingFS counts the folders read from it.
+type countingFS struct {
+	fs.FS
+	reads atomic.Int64
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.reads.Add(1)
+	return c.FS.Open(name)
+}
+
+// A slowFS takes a while to read each folder, like a spinning disk
+// or a network mount.
+type slowFS struct {
+	fs.FS
+}
+
+func (s slowFS) Open(name string) (fs.File, error) {
+	time.Sleep(200 * time.Microsecond)
+	return s.FS.Open(name)
+}
+
+// A brokenFS fails to read one folder.
+type brokenFS struct {
+	fs.FS
+	broken string
+}
+
+func (b brokenFS) Open(name string) (fs.File, error) {
+	if name == b.broken {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return b.FS.Open(name)
+}
+
+// A flakyFS can't get the info of one file, as if it were deleted
+// while its folder was being read.
+type flakyFS struct {
+	fs.FS
+	flaky string
+}
+
+func (f flakyFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return flakyDir{file.(fs.ReadDirFile), name, f.flaky}, nil
+}
+
+type flakyDir struct {
+	fs.ReadDirFile
+	name, flaky string
+}
+
+func (d flakyDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := d.ReadDirFile.ReadDir(n)
+	for i, e := range entries {
+		if path.Join(d.name, e.Name()) == d.flaky {
+			entries[i] = flakyEntry{e}
+		}
+	}
+	return entries, err
+}
+
+type flakyEntry struct {
+	fs.DirEntry
+}
+
+func (e flakyEntry) Info() (fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "lstat", Path: e.Name(), Err: fs.ErrNotExist}
+}
+
+// synthFS returns a file system with the given numbers of artists,
+// albums per artist, and tracks per album.
+func synthFS(artists, albums, tracks int) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for i := 0; i < artists; i++ {
+		for j := 0; j < albums; j++ {
+			for k := 0; k < tracks; k++ {
+				fsys[fmt.Sprintf("Artist %d/Album %d-%d/%d Track.ogg", i, i, j, k)] = &fstest.MapFile{}
+			}
+		}
+	}
+	return fsys
+}
+
+func TestLibraryLocate(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Pinkerton/cover.jpg",
+	)
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{l.root()}, elem...)...)
+	}
+
+	tests := []struct {
+		locate  func(string) (Music, error)
+		pattern string
+		path    string
+	}{
+		{l.LocateArtist, "weezer", path("Weezer")},
+		{l.LocateArtist, "pix", path("Pixies")},
+		{l.LocateArtist, "doolittle", ""},
+		{l.LocateAlbum, "surfer", path("Pixies", "Surfer Rosa")},
+		{l.LocateAlbum, "pinkerton", path("Weezer", "Pinkerton")},
+		{l.LocateTrack, "tame", path("Pixies", "Doolittle", "2 Tame.ogg")},
+		{l.LocateTrack, "cover", ""},
+	}
+	for _, test := range tests {
+		m, err := test.locate(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.path == "" {
+			if m != nil {
+				t.Errorf("%q shouldn't match anything, but matched %s", test.pattern, m.Path())
+			}
+			continue
+		}
+		if m == nil || m.Path() != test.path {
+			t.Errorf("%q should match %s, but got %v", test.pattern, test.path, m)
+		}
+	}
+}
+
+func TestLibraryArtistAndAlbum(t *testing.T) {
+	l := mapLibrary(
+		"The Beatles/Abbey Road/1 Come Together.ogg",
+		"The Beatles/Let It Be/1 Two of Us.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Green/1 Don't Let Go.ogg",
+		"Joni Mitchell/Blue/1 All I Want.ogg",
+		"Blue Oyster Cult/Agents of Fortune/1 This Ain't the Summer of Love.ogg",
+	)
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{l.root()}, elem...)...)
+	}
+
+	tests := []struct {
+		pattern string
+		path    string
+	}{
+		{"beatles abbey", path("The Beatles", "Abbey Road")},
+		{"weezer blue", path("Weezer", "Blue")},
+		{"joni mitchell blue", path("Joni Mitchell", "Blue")},
+		{"mitchell blue", path("Joni Mitchell", "Blue")},
+		{"weezer green", path("Weezer", "Green")},
+		// Albums matching by their names alone still come first.
+		{"blue", path("Joni Mitchell", "Blue")},
+		{"blue agents", ""},
+		{"weezer abbey", ""},
+	}
+	for _, test := range tests {
+		m, err := l.LocateAlbum(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.path == "" {
+			if m != nil {
+				t.Errorf("%q shouldn't match anything, but matched %s", test.pattern, m.Path())
+			}
+			continue
+		}
+		if m == nil || m.Path() != test.path {
+			t.Errorf("%q should match %s, but got %v", test.pattern, test.path, m)
+		}
+	}
+}
+
+func TestLibrarySearch(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Weezer/Weezer/1 My Name Is Jonas.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Pinkerton/Pinkerton.ogg",
+	)
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{l.root()}, elem...)...)
+	}
+
+	tests := []struct {
+		pattern string
+		want    Music
+	}{
+		{"pixies", newArtist(l, path("Pixies"))},
+		{"doolittle", newAlbum(l, path("Pixies", "Doolittle"), false)},
+		{"debaser", newTrack(l, path("Pixies", "Doolittle", "1 Debaser.ogg"))},
+		{"tired of", newTrack(l, path("Weezer", "Pinkerton", "1 Tired of Sex.ogg"))},
+		// Ties go to the more specific.
+		{"weezer", newAlbum(l, path("Weezer", "Weezer"), false)},
+		{"pinkerton", newTrack(l, path("Weezer", "Pinkerton", "Pinkerton.ogg"))},
+		{"nothing", nil},
+	}
+	for _, test := range tests {
+		m, err := l.Search(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, test.want) {
+			t.Errorf("%q should find %#v, but got %#v", test.pattern, test.want, m)
+		}
+	}
+}
+
+func TestLibraryMatches(t *testing.T) {
+	l := mapLibrary(
+		"Ween/The Mollusk/1 I'm Dancing in the Show Tonight.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Pixies/Wee/1 Debaser.ogg",
+		"Vampire Weekend/Contra/1 Horchata.ogg",
+	)
+	l.Add(fstest.MapFS{
+		"Weezer/Green/1 Don't Let Go.ogg": &fstest.MapFile{},
+	}, filepath.FromSlash("/more"))
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{l.root()}, elem...)...)
+	}
+
+	all := []Match{
+		{"Wee", "album", path("Pixies", "Wee"), 0},
+		{"Ween", "artist", path("Ween"), 1},
+		{"Weezer", "artist", path("Weezer"), 3},
+		{"Vampire Weekend", "artist", path("Vampire Weekend"), 15},
+	}
+	for _, k := range []int{0, 2, 4, 10} {
+		ms, err := l.Matches("wee", k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := all
+		if k > 0 && k < len(all) {
+			want = all[:k]
+		}
+		if !reflect.DeepEqual(ms, want) {
+			t.Errorf("Expected the %d best matches to be %v, but got %v", k, want, ms)
+		}
+	}
+
+	// Albums of the same name by different artists are all there.
+	l = mapLibrary(
+		"Pixies/Greatest Hits/1 Here Comes Your Man.ogg",
+		"Weezer/Greatest Hits/1 Buddy Holly.ogg",
+	)
+	l.Add(fstest.MapFS{
+		"Weezer/Greatest Hits/1 Buddy Holly.ogg": &fstest.MapFile{},
+	}, filepath.FromSlash("/more"))
+	ms, err := l.Matches("greatest hits", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Match{
+		{"Greatest Hits", "album", path("Pixies", "Greatest Hits"), 0},
+		{"Greatest Hits", "album", path("Weezer", "Greatest Hits"), 0},
+	}
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("Expected the matches %v, but got %v", want, ms)
+	}
+
+	ms, err = l.Matches("nothing", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 0 {
+		t.Errorf("Expected no matches, but got %v", ms)
+	}
+}
+
+func TestLibraryTracks(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/cover.jpg",
+	)
+	m, err := l.LocateAlbum("doolittle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracks, err := m.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(l.root(), "Pixies", "Doolittle", "1 Debaser.ogg"),
+		filepath.Join(l.root(), "Pixies", "Doolittle", "2 Tame.ogg"),
+	}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Expected the tracks %q, but got %q", want, tracks)
+	}
+}
+
+func TestLibraryOutside(t *testing.T) {
+	l := mapLibrary("Pixies/Doolittle/1 Debaser.ogg")
+	if _, err := l.subDirs(filepath.Dir(l.root())); err == nil {
+		t.Error("Expected an error reading a folder outside the library")
+	}
+	if _, err := l.subDirs(filepath.Join(l.root(), "Weezer")); err == nil {
+		t.Error("Expected an error reading a missing folder")
+	}
+}
+
+func TestLibraryFolders(t *testing.T) {
+	lossless := filepath.FromSlash("/lossless")
+	lossy := filepath.FromSlash("/lossy")
+	l := NewLibrary(fstest.MapFS{
+		"Pixies/Doolittle/1 Debaser.flac":     &fstest.MapFile{},
+		"Ween/The Mollusk/1 I'm Dancing.flac": &fstest.MapFile{},
+	}, lossless)
+	l.Add(fstest.MapFS{
+		"Pixies/Surfer Rosa/1 Bone Machine.mp3": &fstest.MapFile{},
+		"Weezer/Pinkerton/1 Tired of Sex.mp3":   &fstest.MapFile{},
+	}, lossy)
+
+	tests := []struct {
+		matches func(string) ([]string, error)
+		pattern string
+		paths   []string
+	}{
+		{l.artistMatches, "pixies", []string{
+			filepath.Join(lossless, "Pixies"),
+			filepath.Join(lossy, "Pixies"),
+		}},
+		{l.artistMatches, "wee", []string{
+			filepath.Join(lossless, "Ween"),
+			filepath.Join(lossy, "Weezer"),
+		}},
+		{l.albumMatches, "surfer", []string{filepath.Join(lossy, "Pixies", "Surfer Rosa")}},
+		{l.albumMatches, "mollusk", []string{filepath.Join(lossless, "Ween", "The Mollusk")}},
+		{l.trackMatches, "debaser", []string{filepath.Join(lossless, "Pixies", "Doolittle", "1 Debaser.flac")}},
+		{l.trackMatches, "tired", []string{filepath.Join(lossy, "Weezer", "Pinkerton", "1 Tired of Sex.mp3")}},
+	}
+	for _, test := range tests {
+		paths, err := test.matches(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("%q should match %q, but got %q", test.pattern, test.paths, paths)
+		}
+	}
+
+	tracks, err := l.All(false).Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 4 {
+		t.Errorf("Expected all 4 tracks from both folders, but got %q", tracks)
+	}
+
+	if _, err := l.subDirs(filepath.FromSlash("/elsewhere")); err == nil {
+		t.Error("Expected an error reading a folder outside the library")
+	}
+}
+
+func TestLibraryCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Pixies/Doolittle/1 Debaser.ogg":        &fstest.MapFile{},
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg": &fstest.MapFile{},
+		"Weezer/Pinkerton/1 Tired of Sex.ogg":   &fstest.MapFile{},
+	}
+	cfs := &countingFS{FS: fsys}
+	l := NewLibrary(cfs, filepath.FromSlash("/music"))
+
+	m, err := l.LocateAlbum("doolittle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || filepath.Base(m.Path()) != "Doolittle" {
+		t.Fatal("Expected to find Doolittle, but got", m)
+	}
+	reads := cfs.reads.Load()
+	if reads != 3 {
+		t.Error("Expected to read the library and its 2 artists, but read", reads, "folders")
+	}
+
+	m, err = l.LocateAlbum("pinkerton")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || filepath.Base(m.Path()) != "Pinkerton" {
+		t.Fatal("Expected to find Pinkerton, but got", m)
+	}
+	if n := cfs.reads.Load(); n != reads {
+		t.Error("Expected a second locate to read nothing, but it read", n-reads, "folders")
+	}
+
+	fsys["Pixies/Bossanova/1 Cecilia Ann.ogg"] = &fstest.MapFile{}
+	if m, _ := l.LocateAlbum("bossanova"); m != nil {
+		t.Error("Expected the cached library not to see the new album, but got", m.Path())
+	}
+	l.Refresh()
+	m, err = l.LocateAlbum("bossanova")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || filepath.Base(m.Path()) != "Bossanova" {
+		t.Error("Expected to find Bossanova after refreshing, but got", m)
+	}
+}
+
+func TestLibraryFlakyEntry(t *testing.T) {
+	fsys := flakyFS{fstest.MapFS{
+		"Pixies/Doolittle/1 Debaser.ogg":            &fstest.MapFile{},
+		"Pixies/Doolittle/2 Tame.ogg":               &fstest.MapFile{},
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg": &fstest.MapFile{},
+	}, "Pixies/Doolittle/2 Tame.ogg"}
+	l := NewLibrary(fsys, filepath.FromSlash("/music"))
+
+	defer func(l *logger) { logs = l }(logs)
+	var errs bytes.Buffer
+	logs = &logger{Out: io.Discard, Err: &errs}
+
+	m, err := l.LocateAlbum("doolittle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil {
+		t.Fatal("Expected to find Doolittle in spite of its flaky track")
+	}
+	tracks, err := m.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(l.root(), "Pixies", "Doolittle", "1 Debaser.ogg"),
+		filepath.Join(l.root(), "Pixies", "Doolittle", "3 Wave of Mutilation.ogg"),
+	}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Expected the readable tracks %q, but got %q", want, tracks)
+	}
+	if !strings.Contains(errs.String(), "2 Tame.ogg") {
+		t.Errorf("Expected the flaky track to be logged, but got %q", errs.String())
+	}
+
+	l = NewLibrary(brokenFS{fsys, "Pixies/Doolittle"}, filepath.FromSlash("/music"))
+	if _, err := l.subFiles(filepath.Join(l.root(), "Pixies", "Doolittle")); err == nil {
+		t.Error("Expected an error for a folder which can't be opened")
+	}
+}
+
+func TestLibraryHidden(t *testing.T) {
+	l := mapLibrary(
+		".hidden/Secret/1 Hush.ogg",
+		"Pixies/.hidden/1 Hush.ogg",
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/._1 Debaser.ogg",
+		"Pixies/Doolittle/.hidden.ogg",
+		"Pixies/Doolittle/Thumbs.db",
+		"Pixies/Doolittle/desktop.ini",
+		"Pixies/$RECYCLE.BIN/1 Gone.ogg",
+		"Thumbs.db/Album/1 Track.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+	doolittle := filepath.Join(pixies, "Doolittle")
+
+	tests := []struct {
+		contents func(string) ([]os.FileInfo, error)
+		path     string
+		hidden   []string
+		all      []string
+	}{
+		{l.subDirs, l.root(), []string{"Pixies"}, []string{".hidden", "Pixies", "Thumbs.db"}},
+		{l.subDirs, pixies, []string{"Doolittle"}, []string{"$RECYCLE.BIN", ".hidden", "Doolittle"}},
+		{l.subFiles, doolittle, []string{"1 Debaser.ogg"}, []string{"._1 Debaser.ogg", ".hidden.ogg", "1 Debaser.ogg"}},
+	}
+	for _, test := range tests {
+		fis, err := test.contents(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(fis); !reflect.DeepEqual(got, test.hidden) {
+			t.Errorf("The contents of %s should be %q, but got %q", test.path, test.hidden, got)
+		}
+	}
+
+	defer func() { includeHidden = false }()
+	includeHidden = true
+	for _, test := range tests {
+		fis, err := test.contents(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(fis); !reflect.DeepEqual(got, test.all) {
+			t.Errorf("With -include-hidden, the contents of %s should be %q, but got %q", test.path, test.all, got)
+		}
+	}
+}
+
+func TestLibrarySymlinks(t *testing.T) {
+	root := mkLibrary(t, "Pixies/Doolittle/1 Debaser.ogg")
+	drive := mkLibrary(t,
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Surfer Rosa/1 Bone Machine.ogg",
+	)
+	links := map[string]string{
+		filepath.Join(root, "Weezer"):                            filepath.Join(drive, "Weezer"),
+		filepath.Join(root, "Pixies", "Surfer Rosa"):             filepath.Join(drive, "Surfer Rosa"),
+		filepath.Join(root, "Pixies", "Bossanova"):               filepath.Join(drive, "Bossanova"),
+		filepath.Join(root, "Pixies", "Doolittle", "2 Tame.ogg"): filepath.Join(drive, "2 Tame.ogg"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip("Can't make symbolic links:", err)
+		}
+	}
+
+	l := dirLibrary(root)
+	tests := []struct {
+		contents func(string) ([]os.FileInfo, error)
+		path     string
+		want     []string
+	}{
+		{l.subDirs, root, []string{"Pixies", "Weezer"}},
+		{l.subDirs, filepath.Join(root, "Pixies"), []string{"Doolittle", "Surfer Rosa"}},
+		{l.subFiles, filepath.Join(root, "Pixies", "Doolittle"), []string{"1 Debaser.ogg"}},
+	}
+	for _, test := range tests {
+		fis, err := test.contents(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(fis); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("The contents of %s should be %q, but got %q", test.path, test.want, got)
+		}
+	}
+
+	m, err := l.LocateTrack("tired of sex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "Weezer", "Pinkerton", "1 Tired of Sex.ogg"); m == nil || m.Path() != want {
+		t.Errorf("Expected to find %s through the link, but got %v", want, m)
+	}
+}
+
+func TestLibraryNoMusic(t *testing.T) {
+	music := fstest.MapFS{"Music/cover.jpg": &fstest.MapFile{}}
+	empty, err := fs.Sub(music, "Music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := fs.Sub(music, "Musik")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fsys fs.FS
+		err  string
+	}{
+		{empty, "No music found in"},
+		{missing, "There's no music folder at"},
+	}
+	for _, test := range tests {
+		l := NewLibrary(test.fsys, filepath.FromSlash("/music"))
+		locates := []func(string) (Music, error){l.LocateArtist, l.LocateAlbum, l.LocateTrack}
+		for _, locate := range locates {
+			_, err := locate("pixies")
+			if _, ok := err.(*Error); !ok || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Expected an error starting %q, but got %v", test.err, err)
+			}
+		}
+		if _, err := l.All(false).Tracks(""); err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Expected an error starting %q for everything, but got %v", test.err, err)
+		}
+	}
+}
+
+func BenchmarkLocateAlbum(b *testing.B) {
+	l := NewLibrary(synthFS(200, 5, 10), filepath.FromSlash("/music"))
+	for i := 0; i < b.N; i++ {
+		if _, err := l.LocateAlbum("album 150-3"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLocateAlbumUncached(b *testing.B) {
+	l := NewLibrary(synthFS(200, 5, 10), filepath.FromSlash("/music"))
+	for i := 0; i < b.N; i++ {
+		l.Refresh()
+		if _, err := l.LocateAlbum("album 150-3"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// serialAlbumMatches is albumMatches, reading one artist at a time.
+func serialAlbumMatches(l *Library, pattern string) ([]string, error) {
+	artists, err := l.subDirs(l.root())
+	if err != nil {
+		return nil, err
+	}
+
+	allalbums := []os.FileInfo{}
+	allnames := []string{}
+	for _, artist := range artists {
+		aloc := filepath.Join(l.root(), artist.Name())
+		albums, err := l.subDirs(aloc)
+		if err != nil {
+			return nil, err
+		}
+		allalbums = append(allalbums, albums...)
+		for _, album := range albums {
+			allnames = append(allnames, filepath.Join(aloc, album.Name()))
+		}
+	}
+
+	var paths []string
+	for _, i := range findAll(allalbums, pattern) {
+		paths = append(paths, allnames[i])
+	}
+	return paths, nil
+}
+
+func TestAlbumMatchesConcurrent(t *testing.T) {
+	l := NewLibrary(synthFS(100, 3, 1), filepath.FromSlash("/music"))
+	for _, pattern := range []string{"album", "album 4", "album 42-1", "", "nothing"} {
+		want, err := serialAlbumMatches(l, pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			l.Refresh()
+			got, err := l.albumMatches(pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("albumMatches(%q) should be %q, but got %q", pattern, want, got)
+			}
+		}
+	}
+
+	l = NewLibrary(brokenFS{synthFS(100, 3, 1), "Artist 57"}, filepath.FromSlash("/music"))
+	if _, err := l.albumMatches("album"); err == nil {
+		t.Error("Expected an error when an artist's folder can't be read")
+	}
+}
+
+func BenchmarkAlbumMatchesSerial(b *testing.B) {
+	l := NewLibrary(slowFS{synthFS(200, 3, 1)}, filepath.FromSlash("/music"))
+	for i := 0; i < b.N; i++ {
+		l.Refresh()
+		if _, err := serialAlbumMatches(l, "album 150-3"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAlbumMatchesConcurrent(b *testing.B) {
+	l := NewLibrary(slowFS{synthFS(200, 3, 1)}, filepath.FromSlash("/music"))
+	for i := 0; i < b.N; i++ {
+		l.Refresh()
+		if _, err := l.albumMatches("album 150-3"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLibraryNewest(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2012, 6, d, 12, 0, 0, 0, time.UTC) }
+	album := func(d int) *fstest.MapFile { return &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: day(d)} }
+	track := &fstest.MapFile{}
+
+	tests := []struct {
+		fsys fstest.MapFS
+		want string
+	}{
+		{fstest.MapFS{
+			"Pixies/Doolittle":                      album(3),
+			"Pixies/Doolittle/1 Debaser.ogg":        track,
+			"Pixies/Surfer Rosa":                    album(9),
+			"Pixies/Surfer Rosa/1 Bone Machine.ogg": track,
+			"Weezer/Blue":                           album(5),
+			"Weezer/Blue/1 My Name Is Jonas.ogg":    track,
+		}, "Pixies/Surfer Rosa"},
+		{fstest.MapFS{
+			"Pixies/Doolittle":                    album(3),
+			"Pixies/Doolittle/1 Debaser.ogg":      track,
+			"Weezer/Pinkerton":                    album(7),
+			"Weezer/Pinkerton/1 Tired of Sex.ogg": track,
+			"Weezer/Blue":                         album(7),
+			"Weezer/Blue/1 My Name Is Jonas.ogg":  track,
+		}, "Weezer/Blue"},
+	}
+	for _, test := range tests {
+		l := NewLibrary(test.fsys, filepath.FromSlash("/music"))
+		m, err := l.newestAlbum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(l.root(), filepath.FromSlash(test.want)); m.Path() != want {
+			t.Errorf("Expected the newest album to be %s, but got %s", want, m.Path())
+		}
+	}
+
+	if _, err := mapLibrary("The Who/.keep").newestAlbum(); err == nil {
+		t.Error("Expected an error for a library without albums")
+	}
+}
+
+func TestLibraryRandom(t *testing.T) {
+	l := mapLibrary(
+		"Pavement/Slanted and Enchanted/1 Summer Babe.ogg",
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"The Who/.keep",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+	)
+	defer func(s int64) { shuffleSeed = s }(shuffleSeed)
+
+	albums, artists := map[string]bool{}, map[string]bool{}
+	for s := int64(1); s <= 20; s++ {
+		shuffleSeed = s
+		al, err := l.randomAlbum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := l.randomAlbum()
+		if al.Path() != again.Path() {
+			t.Fatalf("The same seed picked %s and %s", al.Path(), again.Path())
+		}
+		albums[filepath.Base(al.Path())] = true
+
+		ar, err := l.randomArtist()
+		if err != nil {
+			t.Fatal(err)
+		}
+		artists[filepath.Base(ar.Path())] = true
+	}
+	if len(albums) < 3 || albums["The Who"] {
+		t.Errorf("Expected a variety of albums to be picked, but got %v", albums)
+	}
+	if len(artists) < 3 {
+		t.Errorf("Expected a variety of artists to be picked, but got %v", artists)
+	}
+
+	shuffleSeed = 1
+	al, _ := l.randomAlbum()
+	ar, _ := l.randomArtist()
+	if got := [2]string{filepath.Base(al.Path()), filepath.Base(ar.Path())}; got != [2]string{"Doolittle", "Weezer"} {
+		t.Errorf("Expected seed 1 to pick Doolittle and Weezer, but it picked %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// listJSON is true iff Music is listed as a JSON document,
+// rather than as lines of text.
+var listJSON = false
+
+// An artistListing is the JSON listing of an artist.
+type artistListing struct {
+	Artist string         `json:"artist"`
+	Path   string         `json:"path"`
+	Albums []albumListing `json:"albums"`
+}
+
+// An albumListing is the JSON listing of an album.
+type albumListing struct {
+	Artist string         `json:"artist"`
+	Album  string         `json:"album"`
+	Path   string         `json:"path"`
+	Tracks []trackListing `json:"tracks"`
+}
+
+// A trackListing is the JSON listing of a track.
+type trackListing struct {
+	Track string `json:"track"`
+	Path  string `json:"path"`
+}
+
+// writeJSON writes v to w as an indented JSON document.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// writePaths writes the absolute path of each track of m,
+// from start, to w, one per line.
+func writePaths(w io.Writer, m Music, start string) error {
+	paths, err := m.Tracks(start)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, abs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listArtist returns the listing of the artist's albums, from start.
+func listArtist(a *artist, start string) (artistListing, error) {
+	path, err := filepath.Abs(a.Path())
+	if err != nil {
+		return artistListing{}, err
+	}
+	l := artistListing{Artist: filepath.Base(a.Path()), Path: path, Albums: []albumListing{}}
+	err = a.doPerAlbum(start, func(fi os.FileInfo, path string) error {
+		al, err := listAlbum(&album{lib: a.lib, path: path}, fi.Name(), "")
+		al.Artist = l.Artist
+		l.Albums = append(l.Albums, al)
+		return err
+	})
+	return l, err
+}
+
+// listAlbum returns the listing of the album, named name, from start.
+func listAlbum(a *album, name, start string) (albumListing, error) {
+	tracks, err := a.Tracks(start)
+	if err != nil {
+		return albumListing{}, err
+	}
+	ts, err := listTracks(tracks)
+	if err != nil {
+		return albumListing{}, err
+	}
+	abs, err := filepath.Abs(a.Path())
+	if err != nil {
+		return albumListing{}, err
+	}
+	return albumListing{
+		Artist: filepath.Base(filepath.Dir(a.Path())),
+		Album:  name,
+		Path:   abs,
+		Tracks: ts,
+	}, nil
+}
+
+// listTracks returns the listings of the tracks at paths.
+func listTracks(paths []string) ([]trackListing, error) {
+	ts := make([]trackListing, len(paths))
+	for i, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		ts[i] = trackListing{trimExt(filepath.Base(p)), abs}
+	}
+	return ts, nil
+}
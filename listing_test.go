@@ -0,0 +1,136 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListJSON(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/cover.jpg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+	)
+	lib := dirLibrary(root)
+	pixies := filepath.Join(root, "Pixies")
+	doolittle := filepath.Join(pixies, "Doolittle")
+	surfer := filepath.Join(pixies, "Surfer Rosa")
+
+	defer func() { listJSON, shuffleAlbums = false, true }()
+	listJSON = true
+	shuffleAlbums = false
+
+	doolittleListing := albumListing{
+		Artist: "Pixies",
+		Album:  "Doolittle",
+		Path:   doolittle,
+		Tracks: []trackListing{
+			{"1 Debaser", filepath.Join(doolittle, "1 Debaser.ogg")},
+			{"2 Tame", filepath.Join(doolittle, "2 Tame.ogg")},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := newAlbum(lib, doolittle, false).List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	var al albumListing
+	if err := json.Unmarshal(buf.Bytes(), &al); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(al, doolittleListing) {
+		t.Errorf("Expected the album listing %+v, but got %+v", doolittleListing, al)
+	}
+
+	buf.Reset()
+	if err := newArtist(lib, pixies).List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	var ar artistListing
+	if err := json.Unmarshal(buf.Bytes(), &ar); err != nil {
+		t.Fatal(err)
+	}
+	want := artistListing{
+		Artist: "Pixies",
+		Path:   pixies,
+		Albums: []albumListing{
+			doolittleListing,
+			{
+				Artist: "Pixies",
+				Album:  "Surfer Rosa",
+				Path:   surfer,
+				Tracks: []trackListing{
+					{"1 Bone Machine", filepath.Join(surfer, "1 Bone Machine.ogg")},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(ar, want) {
+		t.Errorf("Expected the artist listing %+v, but got %+v", want, ar)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"artist", "path", "albums"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("Expected the field %q in %s", f, buf.String())
+		}
+	}
+}
+
+func TestWritePaths(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/cover.jpg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+	)
+	lib := dirLibrary(root)
+	pixies := filepath.Join(root, "Pixies")
+	doolittle := filepath.Join(pixies, "Doolittle")
+	surfer := filepath.Join(pixies, "Surfer Rosa")
+
+	defer func() { shuffleAlbums = true }()
+	shuffleAlbums = false
+
+	tests := []struct {
+		m     Music
+		start string
+		want  []string
+	}{
+		{newAlbum(lib, doolittle, false), "", []string{
+			filepath.Join(doolittle, "1 Debaser.ogg"),
+			filepath.Join(doolittle, "2 Tame.ogg"),
+		}},
+		{newAlbum(lib, doolittle, false), "tame", []string{
+			filepath.Join(doolittle, "2 Tame.ogg"),
+		}},
+		{newArtist(lib, pixies), "", []string{
+			filepath.Join(doolittle, "1 Debaser.ogg"),
+			filepath.Join(doolittle, "2 Tame.ogg"),
+			filepath.Join(surfer, "1 Bone Machine.ogg"),
+		}},
+		{newTrack(lib, filepath.Join(surfer, "1 Bone Machine.ogg")), "", []string{
+			filepath.Join(surfer, "1 Bone Machine.ogg"),
+		}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writePaths(&buf, test.m, test.start); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Join(test.want, "\n") + "\n"
+		if buf.String() != want {
+			t.Errorf("Expected the paths of %s to be\n%s\nbut got\n%s", test.m.Path(), want, buf.String())
+		}
+	}
+}
@@ -3,203 +3,334 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
+	"bufio"
+	"cmp"
+	"context"
 	"fmt"
-	"io/ioutil"
+	"hash/fnv"
+	"io"
 	"math/rand"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
-	"unicode"
-
-	"github.com/mccoyst/vorbis"
-	"github.com/hajimehoshi/oto"
 )
 
 // LocateArtist returns a Music object, or an error if none
 // can be found which match the given pattern.
 //
-// Patterns are not patterns in the sense of, say, a regular expression,
-// but are literal text which is used to make a best-guess match for
-// artists, albums, and songs.
+// Patterns are not patterns in the sense of, say, a regular expression
+// (unless matchRegexp is set), but are literal text which is used to
+// make a best-guess match for artists, albums, and songs.
 func LocateArtist(pattern string) (Music, error) {
-	mloc, err := musicloc()
+	l, err := DefaultLibrary()
 	if err != nil {
 		return nil, err
 	}
-	artists, err := subDirs(mloc)
-	if err != nil {
-		return nil, err
-	}
-
-	i := find(artists, pattern)
-	if i < 0 {
-		return nil, nil
-	}
-
-	loc := filepath.Join(mloc, artists[i].Name())
-	return newArtist(loc), nil
+	return l.LocateArtist(pattern)
 }
 
 // LocateAlbum returns a Music object, or an error if none
 // can be found which match the given pattern.
 //
-// Patterns are not patterns in the sense of, say, a regular expression,
-// but are literal text which is used to make a best-guess match for
-// artists, albums, and songs.
+// Patterns are not patterns in the sense of, say, a regular expression
+// (unless matchRegexp is set), but are literal text which is used to
+// make a best-guess match for artists, albums, and songs.
 func LocateAlbum(pattern string) (Music, error) {
-	mloc, err := musicloc()
+	l, err := DefaultLibrary()
 	if err != nil {
 		return nil, err
 	}
-	artists, err := subDirs(mloc)
+	return l.LocateAlbum(pattern)
+}
+
+// LocateTrack returns a Music object for the single track which
+// best matches the given pattern, or an error if none can be found.
+// Tracks are matched by their file names, without extensions.
+//
+// Patterns are not patterns in the sense of, say, a regular expression
+// (unless matchRegexp is set), but are literal text which is used to
+// make a best-guess match for artists, albums, and songs.
+func LocateTrack(pattern string) (Music, error) {
+	l, err := DefaultLibrary()
 	if err != nil {
 		return nil, err
 	}
+	return l.LocateTrack(pattern)
+}
 
-	allalbums := []os.FileInfo{}
-	allnames := []string{}
-	for _, artist := range artists {
-		aloc := filepath.Join(mloc, artist.Name())
-		albums, err := subDirs(aloc)
+// LocateLibrary returns a Music object for every album in the
+// Music folder, or an error if the folder can't be read. If mix is
+// true, the tracks of every album are shuffled together.
+func LocateLibrary(mix bool) (Music, error) {
+	l, err := DefaultLibrary()
+	if err != nil {
+		return nil, err
+	}
+	return l.All(mix), nil
+}
+
+// musiclocs returns the paths to the Music folders, or an error if any
+// doesn't exist. The folders are given by the -dir flag, which may be
+// repeated, or else the SPLAY_MUSIC_DIR environment variable, which may
+// be a list separated like $PATH, or else it is the current user's
+// Music folder: XDG_MUSIC_DIR if xdg-user-dirs says where that is, and
+// ~/Music otherwise.
+func musiclocs() ([]string, error) {
+	locs := []string(musicdirs)
+	if len(locs) == 0 {
+		for _, loc := range filepath.SplitList(os.Getenv("SPLAY_MUSIC_DIR")) {
+			if loc != "" {
+				locs = append(locs, loc)
+			}
+		}
+	}
+	if len(locs) == 0 {
+		usr, err := user.Current()
 		if err != nil {
 			return nil, err
 		}
-
-		allalbums = append(allalbums, albums...)
-
-		for _, album := range albums {
-			allnames = append(allnames, filepath.Join(aloc, album.Name()))
-		}
+		locs = []string{userMusicDir(usr.HomeDir)}
 	}
 
-	i := find(allalbums, pattern)
-	if i < 0 {
-		return nil, nil
+	for _, loc := range locs {
+		fi, err := os.Stat(loc)
+		if os.IsNotExist(err) {
+			return nil, newError("There's no music folder at %s. Set SPLAY_MUSIC_DIR, or use -dir, to say where your music is.", loc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, newError("The music folder %s isn't a folder", loc)
+		}
 	}
-
-	return newAlbum(allnames[i], false), nil
+	return locs, nil
 }
 
-// musicloc returns the path to the current user's Music folder,
-// or an error if it doesn't exist.
-func musicloc() (string, error) {
-	usr, err := user.Current()
-	if err != nil {
-		return "", err
+// userMusicDir returns the Music folder named by the xdg-user-dirs
+// config of the user with the given home directory, if it exists,
+// or else home/Music.
+func userMusicDir(home string) string {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(home, ".config")
 	}
-	return filepath.Join(usr.HomeDir, "Music"), nil
-}
 
-// subFiles returns a list of FileInfos for all files under path.
-func subFiles(path string) ([]os.FileInfo, error) {
-	return contents(path, func(f os.FileInfo) bool {
-		return !f.IsDir() && f.Name() != ".DS_Store"
-	})
-}
-
-// subDirs returns a list of FileInfos for all directories under path.
-func subDirs(path string) ([]os.FileInfo, error) {
-	return contents(path, func(f os.FileInfo) bool {
-		return f.IsDir()
-	})
-}
-
-// contents returns a list of FileInfos for all acceptable
-// entries under the given path.
-func contents(path string, accept func(os.FileInfo) bool) ([]os.FileInfo, error) {
-	allsubs, err := ioutil.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
-
-	subs := make([]os.FileInfo, 0, len(allsubs))
-	for _, f := range allsubs {
-		if accept(f) {
-			subs = append(subs, f)
+	if f, err := os.Open(filepath.Join(config, "user-dirs.dirs")); err == nil {
+		defer f.Close()
+		loc := xdgMusicDir(f, home)
+		if fi, err := os.Stat(loc); loc != "" && err == nil && fi.IsDir() {
+			return loc
 		}
 	}
-
-	return subs, nil
+	return filepath.Join(home, "Music")
 }
 
-// match returns a non-negative score iff s fits the pattern, a negative value
-// otherwise. One score is better than another if it has a lower value.
-func match(pattern, s string) int {
-	s = clean(strings.ToLower(s))
-	pattern = clean(strings.ToLower(pattern))
-	if !strings.Contains(s, pattern) {
-		return -1
-	}
-	d := len(s) - len(pattern)
-	if d < 0 {
-		return -d
+// xdgMusicDir returns the XDG_MUSIC_DIR entry of a user-dirs.dirs file,
+// with $HOME expanded to home, or "" if there isn't one.
+func xdgMusicDir(r io.Reader, home string) string {
+	loc := ""
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(k) != "XDG_MUSIC_DIR" {
+			continue
+		}
+		v, err := parseValue(v)
+		if err != nil {
+			continue
+		}
+		if v == "$HOME" || strings.HasPrefix(v, "$HOME/") {
+			v = home + v[len("$HOME"):]
+		}
+		loc = filepath.Clean(v)
 	}
-	return d
+	return loc
 }
 
-// clean returns s without any non-alphanumeric runes.
-func clean(s string) string {
-	buf := new(bytes.Buffer)
-	for _, r := range s {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
-			_, _ = buf.WriteRune(r)
+// audioExts is the set of lower-case extensions of the files
+// which can be played.
+var audioExts = parseExts(".mp3,.flac,.m4a,.ogg,.opus,.wav,.aac")
+
+// parseExts returns the set of extensions in a comma-separated list,
+// lower-cased and with leading dots, e.g. "mp3, .FLAC" gives
+// {".mp3", ".flac"}.
+func parseExts(list string) map[string]bool {
+	exts := map[string]bool{}
+	for _, e := range strings.Split(list, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
 		}
+		exts[e] = true
 	}
-	return buf.String()
+	return exts
 }
 
 // The Music interface provides methods for identifying and playing
 // the different groupings of music (Artist, Album, Track)
 type Music interface {
 	Path() string
-	Play(string, bool) error
-	List(string) error
+	Play(context.Context, *Player, string) error
+	List(io.Writer, string) error
+
+	// Tracks returns the paths of the tracks that Play would play,
+	// in the order it would play them.
+	Tracks(string) ([]string, error)
+
+	// Kind returns what sort of Music it is: "artist", "album",
+	// "track", "playlist", "queue", or "library".
+	Kind() string
+
+	// String returns its kind and path,
+	// e.g. "album: /music/Weezer/Pinkerton".
+	String() string
+}
+
+// An AlbumLister is Music made of albums, such as an artist,
+// which can be listed without playing them.
+type AlbumLister interface {
+	Music
+	Albums() ([]Music, error)
+}
+
+// describe returns m's kind and path, for its String method.
+func describe(m Music) string {
+	return m.Kind() + ": " + m.Path()
 }
 
 // An artist represents all of the albums by an artist.
 type artist struct {
+	lib  *Library
 	path string
 }
 
-func newArtist(path string) Music {
-	return &artist{path}
+func newArtist(lib *Library, path string) Music {
+	return &artist{lib, path}
 }
 
 func (a *artist) Path() string {
 	return a.path
 }
 
-func (a *artist) Play(start string, tracks bool) error {
-	return a.doPerAlbum(start, func(album os.FileInfo) error {
-		p := filepath.Join(a.Path(), album.Name())
-		if err := newAlbum(p, true).Play("", tracks); err != nil {
+func (a *artist) Kind() string {
+	return "artist"
+}
+
+func (a *artist) String() string {
+	return describe(a)
+}
+
+func (a *artist) Play(ctx context.Context, p *Player, start string) error {
+	return a.doPerAlbum(start, func(album os.FileInfo, path string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.album(path).Play(ctx, p, ""); err != nil {
 			return err
 		}
 		return nil
 	})
 }
 
-func (a *artist) List(start string) error {
-	return a.doPerAlbum(start, func(album os.FileInfo) error {
-		fmt.Println(album.Name())
+func (a *artist) List(w io.Writer, start string) error {
+	if listJSON {
+		l, err := listArtist(a, start)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, l)
+	}
+	return a.doPerAlbum(start, func(album os.FileInfo, path string) error {
+		fmt.Fprintln(w, paint(albumColor, album.Name()))
 		return nil
 	})
 }
 
-func (a *artist) doPerAlbum(start string, f func(os.FileInfo) error) error {
-	albums, err := subDirs(a.Path())
+func (a *artist) Tracks(start string) ([]string, error) {
+	var paths []string
+	err := a.doPerAlbum(start, func(album os.FileInfo, path string) error {
+		t, err := a.album(path).Tracks("")
+		paths = append(paths, t...)
+		return err
+	})
+	return paths, err
+}
+
+// Albums returns each of the artist's albums, in order of their names,
+// without playing them. Tracks loose in the artist's folder are last,
+// as an album of their own, as when the artist is played.
+func (a *artist) Albums() ([]Music, error) {
+	albums, err := a.lib.subDirs(a.Path())
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]Music, 0, len(albums)+1)
+	for _, album := range albums {
+		ms = append(ms, newAlbum(a.lib, filepath.Join(a.Path(), album.Name()), true))
+	}
+	loose, err := a.lib.subFiles(a.Path())
+	if err != nil {
+		return nil, err
+	}
+	if len(loose) > 0 {
+		ms = append(ms, newAlbum(a.lib, a.Path(), true))
+	}
+	return ms, nil
+}
+
+// album returns the artist's album at path, to be played
+// as part of the artist's, so only its first track if firstOnly.
+func (a *artist) album(path string) *album {
+	return &album{lib: a.lib, path: path, showName: true, firstOnly: firstOnly}
+}
+
+func (a *artist) doPerAlbum(start string, f func(os.FileInfo, string) error) error {
+	albums, err := a.lib.subDirs(a.Path())
 	if err != nil {
 		return err
 	}
 
-	r := rand.New(rand.NewSource(int64(time.Now().Second())))
-	for i := range albums {
-		n := intnRange(r, i, len(albums))
-		albums[i], albums[n] = albums[n], albums[i]
+	albums = inDecade(albums)
+	paths := make([]string, len(albums))
+	for i, album := range albums {
+		paths[i] = filepath.Join(a.Path(), album.Name())
+	}
+
+	// Tracks loose in the artist's folder are an album of their own,
+	// named for the artist. They have no year, so no decade has them.
+	loose, err := a.lib.subFiles(a.Path())
+	if err != nil {
+		return err
+	}
+	if len(loose) > 0 && decade == 0 {
+		albums = append(albums, songName(filepath.Base(a.Path())))
+		paths = append(paths, a.Path())
+	}
+
+	if len(albums) == 0 {
+		return newError("I failed to find any albums by %s", filepath.Base(a.Path()))
+	}
+
+	if chronological {
+		sort.Stable(byYear{albums, paths})
+	}
+
+	if shuffleAlbums {
+		shuffle(a.Path(), len(albums), func(i, n int) {
+			albums[i], albums[n] = albums[n], albums[i]
+			paths[i], paths[n] = paths[n], paths[i]
+		})
 	}
 
 	s := find(albums, start)
@@ -207,16 +338,167 @@ func (a *artist) doPerAlbum(start string, f func(os.FileInfo) error) error {
 		return newError("I failed to find an album matching this pattern: %q", start)
 	}
 
-	albums = append(albums[s:len(albums)], albums[0:s]...)
+	albums = append(albums[s:], albums[:s]...)
+	paths = append(paths[s:], paths[:s]...)
 
-	for _, album := range albums {
-		if err := f(album); err != nil {
+	if reversed {
+		reverse(len(albums), func(i, n int) {
+			albums[i], albums[n] = albums[n], albums[i]
+			paths[i], paths[n] = paths[n], paths[i]
+		})
+	}
+
+	for i, album := range albums {
+		if err := f(album, paths[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// shuffleAlbums is true iff artists and libraries play their albums
+// in random order, rather than in the order of their names.
+var shuffleAlbums = true
+
+// shuffleTracks is true iff albums play their tracks in random order.
+var shuffleTracks = false
+
+// firstOnly is true iff artists play only the first track of each album.
+var firstOnly = false
+
+// shuffleSeed seeds the random orderings made by shuffle.
+// The same seed gives the same order every time.
+var shuffleSeed = time.Now().UnixNano()
+
+// shuffle randomly permutes n items, using swap to exchange the
+// items at two indices. The permutation depends on shuffleSeed and on
+// key, which names the things being shuffled, so that e.g. different
+// albums of the same length are shuffled differently.
+func shuffle(key string, n int, swap func(i, j int)) {
+	r := shuffleRand(key)
+	for i := 0; i < n; i++ {
+		swap(i, intnRange(r, i, n))
+	}
+}
+
+// shuffleRand returns the source of the random orderings of the things
+// named by key, which depends on shuffleSeed.
+func shuffleRand(key string) *rand.Rand {
+	h := fnv.New64a()
+	io.WriteString(h, key)
+	return rand.New(rand.NewSource(shuffleSeed ^ int64(h.Sum64())))
+}
+
+// weightedShuffle randomly permutes items with the given weights, like
+// shuffle, but each position is filled by one of the items left with
+// a chance in proportion to its weight, so heavier items come earlier.
+func weightedShuffle(key string, weights []float64, swap func(i, j int)) {
+	r := shuffleRand(key)
+	w := append([]float64(nil), weights...)
+	total := 0.0
+	for _, x := range w {
+		total += x
+	}
+	for i := range w {
+		x := r.Float64() * total
+		j := i
+		for ; j < len(w)-1; j++ {
+			if x -= w[j]; x < 0 {
+				break
+			}
+		}
+		total -= w[j]
+		w[i], w[j] = w[j], w[i]
+		swap(i, j)
+	}
+}
+
+// spreadArtists is true iff the tracks of a library which are all
+// shuffled together are spread out, so that the same artist rarely
+// plays twice in a row.
+var spreadArtists = true
+
+// spreadOrder returns an order for items by the given artists, which
+// are in the order of a shuffle, in which items by the same artist are
+// next to each other as little as possible. It keeps to the shuffled
+// order where it can, taking the first item left which isn't by the
+// artist of the last, unless one artist has more left than all the
+// others together, which must come as often as they can.
+func spreadOrder(artists []string) []int {
+	// The items left by each artist, in order.
+	left := map[string][]int{}
+	var names []string
+	for i, a := range artists {
+		if _, ok := left[a]; !ok {
+			names = append(names, a)
+		}
+		left[a] = append(left[a], i)
+	}
+
+	order := make([]int, 0, len(artists))
+	last := ""
+	for n := len(artists); n > 0; n-- {
+		most, next := "", ""
+		for _, a := range names {
+			if len(left[a]) > len(left[most]) {
+				most = a
+			}
+			if a != last && len(left[a]) > 0 && (next == "" || left[a][0] < left[next][0]) {
+				next = a
+			}
+		}
+		switch {
+		case most != last && 2*len(left[most]) > n:
+			next = most
+		case next == "":
+			// Only the last artist has any left.
+			next = last
+		}
+		order = append(order, left[next][0])
+		left[next] = left[next][1:]
+		last = next
+	}
+	return order
+}
+
+// shufflePlays, if not nil, holds how many times each track has been
+// played, by path, so that shuffled tracks favor the ones played less.
+var shufflePlays map[string]int
+
+// shuffleSongs shuffles songs, and their paths, with the permutation
+// of shuffle, or of weightedShuffle if shufflePlays is set. Then, the
+// weight of a song is 1/(1+p)², where it's been played p times, so a
+// song which has never been played is four times as likely to come
+// first as one played once.
+func shuffleSongs(key string, songs []os.FileInfo, paths []string) {
+	swap := func(i, n int) {
+		songs[i], songs[n] = songs[n], songs[i]
+		paths[i], paths[n] = paths[n], paths[i]
+	}
+	if shufflePlays == nil {
+		shuffle(key, len(songs), swap)
+		return
+	}
+	weights := make([]float64, len(paths))
+	for i, path := range paths {
+		p := float64(1 + shufflePlays[path])
+		weights[i] = 1 / (p * p)
+	}
+	weightedShuffle(key, weights, swap)
+}
+
+// reversed is true iff artists and albums play their albums and
+// tracks in the reverse of their usual order.
+var reversed = false
+
+// reverse reverses the order of n items, using swap to exchange the
+// items at two indices.
+func reverse(n int, swap func(i, j int)) {
+	for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
 // intnRange returns a non-negative int in the range [b,e).
 func intnRange(r *rand.Rand, b, e int) int {
 	return r.Intn(e-b) + b
@@ -224,99 +506,475 @@ func intnRange(r *rand.Rand, b, e int) int {
 
 // An album represents all of the tracks of an album.
 type album struct {
+	lib      *Library
 	path     string
 	showName bool
+
+	// end, if not empty, matches the last track to be played.
+	end string
+
+	// firstOnly, if true, means only the first track is played.
+	firstOnly bool
 }
 
-func newAlbum(path string, showName bool) Music {
-	return &album{path, showName}
+func newAlbum(lib *Library, path string, showName bool) Music {
+	return &album{lib: lib, path: path, showName: showName}
 }
 
 func (a *album) Path() string {
 	return a.path
 }
 
-func (a *album) Play(start string, tracks bool) error {
-	return a.doPerSong(start, func(song os.FileInfo) error {
-		if tracks {
-			n := trimExt(song.Name())
+func (a *album) Kind() string {
+	return "album"
+}
+
+func (a *album) String() string {
+	return describe(a)
+}
+
+func (a *album) Play(ctx context.Context, p *Player, start string) error {
+	return a.doPerSong(start, func(song os.FileInfo, path string) error {
+		if p.Tracks {
+			n := paint(playingColor, a.lib.title(song, path))
 			if a.showName {
 				_, p := filepath.Split(a.Path())
-				n = p + "/" + n
+				n = paint(albumColor, p) + "/" + n
 			}
-			fmt.Println(n)
+			logs.Info(n)
+		}
+		return p.Play(ctx, path)
+	})
+}
+
+func (a *album) List(w io.Writer, start string) error {
+	if listJSON {
+		l, err := listAlbum(a, filepath.Base(a.Path()), start)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, l)
+	}
+	var total time.Duration
+	err := a.doPerSong(start, func(song os.FileInfo, path string) error {
+		name := song.Name()
+		if useTags {
+			name = a.lib.title(song, path)
+		}
+		if listDurations {
+			d, ok := a.lib.duration(path)
+			total += d
+			name = formatDuration(d, ok) + "  " + name
 		}
-		f := filepath.Join(a.Path(), song.Name())
-		data, err := ioutil.ReadFile(f)
+		fmt.Fprintln(w, name)
+		return nil
+	})
+	if err == nil && listDurations {
+		fmt.Fprintln(w, formatDuration(total, true)+"  Total")
+	}
+	return err
+}
+
+func (a *album) Tracks(start string) ([]string, error) {
+	var paths []string
+	err := a.doPerSong(start, func(song os.FileInfo, path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+func (a *album) doPerSong(start string, f func(os.FileInfo, string) error) error {
+	songs, paths, err := a.songs()
+	if err != nil {
+		return err
+	}
+	if songs, paths = rated(songs, paths); len(songs) == 0 && minRating > 0 {
+		// None of them are rated well enough.
+		return nil
+	}
+
+	if shuffleTracks {
+		songs, paths = fresh(a.lib, songs, paths)
+		shuffleSongs(a.Path(), songs, paths)
+	}
+
+	s := find(songs, start)
+	if s < 0 {
+		return newError("I failed to find a song matching this pattern: %q", start)
+	}
+
+	switch {
+	case a.end != "":
+		e := find(songs, a.end)
+		if e < 0 {
+			return newError("I failed to find a song matching this pattern: %q", a.end)
+		}
+		if e < s {
+			return newError("The song matching %q comes before the one matching %q", a.end, start)
+		}
+		songs = songs[s : e+1]
+		paths = paths[s : e+1]
+	case shuffleTracks:
+		songs = append(songs[s:], songs[:s]...)
+		paths = append(paths[s:], paths[:s]...)
+	default:
+		songs = songs[s:]
+		paths = paths[s:]
+	}
+
+	if reversed {
+		reverse(len(songs), func(i, n int) {
+			songs[i], songs[n] = songs[n], songs[i]
+			paths[i], paths[n] = paths[n], paths[i]
+		})
+	}
+
+	if a.firstOnly && len(songs) > 1 {
+		songs, paths = songs[:1], paths[:1]
+	}
+
+	for i, song := range songs {
+		if err := f(song, paths[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// songs returns the FileInfos and paths of the album's tracks.
+// An album without tracks of its own, but with folders, has a folder
+// for each disc, e.g. CD1 and CD2, and their tracks are returned
+// one disc after another.
+func (a *album) songs() ([]os.FileInfo, []string, error) {
+	songs, err := a.lib.subFiles(a.Path())
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, len(songs))
+	for i, song := range songs {
+		paths[i] = filepath.Join(a.Path(), song.Name())
+	}
+	if len(songs) > 0 {
+		return songs, paths, nil
+	}
+
+	discs, err := a.lib.subDirs(a.Path())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, disc := range discs {
+		d := &album{lib: a.lib, path: filepath.Join(a.Path(), disc.Name())}
+		ss, ps, err := d.songs()
 		if err != nil {
+			return nil, nil, err
+		}
+		songs = append(songs, ss...)
+		paths = append(paths, ps...)
+	}
+	return songs, paths, nil
+}
+
+// A track represents a single song.
+type track struct {
+	lib  *Library // nil if the track isn't in one, e.g. in a playlist
+	path string
+}
+
+func newTrack(lib *Library, path string) Music {
+	return &track{lib, path}
+}
+
+func (t *track) Path() string {
+	return t.path
+}
+
+func (t *track) Kind() string {
+	return "track"
+}
+
+func (t *track) String() string {
+	return describe(t)
+}
+
+func (t *track) Play(ctx context.Context, p *Player, start string) error {
+	if p.Tracks {
+		artist, album, song := t.names()
+		logs.Info(paintTrack(artist, album, song, true))
+	}
+	return p.Play(ctx, t.Path())
+}
+
+func (t *track) List(w io.Writer, start string) error {
+	if listJSON {
+		l, err := listTracks([]string{t.Path()})
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, l[0])
+	}
+	artist, album, song := t.names()
+	fmt.Fprintln(w, paintTrack(artist, album, song, false))
+	return nil
+}
+
+func (t *track) Tracks(start string) ([]string, error) {
+	return []string{t.Path()}, nil
+}
+
+// name returns the track's name along with its artist and album,
+// e.g. "Bob Dylan/Blood on the Tracks/Tangled Up in Blue".
+func (t *track) name() string {
+	artist, album, song := t.names()
+	return artist + "/" + album + "/" + song
+}
+
+// names returns the names of the track's artist, album, and song,
+// from the folders and file holding it. With useTags, the names in
+// the track's tags are used instead, where it has them.
+func (t *track) names() (artist, album, song string) {
+	album, song = filepath.Split(t.Path())
+	artist, album = filepath.Split(filepath.Clean(album))
+	artist, song = filepath.Base(artist), trimExt(song)
+	if useTags {
+		tags := t.tags()
+		artist = cmp.Or(tags.Artist, artist)
+		album = cmp.Or(tags.Album, album)
+		song = cmp.Or(tags.Title, song)
+	}
+	return artist, album, song
+}
+
+// tags returns the track's tags, read through its Library, if it's in one.
+func (t *track) tags() trackTags {
+	if t.lib != nil {
+		tags, _ := t.lib.tags(t.Path())
+		return tags
+	}
+	tags, _ := fileTags(t.Path())
+	return tags
+}
+
+// A collection represents every album in a Library. Unless its
+// tracks are mixed, albums are played whole, one after another, in
+// random order. Mixed tracks are all shuffled together.
+type collection struct {
+	lib *Library
+	mix bool
+}
+
+func newCollection(lib *Library, mix bool) Music {
+	return &collection{lib, mix}
+}
+
+func (l *collection) Path() string {
+	return l.lib.root()
+}
+
+func (l *collection) Kind() string {
+	return "library"
+}
+
+func (l *collection) String() string {
+	return describe(l)
+}
+
+func (l *collection) Play(ctx context.Context, p *Player, start string) error {
+	if l.mix {
+		return l.doPerTrack(start, func(path string) error {
+			return newTrack(l.lib, path).Play(ctx, p, "")
+		})
+	}
+	return l.doPerAlbum(start, func(path string) error {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		pcm, channels, sampleRate, err := vorbis.Decode(data)
+		return newAlbum(l.lib, path, true).Play(ctx, p, "")
+	})
+}
+
+func (l *collection) List(w io.Writer, start string) error {
+	if listJSON && l.mix {
+		paths, err := l.Tracks(start)
 		if err != nil {
 			return err
 		}
-		var buf bytes.Buffer
-		err = binary.Write(&buf, binary.LittleEndian, pcm)
+		ts, err := listTracks(paths)
 		if err != nil {
 			return err
 		}
-		player, err := oto.NewPlayer(sampleRate, channels, 2, len(pcm)*2)
+		return writeJSON(w, ts)
+	}
+	if listJSON {
+		als := []albumListing{}
+		err := l.doPerAlbum(start, func(path string) error {
+			al, err := listAlbum(&album{lib: l.lib, path: path}, filepath.Base(path), "")
+			als = append(als, al)
+			return err
+		})
 		if err != nil {
 			return err
 		}
-		defer player.Close()
-		_, err = player.Write(buf.Bytes())
-		return err
+		return writeJSON(w, als)
+	}
+	if l.mix {
+		return l.doPerTrack(start, func(path string) error {
+			return newTrack(l.lib, path).List(w, "")
+		})
+	}
+	return l.doPerAlbum(start, func(path string) error {
+		artist, album := filepath.Split(path)
+		fmt.Fprintln(w, paint(artistColor, filepath.Base(artist))+"/"+paint(albumColor, album))
+		return nil
 	})
 }
 
-func (a *album) List(start string) error {
-	return a.doPerSong(start, func(song os.FileInfo) error {
-		fmt.Println(song.Name())
-		return nil
+func (l *collection) Tracks(start string) ([]string, error) {
+	var paths []string
+	if l.mix {
+		err := l.doPerTrack(start, func(path string) error {
+			paths = append(paths, path)
+			return nil
+		})
+		return paths, err
+	}
+	err := l.doPerAlbum(start, func(path string) error {
+		t, err := newAlbum(l.lib, path, true).Tracks("")
+		paths = append(paths, t...)
+		return err
 	})
+	return paths, err
 }
 
-func (a *album) doPerSong(start string, f func(os.FileInfo) error) error {
-	songs, err := subFiles(a.Path())
+// albums returns the FileInfos and paths of every album in the collection.
+func (l *collection) albums() ([]os.FileInfo, []string, error) {
+	_, alocs, err := l.lib.artists()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	albums := []os.FileInfo{}
+	paths := []string{}
+	for _, aloc := range alocs {
+		as, err := l.lib.subDirs(aloc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, album := range inDecade(as) {
+			albums = append(albums, album)
+			paths = append(paths, filepath.Join(aloc, album.Name()))
+		}
+
+		// Tracks loose in an artist's folder are an album of their
+		// own, as in artist.doPerAlbum.
+		loose, err := l.lib.subFiles(aloc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(loose) > 0 && decade == 0 {
+			albums = append(albums, songName(filepath.Base(aloc)))
+			paths = append(paths, aloc)
+		}
+	}
+
+	if len(albums) == 0 {
+		return nil, nil, newError("I failed to find any albums in %s", l.Path())
+	}
+	return albums, paths, nil
+}
+
+// doPerAlbum calls f with the path of each album in the collection,
+// shuffled as a block so that no album's tracks are split up.
+func (l *collection) doPerAlbum(start string, f func(string) error) error {
+	albums, paths, err := l.albums()
 	if err != nil {
 		return err
 	}
 
-	s := find(songs, start)
+	if shuffleAlbums {
+		shuffle(l.Path(), len(albums), func(i, n int) {
+			albums[i], albums[n] = albums[n], albums[i]
+			paths[i], paths[n] = paths[n], paths[i]
+		})
+	}
+
+	s := find(albums, start)
 	if s < 0 {
-		return newError("I failed to find a song matching this pattern: %q", start)
+		return newError("I failed to find an album matching this pattern: %q", start)
 	}
 
-	for _, song := range songs[s:] {
-		if err := f(song); err != nil {
+	paths = append(paths[s:], paths[:s]...)
+
+	for _, p := range paths {
+		if err := f(p); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-// find returns the index into fi of the acceptable FileInfo matching
-// the given pattern, or 0 if not found.
-func find(fi []os.FileInfo, pattern string) int {
-	if pattern == "" {
-		return 0
+// spread returns the songs, and their paths, in the spreadOrder
+// of their artists.
+func (l *collection) spread(songs []os.FileInfo, paths []string) ([]os.FileInfo, []string) {
+	artists := make([]string, len(paths))
+	for i, p := range paths {
+		artists[i] = l.lib.artistOf(p)
+	}
+	ss := make([]os.FileInfo, len(songs))
+	ps := make([]string, len(paths))
+	for i, j := range spreadOrder(artists) {
+		ss[i], ps[i] = songs[j], paths[j]
 	}
+	return ss, ps
+}
 
-	best := 9999
-	loc := -1
-	for i := range fi {
-		m := match(pattern, fi[i].Name())
-		if m < 0 {
-			continue
+// doPerTrack calls f with the path of every track in the collection,
+// all shuffled together.
+func (l *collection) doPerTrack(start string, f func(string) error) error {
+	_, apaths, err := l.albums()
+	if err != nil {
+		return err
+	}
+
+	songs := []os.FileInfo{}
+	paths := []string{}
+	for _, apath := range apaths {
+		ss, ps, err := newAlbum(l.lib, apath, false).(*album).songs()
+		if err != nil {
+			return err
 		}
-		if m < best {
-			best = m
-			loc = i
+		songs = append(songs, ss...)
+		paths = append(paths, ps...)
+	}
+
+	if len(songs) == 0 {
+		return newError("I failed to find any tracks in %s", l.Path())
+	}
+	songs, paths = rated(songs, paths)
+	if len(songs) == 0 {
+		return newError("None of the tracks in %s are rated %d or better.", l.Path(), minRating)
+	}
+
+	songs, paths = fresh(l.lib, songs, paths)
+	shuffleSongs(l.Path(), songs, paths)
+	if spreadArtists {
+		songs, paths = l.spread(songs, paths)
+	}
+
+	s := find(songs, start)
+	if s < 0 {
+		return newError("I failed to find a song matching this pattern: %q", start)
+	}
+
+	paths = append(paths[s:], paths[:s]...)
+
+	for _, p := range paths {
+		if err := f(p); err != nil {
+			return err
 		}
 	}
-	return loc
+	return nil
 }
 
 type Error struct {
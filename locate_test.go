@@ -0,0 +1,963 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// mkLibrary creates a Music folder in a temporary directory containing
+// the given files, which are paths relative to the folder.
+func mkLibrary(t *testing.T, files ...string) string {
+	root := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestLibraryAlbumBlocks(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Pinkerton/2 Getchoo.ogg",
+		"Weezer/Pinkerton/3 No Other One.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+	)
+
+	lib := dirLibrary(root)
+	var played []string
+	err := newCollection(lib, false).(*collection).doPerAlbum("", func(path string) error {
+		return newAlbum(lib, path, true).(*album).doPerSong("", func(os.FileInfo, string) error {
+			played = append(played, filepath.Base(path))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(played) != 7 {
+		t.Fatal("Expected 7 tracks to play, but got", len(played))
+	}
+	seen := map[string]bool{}
+	for i, a := range played {
+		if i > 0 && played[i-1] == a {
+			continue
+		}
+		if seen[a] {
+			t.Error("The tracks of", a, "were split up:", played)
+		}
+		seen[a] = true
+	}
+	if len(seen) != 4 {
+		t.Error("Expected all 4 albums to play, but got", played)
+	}
+}
+
+func TestLibraryEmpty(t *testing.T) {
+	root := mkLibrary(t, "Pixies/.keep")
+	err := newCollection(dirLibrary(root), false).(*collection).doPerAlbum("", func(string) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("Expected an error for a library without albums")
+	}
+}
+
+func TestMusiclocs(t *testing.T) {
+	flagDir := mkLibrary(t)
+	flagDir2 := mkLibrary(t)
+	envDir := mkLibrary(t)
+	envDir2 := mkLibrary(t)
+	missing := filepath.Join(flagDir, "missing")
+	file := mkLibrary(t, "file")
+	list := func(dirs ...string) string {
+		return strings.Join(dirs, string(filepath.ListSeparator))
+	}
+
+	tests := []struct {
+		flags []string
+		env   string
+		locs  []string
+	}{
+		{[]string{flagDir}, "", []string{flagDir}},
+		{nil, envDir, []string{envDir}},
+		{[]string{flagDir}, envDir, []string{flagDir}},
+		{[]string{flagDir, flagDir2}, envDir, []string{flagDir, flagDir2}},
+		{nil, list(envDir, envDir2), []string{envDir, envDir2}},
+		{nil, list(envDir, "", envDir2), []string{envDir, envDir2}},
+		{[]string{missing}, envDir, nil},
+		{[]string{flagDir, missing}, "", nil},
+		{nil, missing, nil},
+		{nil, list(envDir, missing), nil},
+		{[]string{filepath.Join(file, "file")}, "", nil},
+	}
+
+	defer func() { musicdirs = nil }()
+	for _, test := range tests {
+		musicdirs = test.flags
+		t.Setenv("SPLAY_MUSIC_DIR", test.env)
+
+		locs, err := musiclocs()
+		if test.locs == nil {
+			if err == nil {
+				t.Errorf("musiclocs with -dir %q and $SPLAY_MUSIC_DIR %q should fail, but got %q", test.flags, test.env, locs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("musiclocs with -dir %q and $SPLAY_MUSIC_DIR %q failed: %v", test.flags, test.env, err)
+		} else if !reflect.DeepEqual(locs, test.locs) {
+			t.Errorf("musiclocs with -dir %q and $SPLAY_MUSIC_DIR %q should be %q, but got %q", test.flags, test.env, test.locs, locs)
+		}
+	}
+}
+
+func TestXDGMusicDir(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "user-dirs.dirs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	loc := xdgMusicDir(f, "/home/bob")
+	if loc != "/home/bob/Media/My Music" {
+		t.Error("Expected XDG_MUSIC_DIR to be /home/bob/Media/My Music, but got", loc)
+	}
+}
+
+func TestUserMusicDir(t *testing.T) {
+	home := mkLibrary(t, "Media/My Music/Pixies/Doolittle/1 Debaser.ogg")
+	config := filepath.Join(home, ".config")
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	if loc := userMusicDir(home); loc != filepath.Join(home, "Music") {
+		t.Error("Without user-dirs.dirs, expected ~/Music, but got", loc)
+	}
+
+	dirs, err := os.ReadFile(filepath.Join("testdata", "user-dirs.dirs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(config, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config, "user-dirs.dirs"), dirs, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if loc := userMusicDir(home); loc != filepath.Join(home, "Media", "My Music") {
+		t.Error("Expected XDG_MUSIC_DIR, but got", loc)
+	}
+}
+
+func TestSubFiles(t *testing.T) {
+	root := mkLibrary(t,
+		"1 Debaser.mp3",
+		"2 Tame.FLAC",
+		"3 Wave of Mutilation.m4a",
+		"4 I Bleed.Ogg",
+		"5 Here Comes Your Man.opus",
+		"6 Dead.wav",
+		"7 Monkey Gone to Heaven.aac",
+		"cover.jpg",
+		"folder.png",
+		"Doolittle.nfo",
+		".DS_Store",
+		"README",
+		"Bonus/8 Into the White.mp3",
+	)
+
+	names := func() []string {
+		files, err := dirLibrary(root).subFiles(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		return names
+	}
+
+	want := []string{
+		"1 Debaser.mp3",
+		"2 Tame.FLAC",
+		"3 Wave of Mutilation.m4a",
+		"4 I Bleed.Ogg",
+		"5 Here Comes Your Man.opus",
+		"6 Dead.wav",
+		"7 Monkey Gone to Heaven.aac",
+	}
+	if got := names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("subFiles should return %q, but got %q", want, got)
+	}
+
+	defer func(exts map[string]bool) { audioExts = exts }(audioExts)
+	audioExts = parseExts("MP3, wav,,")
+	want = []string{"1 Debaser.mp3", "6 Dead.wav"}
+	if got := names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("With -ext MP3,wav, subFiles should return %q, but got %q", want, got)
+	}
+}
+
+func TestLocateTrack(t *testing.T) {
+	root := mkLibrary(t,
+		"Bob Dylan/Blood on the Tracks/01 Tangled Up in Blue.mp3",
+		"Bob Dylan/Blood on the Tracks/02 Simple Twist of Fate.mp3",
+		"Bob Dylan/Live 1975/Tangled Up in Blue (Live).mp3",
+		"Pixies/Doolittle/1 Debaser.ogg",
+	)
+	musicdirs = stringList{root}
+	defer func() { musicdirs = nil }()
+
+	m, err := LocateTrack("tangled up in blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(root, "Bob Dylan", "Blood on the Tracks", "01 Tangled Up in Blue.mp3")
+	if m == nil || m.Path() != want {
+		t.Fatal("Expected to find", want, "but got", m)
+	}
+
+	var buf bytes.Buffer
+	if err := m.List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Bob Dylan/Blood on the Tracks/01 Tangled Up in Blue\n" {
+		t.Errorf("Unexpected listing: %q", buf.String())
+	}
+
+	p, ran := fakePlayer(t, "mpg123")
+	if err := m.Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(*ran) != 1 || (*ran)[0][1] != want {
+		t.Error("Expected to play just", want, "but played", *ran)
+	}
+
+	m, err = LocateTrack("mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != nil {
+		t.Error("Extensions shouldn't be matched, but found", m.Path())
+	}
+}
+
+func TestTracks(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Doolittle/cover.jpg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+	lib := dirLibrary(root)
+	pixies := filepath.Join(root, "Pixies")
+	doolittle := filepath.Join(pixies, "Doolittle")
+	surfer := filepath.Join(pixies, "Surfer Rosa")
+
+	tests := []struct {
+		m      Music
+		start  string
+		tracks []string
+	}{
+		{newAlbum(lib, doolittle, false), "", []string{
+			filepath.Join(doolittle, "1 Debaser.ogg"),
+			filepath.Join(doolittle, "2 Tame.ogg"),
+			filepath.Join(doolittle, "3 Wave of Mutilation.ogg"),
+		}},
+		{newAlbum(lib, doolittle, false), "tame", []string{
+			filepath.Join(doolittle, "2 Tame.ogg"),
+			filepath.Join(doolittle, "3 Wave of Mutilation.ogg"),
+		}},
+		{newArtist(lib, pixies), "surfer", []string{
+			filepath.Join(surfer, "1 Bone Machine.ogg"),
+			filepath.Join(surfer, "2 Break My Body.ogg"),
+			filepath.Join(doolittle, "1 Debaser.ogg"),
+			filepath.Join(doolittle, "2 Tame.ogg"),
+			filepath.Join(doolittle, "3 Wave of Mutilation.ogg"),
+		}},
+		{newTrack(lib, filepath.Join(surfer, "1 Bone Machine.ogg")), "", []string{
+			filepath.Join(surfer, "1 Bone Machine.ogg"),
+		}},
+	}
+
+	for _, test := range tests {
+		tracks, err := test.m.Tracks(test.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tracks, test.tracks) {
+			t.Errorf("Tracks(%q) of %s should be %q, but got %q", test.start, test.m.Path(), test.tracks, tracks)
+		}
+	}
+}
+
+func TestShuffleSeed(t *testing.T) {
+	root := mkLibrary(t,
+		"Weezer/Blue/1.ogg",
+		"Weezer/Pinkerton/1.ogg",
+		"Weezer/Green/1.ogg",
+		"Weezer/Maladroit/1.ogg",
+		"Weezer/Make Believe/1.ogg",
+		"Weezer/Red/1.ogg",
+	)
+	a := newArtist(dirLibrary(root), filepath.Join(root, "Weezer")).(*artist)
+
+	order := func() string {
+		names := ""
+		err := a.doPerAlbum("", func(album os.FileInfo, path string) error {
+			names += album.Name() + "/"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	defer func(s int64) { shuffleSeed = s }(shuffleSeed)
+	orders := map[string]bool{}
+	for s := int64(1); s <= 5; s++ {
+		shuffleSeed = s
+		first := order()
+		if second := order(); first != second {
+			t.Errorf("The seed %d gave different orders: %s and %s", s, first, second)
+		}
+		orders[first] = true
+	}
+	if len(orders) == 1 {
+		t.Error("Every seed gave the same order")
+	}
+}
+
+func TestNoShuffle(t *testing.T) {
+	root := mkLibrary(t,
+		"Weezer/1994 - Blue/1.ogg",
+		"Weezer/1996 - Pinkerton/1.ogg",
+		"Weezer/2001 - Green/1.ogg",
+		"Weezer/2002 - Maladroit/1.ogg",
+		"Weezer/2005 - Make Believe/1.ogg",
+	)
+	a := newArtist(dirLibrary(root), filepath.Join(root, "Weezer")).(*artist)
+
+	order := func(start string) []string {
+		var names []string
+		err := a.doPerAlbum(start, func(album os.FileInfo, path string) error {
+			names = append(names, album.Name())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	defer func() { shuffleAlbums = true }()
+	shuffleAlbums = false
+
+	want := []string{"1994 - Blue", "1996 - Pinkerton", "2001 - Green", "2002 - Maladroit", "2005 - Make Believe"}
+	if got := order(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unshuffled albums should be %q, but got %q", want, got)
+	}
+
+	want = []string{"2002 - Maladroit", "2005 - Make Believe", "1994 - Blue", "1996 - Pinkerton", "2001 - Green"}
+	if got := order("maladroit"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unshuffled albums from Maladroit should be %q, but got %q", want, got)
+	}
+
+	shuffleAlbums = true
+	shuffled := order("maladroit")
+	if shuffled[0] != "2002 - Maladroit" || len(shuffled) != 5 {
+		t.Errorf("Shuffled albums should start with Maladroit and include all 5, but got %q", shuffled)
+	}
+}
+
+func TestShuffleTracks(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/01 Debaser.ogg",
+		"Pixies/Doolittle/02 Tame.ogg",
+		"Pixies/Doolittle/03 Wave of Mutilation.ogg",
+		"Pixies/Doolittle/04 I Bleed.ogg",
+		"Pixies/Doolittle/05 Here Comes Your Man.ogg",
+		"Pixies/Doolittle/06 Dead.ogg",
+		"Pixies/Surfer Rosa/01 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/02 Break My Body.ogg",
+		"Pixies/Surfer Rosa/03 Something Against You.ogg",
+		"Pixies/Surfer Rosa/04 Broken Face.ogg",
+		"Pixies/Surfer Rosa/05 Gigantic.ogg",
+		"Pixies/Surfer Rosa/06 River Euphrates.ogg",
+	)
+	lib := dirLibrary(root)
+	doolittle := newAlbum(lib, filepath.Join(root, "Pixies", "Doolittle"), false)
+	surfer := newAlbum(lib, filepath.Join(root, "Pixies", "Surfer Rosa"), false)
+
+	defer func(s int64) { shuffleSeed, shuffleTracks = s, false }(shuffleSeed)
+	shuffleSeed = 1
+	ordered, err := doolittle.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shuffleTracks = true
+	first, err := doolittle.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := doolittle.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("The same seed shuffled the tracks differently: %q and %q", first, second)
+	}
+	if reflect.DeepEqual(first, ordered) {
+		t.Error("The tracks weren't shuffled:", first)
+	}
+
+	fromTame, err := doolittle.Tracks("tame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromTame) != 6 || filepath.Base(fromTame[0]) != "02 Tame.ogg" {
+		t.Error("Shuffled tracks from Tame should start with it and include all 6, but got", fromTame)
+	}
+
+	shuffleAlbums = false
+	defer func() { shuffleAlbums = true }()
+	all, err := newArtist(lib, filepath.Join(root, "Pixies")).Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rosa, err := surfer.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, append(first, rosa...)) {
+		t.Errorf("The artist's tracks should be each album's shuffled tracks, but got %q", all)
+	}
+	for i := range rosa {
+		if filepath.Base(rosa[i])[:2] != filepath.Base(first[i])[:2] {
+			return
+		}
+	}
+	t.Error("Both albums were shuffled the same way")
+}
+
+func TestLibraryShuffleAll(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Pinkerton/2 Getchoo.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Blue/folder.jpg",
+		"The Who/.keep",
+	)
+	l := newCollection(dirLibrary(root), true)
+
+	defer func(s int64) { shuffleSeed = s }(shuffleSeed)
+	shuffleSeed = 1
+	first, err := l.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("The same seed shuffled the library differently: %q and %q", first, second)
+	}
+
+	want := []string{
+		filepath.Join(root, "Pixies", "Doolittle", "1 Debaser.ogg"),
+		filepath.Join(root, "Pixies", "Doolittle", "2 Tame.ogg"),
+		filepath.Join(root, "Pixies", "Surfer Rosa", "1 Bone Machine.ogg"),
+		filepath.Join(root, "Weezer", "Blue", "1 My Name Is Jonas.ogg"),
+		filepath.Join(root, "Weezer", "Pinkerton", "1 Tired of Sex.ogg"),
+		filepath.Join(root, "Weezer", "Pinkerton", "2 Getchoo.ogg"),
+	}
+	sorted := append([]string(nil), first...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, want) {
+		t.Errorf("Expected every track in the library, but got %q", first)
+	}
+
+	orders := map[string]bool{}
+	for s := int64(1); s <= 5; s++ {
+		shuffleSeed = s
+		tracks, err := l.Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders[strings.Join(tracks, "\n")] = true
+	}
+	if len(orders) == 1 {
+		t.Error("Every seed gave the same order")
+	}
+
+	if _, err := newCollection(dirLibrary(mkLibrary(t, "The Who/.keep")), true).Tracks(""); err == nil {
+		t.Error("Expected an error for an empty library")
+	}
+	if _, err := newCollection(dirLibrary(mkLibrary(t, "The Who/Tommy/cover.jpg")), true).Tracks(""); err == nil {
+		t.Error("Expected an error for a library without tracks")
+	}
+}
+
+func TestMultiDisc(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/Scans/cover.jpg",
+		"The Who/Tommy/CD1/1 Overture.ogg",
+		"The Who/Tommy/CD1/2 It's a Boy.ogg",
+		"The Who/Tommy/CD2/1 Underture.ogg",
+		"The Who/Tommy/CD2/2 Pinball Wizard.ogg",
+	)
+	doolittle := filepath.Join(l.root(), "Pixies", "Doolittle")
+	tommy := filepath.Join(l.root(), "The Who", "Tommy")
+
+	tests := []struct {
+		path   string
+		start  string
+		tracks []string
+	}{
+		{doolittle, "", []string{
+			filepath.Join(doolittle, "1 Debaser.ogg"),
+			filepath.Join(doolittle, "2 Tame.ogg"),
+		}},
+		{tommy, "", []string{
+			filepath.Join(tommy, "CD1", "1 Overture.ogg"),
+			filepath.Join(tommy, "CD1", "2 It's a Boy.ogg"),
+			filepath.Join(tommy, "CD2", "1 Underture.ogg"),
+			filepath.Join(tommy, "CD2", "2 Pinball Wizard.ogg"),
+		}},
+		{tommy, "boy", []string{
+			filepath.Join(tommy, "CD1", "2 It's a Boy.ogg"),
+			filepath.Join(tommy, "CD2", "1 Underture.ogg"),
+			filepath.Join(tommy, "CD2", "2 Pinball Wizard.ogg"),
+		}},
+	}
+	for _, test := range tests {
+		tracks, err := newAlbum(l, test.path, false).Tracks(test.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tracks, test.tracks) {
+			t.Errorf("Tracks(%q) of %s should be %q, but got %q", test.start, test.path, test.tracks, tracks)
+		}
+	}
+}
+
+func TestLooseTracks(t *testing.T) {
+	l := mapLibrary(
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Undone.ogg",
+		"Weezer/cover.jpg",
+	)
+	weezer := filepath.Join(l.root(), "Weezer")
+	a := newArtist(l, weezer)
+
+	defer func() { shuffleAlbums = true }()
+	shuffleAlbums = false
+
+	var buf bytes.Buffer
+	if err := a.List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Blue\nPinkerton\nWeezer\n"; buf.String() != want {
+		t.Errorf("Expected the listing %q, but got %q", want, buf.String())
+	}
+
+	p, ran := fakePlayer(t, "mpg123")
+	if err := a.Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	var played []string
+	for _, args := range *ran {
+		played = append(played, args[1])
+	}
+	want := []string{
+		filepath.Join(weezer, "Blue", "1 My Name Is Jonas.ogg"),
+		filepath.Join(weezer, "Pinkerton", "1 Tired of Sex.ogg"),
+		filepath.Join(weezer, "Undone.ogg"),
+	}
+	if !reflect.DeepEqual(played, want) {
+		t.Errorf("Expected to play %q, but played %q", want, played)
+	}
+
+	// Nothing is dropped when shuffling the whole library, either
+	// track by track, or album by album.
+	for _, mix := range []bool{true, false} {
+		tracks, err := newCollection(l, mix).Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(tracks)
+		if !reflect.DeepEqual(tracks, want) {
+			t.Errorf("Shuffling the library, with mix %v, expected the tracks %q, but got %q", mix, want, tracks)
+		}
+	}
+	if _, paths, err := l.songs(); err != nil || !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected the library's songs to be %q, but got %q, %v", want, paths, err)
+	}
+	if m, err := l.Search("undone"); err != nil || m == nil || m.Path() != want[2] {
+		t.Errorf("Expected to find %s, but got %v, %v", want[2], m, err)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+		"Pixies/Trompe le Monde/1 Trompe le Monde.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+
+	defer func() { reversed, shuffleAlbums = false, true }()
+	reversed = true
+	shuffleAlbums = false
+
+	tests := []struct {
+		m      Music
+		start  string
+		tracks []string
+	}{
+		{newAlbum(l, filepath.Join(pixies, "Doolittle"), false), "", []string{
+			"3 Wave of Mutilation.ogg", "2 Tame.ogg", "1 Debaser.ogg",
+		}},
+		{newAlbum(l, filepath.Join(pixies, "Doolittle"), false), "tame", []string{
+			"3 Wave of Mutilation.ogg", "2 Tame.ogg",
+		}},
+		{newArtist(l, pixies), "", []string{
+			"1 Trompe le Monde.ogg",
+			"2 Break My Body.ogg", "1 Bone Machine.ogg",
+			"3 Wave of Mutilation.ogg", "2 Tame.ogg", "1 Debaser.ogg",
+		}},
+		{newArtist(l, pixies), "surfer", []string{
+			"3 Wave of Mutilation.ogg", "2 Tame.ogg", "1 Debaser.ogg",
+			"1 Trompe le Monde.ogg",
+			"2 Break My Body.ogg", "1 Bone Machine.ogg",
+		}},
+	}
+	for _, test := range tests {
+		paths, err := test.m.Tracks(test.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tracks []string
+		for _, p := range paths {
+			tracks = append(tracks, filepath.Base(p))
+		}
+		if !reflect.DeepEqual(tracks, test.tracks) {
+			t.Errorf("Reversed tracks of %s from %q should be %q, but got %q", test.m.Path(), test.start, test.tracks, tracks)
+		}
+	}
+}
+
+func TestAlbumTo(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/01 Debaser.ogg",
+		"Pixies/Doolittle/02 Tame.ogg",
+		"Pixies/Doolittle/03 Wave of Mutilation.ogg",
+		"Pixies/Doolittle/04 I Bleed.ogg",
+		"Pixies/Doolittle/05 Here Comes Your Man.ogg",
+		"Pixies/Doolittle/06 Dead.ogg",
+		"Pixies/Doolittle/07 Monkey Gone to Heaven.ogg",
+	)
+	doolittle := filepath.Join(l.root(), "Pixies", "Doolittle")
+
+	tests := []struct {
+		start, end string
+		tracks     []string
+	}{
+		{"wave", "dead", []string{
+			"03 Wave of Mutilation.ogg", "04 I Bleed.ogg", "05 Here Comes Your Man.ogg", "06 Dead.ogg",
+		}},
+		{"", "tame", []string{"01 Debaser.ogg", "02 Tame.ogg"}},
+		{"bleed", "bleed", []string{"04 I Bleed.ogg"}},
+		{"man", "monkey", []string{"05 Here Comes Your Man.ogg", "06 Dead.ogg", "07 Monkey Gone to Heaven.ogg"}},
+		{"dead", "tame", nil},
+		{"dead", "gigantic", nil},
+	}
+	for _, test := range tests {
+		a := newAlbum(l, doolittle, false).(*album)
+		a.end = test.end
+		paths, err := a.Tracks(test.start)
+		if test.tracks == nil {
+			if err == nil {
+				t.Errorf("From %q to %q should fail, but got %q", test.start, test.end, paths)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tracks []string
+		for _, p := range paths {
+			tracks = append(tracks, filepath.Base(p))
+		}
+		if !reflect.DeepEqual(tracks, test.tracks) {
+			t.Errorf("From %q to %q should be %q, but got %q", test.start, test.end, test.tracks, tracks)
+		}
+	}
+}
+
+func TestWeightedShuffle(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+	)
+	path := func(p string) string { return filepath.Join(l.root(), filepath.FromSlash(p)) }
+	unplayed := path("Pixies/Surfer Rosa/1 Bone Machine.ogg")
+
+	defer func(s int64) { shuffleSeed, shufflePlays, spreadArtists = s, nil, true }(shuffleSeed)
+	spreadArtists = false
+	shufflePlays = map[string]int{
+		path("Pixies/Doolittle/1 Debaser.ogg"):     10,
+		path("Pixies/Doolittle/2 Tame.ogg"):        3,
+		path("Weezer/Blue/1 My Name Is Jonas.ogg"): 1,
+	}
+
+	firsts := map[string]int{}
+	for s := int64(1); s <= 200; s++ {
+		shuffleSeed = s
+		tracks, err := newCollection(l, true).Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tracks) != 4 {
+			t.Fatalf("Expected every track in the library, but got %q", tracks)
+		}
+		again, _ := newCollection(l, true).Tracks("")
+		if !reflect.DeepEqual(tracks, again) {
+			t.Fatalf("The same seed shuffled the library differently: %q and %q", tracks, again)
+		}
+		firsts[tracks[0]]++
+	}
+
+	// The weights are 1, 1/4, 1/16, and 1/121, so the track which
+	// hasn't been played comes first three quarters of the time.
+	if n := firsts[unplayed]; n < 120 {
+		t.Errorf("The unplayed track only came first %d times in 200", n)
+	}
+	if firsts[path("Weezer/Blue/1 My Name Is Jonas.ogg")] <= firsts[path("Pixies/Doolittle/1 Debaser.ogg")] {
+		t.Errorf("The track played once didn't come first more than the one played ten times: %v", firsts)
+	}
+}
+
+func TestSpreadOrder(t *testing.T) {
+	tests := []struct {
+		artists string
+		want    string
+	}{
+		{"AAABC", "ABACA"},
+		{"AABB", "ABAB"},
+		{"ABCABC", "ABCABC"},
+		{"BBBAAA", "BABABA"},
+		{"AAAAB", "ABAAA"},
+		{"AAAA", "AAAA"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		artists := strings.Split(test.artists, "")
+		var got strings.Builder
+		for _, i := range spreadOrder(artists) {
+			got.WriteString(artists[i])
+		}
+		if got.String() != test.want {
+			t.Errorf("Spreading %s, expected %s, but got %s", test.artists, test.want, got.String())
+		}
+	}
+}
+
+func TestLibrarySpread(t *testing.T) {
+	// Pixies have more tracks than everyone else together,
+	// but only one more.
+	var files []string
+	for i := 1; i <= 10; i++ {
+		files = append(files, fmt.Sprintf("Pixies/Doolittle/%d.ogg", i))
+	}
+	for i := 1; i <= 5; i++ {
+		files = append(files, fmt.Sprintf("Weezer/Blue/%d.ogg", i))
+	}
+	files = append(files, "Pavement/Wowee Zowee/1.ogg", "Pavement/Wowee Zowee/2.ogg", "The Who/Tommy/1.ogg", "Yes/Fragile/1.ogg")
+	l := mapLibrary(files...)
+
+	adjacent := func() float64 {
+		tracks, err := newCollection(l, true).Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tracks) != len(files) {
+			t.Fatalf("Expected all %d tracks, but got %q", len(files), tracks)
+		}
+		n := 0
+		for i := 1; i < len(tracks); i++ {
+			if l.artistOf(tracks[i]) == l.artistOf(tracks[i-1]) {
+				n++
+			}
+		}
+		return float64(n) / float64(len(tracks)-1)
+	}
+
+	defer func(s int64) { shuffleSeed, spreadArtists = s, true }(shuffleSeed)
+	shuffleSeed = 1
+	if rate := adjacent(); rate > 0.05 {
+		t.Errorf("The same artist played twice in a row %.0f%% of the time", 100*rate)
+	}
+	spreadArtists = false
+	if rate := adjacent(); rate < 0.1 {
+		t.Errorf("Without spreading, expected the same artist to play twice in a row more, but it was %.0f%% of the time", 100*rate)
+	}
+}
+
+func TestFirstOnly(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg",
+		"Pixies/Bossanova/Disc 2/1 Rock Music.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+	defer func(s, st, r bool) { shuffleAlbums, shuffleTracks, reversed = s, st, r }(shuffleAlbums, shuffleTracks, reversed)
+	defer func() { firstOnly = false }()
+	shuffleAlbums, shuffleTracks, firstOnly = false, false, true
+
+	tests := []struct {
+		reversed bool
+		want     []string
+	}{
+		{false, []string{"1 Cecilia Ann.ogg", "1 Debaser.ogg", "1 Bone Machine.ogg"}},
+		{true, []string{"2 Break My Body.ogg", "3 Wave of Mutilation.ogg", "1 Rock Music.ogg"}},
+	}
+	for _, test := range tests {
+		reversed = test.reversed
+		p, ran := fakePlayer(t, "mpg123")
+		if err := newArtist(l, pixies).Play(context.Background(), p, ""); err != nil {
+			t.Fatal(err)
+		}
+		var played []string
+		for _, args := range *ran {
+			played = append(played, filepath.Base(args[len(args)-1]))
+		}
+		if !reflect.DeepEqual(played, test.want) {
+			t.Errorf("Expected to play just %q, with reversed=%v, but played %q", test.want, test.reversed, played)
+		}
+
+		paths, err := newArtist(l, pixies).Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != len(test.want) {
+			t.Errorf("Expected the tracks to be the %d played, but got %q", len(test.want), paths)
+		}
+	}
+
+	// Albums played on their own are played whole.
+	p, ran := fakePlayer(t, "mpg123")
+	reversed = false
+	if err := newAlbum(l, filepath.Join(pixies, "Doolittle"), false).Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(*ran) != 3 {
+		t.Errorf("Expected to play all 3 tracks of the album, but played %q", *ran)
+	}
+}
+
+func TestMusicStrings(t *testing.T) {
+	l := mapLibrary("Weezer/Pinkerton/1 Tired of Sex.ogg", "Pixies/Doolittle/1 Debaser.ogg")
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{l.root()}, elem...)...)
+	}
+	pinkerton := newAlbum(l, path("Weezer", "Pinkerton"), false)
+	pixies := newArtist(l, path("Pixies"))
+	debaser := path("Pixies", "Doolittle", "1 Debaser.ogg")
+
+	tests := []struct {
+		m          Music
+		kind, want string
+	}{
+		{pixies, "artist", "artist: " + path("Pixies")},
+		{pinkerton, "album", "album: " + path("Weezer", "Pinkerton")},
+		{newTrack(l, debaser), "track", "track: " + debaser},
+		{newPlaylist([]string{debaser}), "playlist", "playlist: " + debaser},
+		{newCollection(l, false), "library", "library: " + l.root()},
+		{newQueue([]Music{pinkerton, pixies}), "queue", "queue: album: " + path("Weezer", "Pinkerton") + ", artist: " + path("Pixies")},
+	}
+	for _, test := range tests {
+		if k := test.m.Kind(); k != test.kind {
+			t.Errorf("Expected %T to be of the kind %q, but got %q", test.m, test.kind, k)
+		}
+		if s := fmt.Sprint(test.m); s != test.want {
+			t.Errorf("Expected %T to print as %q, but got %q", test.m, test.want, s)
+		}
+	}
+}
+
+func TestArtistAlbums(t *testing.T) {
+	l := mapLibrary(
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Maladroit/Disc 1/1 American Gigolo.ogg",
+		"Weezer/10 Years/1 Undone.ogg",
+		"Weezer/2 Years/1 Buddy Holly.ogg",
+		"Weezer/Undone.ogg",
+		"Pixies/Doolittle/1 Debaser.ogg",
+	)
+	weezer := filepath.Join(l.root(), "Weezer")
+	defer func(s bool) { shuffleAlbums = s }(shuffleAlbums)
+	shuffleAlbums = true
+
+	lister, ok := newArtist(l, weezer).(AlbumLister)
+	if !ok {
+		t.Fatal("Expected an artist to list its albums")
+	}
+	ms, err := lister.Albums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []Music
+	for _, name := range []string{"2 Years", "10 Years", "Blue", "Maladroit", "Pinkerton"} {
+		want = append(want, newAlbum(l, filepath.Join(weezer, name), true))
+	}
+	want = append(want, newAlbum(l, weezer, true))
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("Expected the albums %v, but got %v", want, ms)
+	}
+
+	if _, ok := newAlbum(l, filepath.Join(weezer, "Blue"), false).(AlbumLister); ok {
+		t.Error("Expected only artists to list albums")
+	}
+}
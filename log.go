@@ -0,0 +1,41 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// A logger is where splay's output goes. What was asked for, such as
+// a listing, goes to Out; chatter, such as the names of the tracks
+// being played, goes to Out too, unless Quiet is true; and errors go
+// to Err.
+type logger struct {
+	Out   io.Writer
+	Err   io.Writer
+	Quiet bool
+}
+
+// logs is the logger used for all of splay's output.
+// It is replaced in tests.
+var logs = &logger{Out: os.Stdout, Err: os.Stderr}
+
+// Info prints its arguments to l.Out, followed by a newline,
+// unless l is quiet.
+func (l *logger) Info(args ...interface{}) {
+	if !l.Quiet {
+		fmt.Fprintln(l.Out, args...)
+	}
+}
+
+// Warn prints err to l.Err, as a warning.
+func (l *logger) Warn(err error) {
+	fmt.Fprintf(l.Err, "Warning: %v\n", err)
+}
+
+// Error prints err to l.Err.
+func (l *logger) Error(err error) {
+	fmt.Fprintf(l.Err, "Error: %v\n", err)
+}
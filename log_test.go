@@ -0,0 +1,50 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuiet(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+	)
+	doolittle := filepath.Join(l.root(), "Pixies", "Doolittle")
+
+	defer func(l *logger) { logs = l }(logs)
+	var out, errs bytes.Buffer
+	logs = &logger{Out: &out, Err: &errs}
+
+	p, ran := fakePlayer(t, "mpg123")
+	p.Tracks = true
+	if err := newAlbum(l, doolittle, false).Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "1 Debaser\n2 Tame\n" {
+		t.Errorf("Expected the names of the tracks, but got %q", out.String())
+	}
+
+	out.Reset()
+	*ran = nil
+	logs.Quiet = true
+	if err := newAlbum(l, doolittle, false).Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing to be printed when quiet, but got %q", out.String())
+	}
+	if len(*ran) != 2 {
+		t.Error("Expected both tracks to play when quiet, but played", *ran)
+	}
+
+	logs.Error(errors.New("oops"))
+	if errs.String() != "Error: oops\n" {
+		t.Errorf("Expected errors to be printed even when quiet, but got %q", errs.String())
+	}
+}
@@ -0,0 +1,156 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// writeM3U writes an extended M3U playlist of the tracks at paths to w.
+func writeM3U(w io.Writer, paths []string) error {
+	if _, err := fmt.Fprintln(w, "#EXTM3U"); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "#EXTINF:-1,%s\n%s\n", trimExt(filepath.Base(p)), abs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LocatePlaylist returns a Music object for the tracks listed in the
+// M3U playlist file, or an error if it can't be read.
+func LocatePlaylist(file string) (Music, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths, err := readM3U(f, filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, newError("There are no tracks in the playlist %s", file)
+	}
+	return newPlaylist(paths), nil
+}
+
+// readM3U returns the paths of the tracks in an M3U playlist, skipping
+// comments and #EXTINF lines. Relative paths are resolved against dir.
+func readM3U(r io.Reader, dir string) ([]string, error) {
+	var paths []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(s.Text(), "\uFEFF"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) && !strings.Contains(line, "://") {
+			line = filepath.Join(dir, filepath.FromSlash(line))
+		}
+		paths = append(paths, line)
+	}
+	return paths, s.Err()
+}
+
+// A playlist represents an explicit list of tracks.
+type playlist struct {
+	paths []string
+}
+
+func newPlaylist(paths []string) Music {
+	return &playlist{paths}
+}
+
+// Path returns the path of the playlist's first track.
+func (pl *playlist) Path() string {
+	return pl.paths[0]
+}
+
+func (pl *playlist) Kind() string {
+	return "playlist"
+}
+
+func (pl *playlist) String() string {
+	return describe(pl)
+}
+
+func (pl *playlist) Play(ctx context.Context, p *Player, start string) error {
+	return pl.doPerTrack(start, func(path string) error {
+		return newTrack(nil, path).Play(ctx, p, "")
+	})
+}
+
+func (pl *playlist) List(w io.Writer, start string) error {
+	if listJSON {
+		paths, err := pl.Tracks(start)
+		if err != nil {
+			return err
+		}
+		ts, err := listTracks(paths)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, ts)
+	}
+	return pl.doPerTrack(start, func(path string) error {
+		fmt.Fprintln(w, filepath.Base(path))
+		return nil
+	})
+}
+
+func (pl *playlist) Tracks(start string) ([]string, error) {
+	var paths []string
+	err := pl.doPerTrack(start, func(path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+// doPerTrack calls f with the path of each track, in order,
+// starting with the track matching start.
+func (pl *playlist) doPerTrack(start string, f func(string) error) error {
+	songs := make([]os.FileInfo, len(pl.paths))
+	for i, p := range pl.paths {
+		songs[i] = songName(filepath.Base(p))
+	}
+
+	s := find(songs, start)
+	if s < 0 {
+		return newError("I failed to find a song matching this pattern: %q", start)
+	}
+
+	for _, p := range pl.paths[s:] {
+		if err := f(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A songName is an os.FileInfo for a track which is known only by
+// its name, so that it can be matched by find.
+type songName string
+
+func (n songName) Name() string       { return string(n) }
+func (n songName) Size() int64        { return 0 }
+func (n songName) Mode() os.FileMode  { return 0 }
+func (n songName) ModTime() time.Time { return time.Time{} }
+func (n songName) IsDir() bool        { return false }
+func (n songName) Sys() interface{}   { return nil }
@@ -0,0 +1,105 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteM3U(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+	)
+
+	defer func() { shuffleAlbums = true }()
+	shuffleAlbums = false
+	tracks, err := newArtist(dirLibrary(root), filepath.Join(root, "Pixies")).Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeM3U(&buf, tracks); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#EXTM3U\n" +
+		"#EXTINF:-1,1 Debaser\n" + filepath.Join(root, "Pixies", "Doolittle", "1 Debaser.ogg") + "\n" +
+		"#EXTINF:-1,2 Tame\n" + filepath.Join(root, "Pixies", "Doolittle", "2 Tame.ogg") + "\n" +
+		"#EXTINF:-1,1 Bone Machine\n" + filepath.Join(root, "Pixies", "Surfer Rosa", "1 Bone Machine.ogg") + "\n"
+	if buf.String() != want {
+		t.Errorf("Expected the playlist\n%s\nbut got\n%s", want, buf.String())
+	}
+}
+
+func TestReadM3U(t *testing.T) {
+	playlist := "\uFEFF#EXTM3U\r\n" +
+		"#EXTINF:123,Pixies - Debaser\r\n" +
+		"/music/Pixies/Doolittle/1 Debaser.ogg\r\n" +
+		"\r\n" +
+		"# a comment\n" +
+		"Weezer/Blue/1 My Name Is Jonas.mp3\n" +
+		"../Other/Song.flac\n" +
+		"http://radio.example.com/stream\n"
+
+	paths, err := readM3U(strings.NewReader(playlist), "/home/bob/lists")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"/music/Pixies/Doolittle/1 Debaser.ogg",
+		filepath.Join("/home/bob/lists", "Weezer", "Blue", "1 My Name Is Jonas.mp3"),
+		filepath.Join("/home/bob", "Other", "Song.flac"),
+		"http://radio.example.com/stream",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected the paths %q, but got %q", want, paths)
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+	)
+	file := filepath.Join(root, "mix.m3u")
+	err := os.WriteFile(file, []byte("#EXTM3U\nWeezer/Blue/1 My Name Is Jonas.ogg\nPixies/Doolittle/2 Tame.ogg\nPixies/Doolittle/1 Debaser.ogg\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LocatePlaylist(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, ran := fakePlayer(t, "mpg123")
+	if err := m.Play(context.Background(), p, "tame"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"mpg123", filepath.Join(root, "Pixies", "Doolittle", "2 Tame.ogg")},
+		{"mpg123", filepath.Join(root, "Pixies", "Doolittle", "1 Debaser.ogg")},
+	}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("Expected to play %q, but played %q", want, *ran)
+	}
+
+	var buf bytes.Buffer
+	if err := m.List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "1 My Name Is Jonas.ogg\n2 Tame.ogg\n1 Debaser.ogg\n" {
+		t.Errorf("Unexpected listing: %q", buf.String())
+	}
+}
@@ -0,0 +1,345 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// matchRegexp is true iff patterns are regular expressions,
+// rather than literal text.
+var matchRegexp = false
+
+// maxTypos is the number of typos that a pattern may have and still
+// match. If it's 0, patterns must match exactly.
+var maxTypos = 0
+
+// matchCase is true iff patterns match only names with letters of
+// the same case.
+var matchCase = false
+
+// ignoreThe is true iff a leading "The" is ignored in names and
+// patterns, when matching and sorting them.
+var ignoreThe = false
+
+// matchTokens is true iff the words of patterns may match in any
+// order, rather than only as written.
+var matchTokens = false
+
+// maxScore, unless it's negative, is the worst score a match may
+// have; names fitting the pattern less well than that don't match.
+var maxScore = -1
+
+// excludeTerms are terms which things that are located must not
+// have in their names.
+var excludeTerms []string
+
+// typoPenalty is how much each typo worsens a match's score.
+const typoPenalty = 10
+
+// boundaryPenalty and midWordPenalty are how much a match's score
+// is worsened when it starts at a word, but not at the start of the
+// name, and when it starts within a word, respectively.
+const (
+	boundaryPenalty = 3
+	midWordPenalty  = 10
+)
+
+// checkPattern returns an error if pattern can't be matched,
+// e.g. because it isn't a valid regular expression.
+func checkPattern(pattern string) error {
+	if !matchRegexp {
+		return nil
+	}
+	_, err := compileRegexp(pattern)
+	if err != nil {
+		return newError("This isn't a valid regular expression: %q (%v)", pattern, err)
+	}
+	return nil
+}
+
+// find returns the index into fi of the FileInfo best matching
+// the given pattern, or -1 if none match. The empty pattern
+// matches the first FileInfo, so that playback starts at the beginning.
+func find(fi []os.FileInfo, pattern string) int {
+	all := findAll(fi, pattern)
+	if len(all) == 0 {
+		return -1
+	}
+	return all[0]
+}
+
+// findAll returns the indices into fi of all the FileInfos matching
+// the given pattern, best match first. Equally good matches stay in
+// the order they appear in fi. The empty pattern matches everything.
+// Matches scoring worse than maxScore are left out.
+func findAll(fi []os.FileInfo, pattern string) []int {
+	all, _ := findAllScored(fi, pattern)
+	return all
+}
+
+// findAllScored is findAll, but also returns the score of each match.
+func findAllScored(fi []os.FileInfo, pattern string) (all, scores []int) {
+	for i := range fi {
+		m := 0
+		if pattern != "" {
+			m = match(pattern, fi[i].Name())
+		}
+		if m < 0 || maxScore >= 0 && m > maxScore {
+			continue
+		}
+		all = append(all, i)
+		scores = append(scores, m)
+	}
+
+	sort.Stable(byScore{all, scores})
+	return all, scores
+}
+
+// findAllExcept is findAll, but leaves out the FileInfos whose names
+// contain any of the terms in not.
+func findAllExcept(fi []os.FileInfo, pattern string, not []string) []int {
+	all := findAll(fi, pattern)
+	kept := all[:0]
+	for _, i := range all {
+		if !containsAny(fi[i].Name(), not) {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// findBest returns the index into fi of the FileInfo best matching
+// the given pattern, and its score, leaving out the FileInfos whose
+// names contain any of the terms in not. The index is -1 if none match.
+// Of equally good matches, the first in fi is returned.
+func findBest(fi []os.FileInfo, pattern string, not []string) (index, score int) {
+	index, score = -1, -1
+	for i := range fi {
+		if containsAny(fi[i].Name(), not) {
+			continue
+		}
+		m := 0
+		if pattern != "" {
+			m = match(pattern, fi[i].Name())
+		}
+		if m >= 0 && (maxScore < 0 || m <= maxScore) && (index < 0 || m < score) {
+			index, score = i, m
+		}
+	}
+	return index, score
+}
+
+// containsAny returns true iff s contains any of terms, compared as
+// by match, ignoring case, punctuation, and accents.
+func containsAny(s string, terms []string) bool {
+	s = clean(strings.ToLower(norm.NFC.String(s)))
+	for _, t := range terms {
+		t = clean(strings.ToLower(norm.NFC.String(t)))
+		if t != "" && strings.Contains(s, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// byScore sorts indices by their scores.
+type byScore struct {
+	indices, scores []int
+}
+
+func (b byScore) Len() int           { return len(b.indices) }
+func (b byScore) Less(i, j int) bool { return b.scores[i] < b.scores[j] }
+func (b byScore) Swap(i, j int) {
+	b.indices[i], b.indices[j] = b.indices[j], b.indices[i]
+	b.scores[i], b.scores[j] = b.scores[j], b.scores[i]
+}
+
+// match returns a non-negative score iff s fits the pattern, a negative value
+// otherwise. One score is better than another if it has a lower value.
+func match(pattern, s string) int {
+	// Names may be stored composed (NFC) or decomposed (NFD), e.g. on
+	// macOS, and typed either way, so compare them composed.
+	pattern, s = norm.NFC.String(pattern), norm.NFC.String(s)
+	if matchRegexp {
+		return matchRegexpScore(pattern, s)
+	}
+
+	if !matchCase {
+		s, pattern = strings.ToLower(s), strings.ToLower(pattern)
+	}
+	s, pattern = withoutThe(clean(s)), withoutThe(clean(pattern))
+	if maxTypos > 0 {
+		return matchFuzzy(pattern, s)
+	}
+	if matchTokens {
+		return matchTokensScore(pattern, s)
+	}
+	p := position(pattern, s)
+	if p < 0 {
+		return -1
+	}
+	d := len(s) - len(pattern)
+	if d < 0 {
+		d = -d
+	}
+	return d + p
+}
+
+// position returns the penalty for where pattern best appears in s:
+// 0 at the start of s, or after only numbers, as with track numbers;
+// boundaryPenalty at the start of a later word; and midWordPenalty
+// elsewhere; or -1 if it doesn't appear.
+func position(pattern, s string) int {
+	best := -1
+	for i := 0; i <= len(s); i++ {
+		j := strings.Index(s[i:], pattern)
+		if j < 0 {
+			break
+		}
+		i += j
+		switch {
+		case strings.TrimLeft(s[:i], "0123456789 ") == "":
+			return 0
+		case s[i-1] == ' ':
+			best = boundaryPenalty
+		case best < 0:
+			best = midWordPenalty
+		}
+	}
+	return best
+}
+
+// clean returns s without any non-alphanumeric runes. Accented letters
+// are decomposed first, so that their accents are removed, too:
+// e.g. "Björk" becomes "Bjork". What remains is composed again, so
+// that the lengths of cleaned strings don't depend on how they were
+// originally normalized.
+func clean(s string) string {
+	buf := new(bytes.Buffer)
+	for _, r := range norm.NFD.String(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			_, _ = buf.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(buf.String())
+}
+
+// withoutThe returns s without a leading "The ", in any case,
+// if ignoreThe is set, e.g. "The Beatles" becomes "Beatles".
+func withoutThe(s string) string {
+	if ignoreThe && len(s) > 4 && strings.EqualFold(s[:4], "the ") {
+		return s[4:]
+	}
+	return s
+}
+
+// regexps caches compiled patterns, since the same one is
+// matched against many names.
+var regexps = map[string]*regexp.Regexp{}
+
+// compileRegexp returns pattern compiled as a regular expression,
+// which is case-insensitive unless matchCase is set.
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if !matchCase {
+		pattern = "(?i)" + pattern
+	}
+	if re, ok := regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps[pattern] = re
+	return re, nil
+}
+
+// matchRegexpScore is match for regular expression patterns.
+// Matches score better the earlier they start in s and the more
+// of s they cover.
+func matchRegexpScore(pattern, s string) int {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		return -1
+	}
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		return -1
+	}
+	return loc[0] + len(s) - (loc[1] - loc[0])
+}
+
+// matchTokensScore is match for patterns whose words may appear in s
+// in any order. Both pattern and s must already be cleaned. Every word
+// must appear in s, and matches score better the closer together the
+// words are and the less else there is in s.
+func matchTokensScore(pattern, s string) int {
+	words := strings.Fields(pattern)
+	first, last, n := len(s), 0, 0
+	for _, w := range words {
+		i := strings.Index(s, w)
+		if i < 0 {
+			return -1
+		}
+		first = min(first, i)
+		last = max(last, i+len(w))
+		n += len(w)
+	}
+	if len(words) == 0 {
+		return len(s)
+	}
+	return max(last-first-n, 0) + len(s) - n
+}
+
+// matchFuzzy is match for patterns which may have up to maxTypos
+// typos. Both pattern and s must already be cleaned. A match's score
+// is as for exact matches, plus typoPenalty for each typo.
+func matchFuzzy(pattern, s string) int {
+	t := typos(pattern, s)
+	if t > maxTypos {
+		return -1
+	}
+	d := len(s) - len(pattern)
+	if d < 0 {
+		d = -d
+	}
+	return d + t*typoPenalty
+}
+
+// typos returns the smallest Levenshtein distance between pattern and
+// any substring of s, i.e. the fewest insertions, deletions, and
+// substitutions that make pattern appear in s.
+func typos(pattern, s string) int {
+	p, t := []rune(pattern), []rune(s)
+
+	// prev and cur are rows of the distances between a prefix of p and
+	// the substrings of t ending at each index. Row 0 is all zeros, as
+	// the empty prefix is found anywhere for free.
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for i := 1; i <= len(p); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			sub := prev[j-1]
+			if p[i-1] != t[j-1] {
+				sub++
+			}
+			cur[j] = min(sub, prev[j]+1, cur[j-1]+1)
+		}
+		prev, cur = cur, prev
+	}
+
+	best := prev[0]
+	for _, d := range prev {
+		best = min(best, d)
+	}
+	return best
+}
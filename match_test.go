@@ -3,7 +3,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 func TestClean(t *testing.T) {
@@ -13,6 +19,9 @@ func TestClean(t *testing.T) {
 		{"Bob Dylan", "Bob Dylan"},
 		{"Bob Dylan & The Band", "Bob Dylan  The Band"},
 		{"AC/DC", "ACDC"},
+		{"Björk", "Bjork"},
+		{"Mötley Crüe", "Motley Crue"},
+		{"Sigur Rós", "Sigur Ros"},
 	}
 
 	for _, test := range tests {
@@ -32,7 +41,19 @@ func TestMatch(t *testing.T) {
 		{"acdc", "AC/DC", 0},
 		{"bob dylan", "Bob Dylan", 0},
 		{"bob dylan", "Bob Dylan & The Band", 10},
-		{"the band", "Bob Dylan & The Band", 11},
+		{"the band", "Bob Dylan & The Band", 14},
+		{"bjork", "Björk", 0},
+		{"motley crue", "Mötley Crüe", 0},
+		{"Sigur Rós", "Sigur Ros", 0},
+
+		// Matches at the start of a name, or of a word, are better.
+		{"the", "The Who", 4},
+		{"who", "The Who", 7},
+		{"band", "Bandwagon", 5},
+		{"band", "The Band", 7},
+		{"band", "Husband", 13},
+		{"band", "Husband Band", 11},
+		{"tangled", "01 Tangled Up in Blue", 14},
 	}
 
 	for _, test := range tests {
@@ -42,3 +63,401 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestFindPrefersBoundaries(t *testing.T) {
+	tests := []struct {
+		names   []string
+		pattern string
+		best    int
+	}{
+		{[]string{"Somebody That I Used to Know", "The Who"}, "the who", 1},
+		{[]string{"Thewho", "The Who Sell Out", "The Who"}, "the who", 2},
+		{[]string{"Husband", "The Band"}, "band", 1},
+		{[]string{"Tangled Up in Blue (Live)", "01 Tangled Up in Blue"}, "tangled up in blue", 1},
+	}
+	for _, test := range tests {
+		if i := find(fileInfos(test.names...), test.pattern); i != test.best {
+			t.Errorf("find(%q) in %q should pick %d, but got %d", test.pattern, test.names, test.best, i)
+		}
+	}
+}
+
+// fileInfos returns a named FileInfo for each name.
+func fileInfos(names ...string) []os.FileInfo {
+	fi := make([]os.FileInfo, len(names))
+	for i, n := range names {
+		fi[i] = songName(n)
+	}
+	return fi
+}
+
+func TestFind(t *testing.T) {
+	fi := fileInfos("1 Debaser.mp3", "2 Tame.mp3", "3 Wave of Mutilation.mp3")
+	tests := []struct {
+		pattern string
+		i       int
+	}{
+		{"", 0},
+		{"tame", 1},
+		{"wave of", 2},
+		{"debaser", 0},
+		{"monkey", -1},
+	}
+
+	for _, test := range tests {
+		i := find(fi, test.pattern)
+		if i != test.i {
+			t.Errorf("find(%q) should be %d, but got %d", test.pattern, test.i, i)
+		}
+	}
+
+	if i := find(nil, "tame"); i != -1 {
+		t.Error("find in nothing should be -1, but got", i)
+	}
+}
+
+func TestMatchRegexp(t *testing.T) {
+	defer func() { matchRegexp = false }()
+	matchRegexp = true
+
+	tests := []struct {
+		pattern, s string
+		score      int
+	}{
+		{"^[aeiou]", "AC/DC", 4},
+		{"^[aeiou]", "Bob Dylan", -1},
+		{"^the who$", "The Who", 0},
+		{"who", "The Who", 8},
+		{"d.lan", "Bob Dylan", 8},
+	}
+
+	for _, test := range tests {
+		s := match(test.pattern, test.s)
+		if s != test.score {
+			t.Error("Score for regexp match(", test.pattern, ",", test.s, ") should be", test.score, ", but got", s)
+		}
+	}
+}
+
+func TestLocateRegexp(t *testing.T) {
+	root := mkLibrary(t,
+		"Weezer/Blue/1.ogg",
+		"Weezer/Pinkerton/1.ogg",
+		"Weezer/Green/1.ogg",
+		"Pixies/Doolittle/1.ogg",
+	)
+	musicdirs = stringList{root}
+	defer func() { musicdirs = nil }()
+	defer func() { matchRegexp = false }()
+	matchRegexp = true
+
+	fi := fileInfos("Blue", "Pinkerton", "Green", "Doolittle")
+	if i := find(fi, "^(blue|green)$"); i != 0 {
+		t.Error("find should prefer the first of equally good matches, but got", i)
+	}
+	if i := find(fi, "ee"); i != 2 {
+		t.Error("find(ee) should pick Green, but got", i)
+	}
+
+	m, err := LocateAlbum("^p.*n$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || filepath.Base(m.Path()) != "Pinkerton" {
+		t.Error("Expected to find Pinkerton, but got", m)
+	}
+
+	if _, err := LocateAlbum("(unclosed"); err == nil {
+		t.Error("Locating an invalid regular expression should fail")
+	}
+	if _, err := LocateArtist("[z-a]"); err == nil {
+		t.Error("Locating an invalid regular expression should fail")
+	}
+}
+
+func TestTypos(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		typos      int
+	}{
+		{"bob dylan", "bob dylan", 0},
+		{"dylan", "bob dylan  the band", 0},
+		{"bob dilan", "bob dylan", 1},
+		{"bob dyln", "bob dylan  the band", 1},
+		{"weezr", "weezer", 1},
+		{"weezr", "ween", 2},
+		{"pixeis", "pixies", 2},
+		{"abc", "", 3},
+	}
+
+	for _, test := range tests {
+		n := typos(test.pattern, test.s)
+		if n != test.typos {
+			t.Errorf("typos(%q, %q) should be %d, but got %d", test.pattern, test.s, test.typos, n)
+		}
+	}
+}
+
+func TestFindFuzzy(t *testing.T) {
+	defer func() { maxTypos = 0 }()
+	fi := fileInfos("Bob Dylan & The Band", "Bob Dylan", "Bob Marley", "Ween", "Weezer", "Pixies")
+
+	tests := []struct {
+		pattern string
+		i       int
+	}{
+		{"bob dilan", 1},
+		{"bob dylan", 1},
+		{"dylan & the bnad", 0},
+		{"bob marly", 2},
+		{"weezr", 4},
+		{"wen", 3},
+		{"pixeis", 5},
+		{"the who", -1},
+	}
+
+	for _, test := range tests {
+		maxTypos = 0
+		if i := find(fi, test.pattern); i >= 0 && i != test.i {
+			t.Errorf("Without -fuzzy, find(%q) should be -1 or %d, but got %d", test.pattern, test.i, i)
+		}
+
+		maxTypos = 2
+		if i := find(fi, test.pattern); i != test.i {
+			t.Errorf("With -fuzzy 2, find(%q) should be %d, but got %d", test.pattern, test.i, i)
+		}
+	}
+}
+
+func TestMatchNormalization(t *testing.T) {
+	forms := []string{"Sigur Rós", "방탄소년단"}
+	for _, s := range forms {
+		nfc, nfd := norm.NFC.String(s), norm.NFD.String(s)
+		if nfc == nfd {
+			t.Fatalf("The NFC and NFD forms of %q should differ", s)
+		}
+		if m := match(nfc, nfd); m != 0 {
+			t.Errorf("The NFC and NFD forms of %q should match with score 0, but got %d", s, m)
+		}
+		if m := match(nfd, nfc); m != 0 {
+			t.Errorf("The NFD and NFC forms of %q should match with score 0, but got %d", s, m)
+		}
+	}
+
+	if m := match(norm.NFC.String("방탄"), norm.NFD.String("방탄소년단")); m != len("소년단") {
+		t.Errorf("Scores should count composed lengths, expected %d but got %d", len("소년단"), m)
+	}
+
+	defer func() { matchRegexp = false }()
+	matchRegexp = true
+	if m := match(norm.NFC.String("^sigur rós$"), norm.NFD.String("Sigur Rós")); m != 0 {
+		t.Error("An NFC regular expression should match an NFD name with score 0, but got", m)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	fi := fileInfos("Weezer", "Ween", "The Who", "Wee", "Ween")
+	tests := []struct {
+		pattern string
+		all     []int
+	}{
+		{"wee", []int{3, 1, 4, 0}},
+		{"ween", []int{1, 4}},
+		{"w", []int{3, 1, 4, 0, 2}},
+		{"", []int{0, 1, 2, 3, 4}},
+		{"pixies", nil},
+	}
+
+	for _, test := range tests {
+		all := findAll(fi, test.pattern)
+		if !reflect.DeepEqual(all, test.all) {
+			t.Errorf("findAll(%q) should be %v, but got %v", test.pattern, test.all, all)
+		}
+		i := find(fi, test.pattern)
+		if len(test.all) == 0 && i != -1 || len(test.all) > 0 && i != test.all[0] {
+			t.Errorf("find(%q) should be the first of %v, but got %d", test.pattern, test.all, i)
+		}
+		if b, score := findBest(fi, test.pattern, nil); b != i || i >= 0 && test.pattern != "" && score != match(test.pattern, fi[i].Name()) {
+			t.Errorf("findBest(%q) should be %d, with its score, but got %d, scoring %d", test.pattern, i, b, score)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	defer func() { maxScore = -1 }()
+	fi := fileInfos("Weezer", "Ween", "The Who")
+	tests := []struct {
+		pattern  string
+		maxScore int
+		best     int
+	}{
+		{"wee", -1, 1},
+		{"wee", 1, 1},
+		{"wee", 0, -1},
+		{"eez", -1, 0},
+		{"eez", 12, -1},
+		{"eez", 13, 0},
+		{"who", 3, -1},
+		{"who", 7, 2},
+		{"ween", 0, 1},
+		{"", 0, 0},
+	}
+	for _, test := range tests {
+		maxScore = test.maxScore
+		if i := find(fi, test.pattern); i != test.best {
+			t.Errorf("find(%q), with the threshold %d, should be %d, but got %d", test.pattern, test.maxScore, test.best, i)
+		}
+		if i, _ := findBest(fi, test.pattern, nil); i != test.best {
+			t.Errorf("findBest(%q), with the threshold %d, should be %d, but got %d", test.pattern, test.maxScore, test.best, i)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		score      int
+	}{
+		{"band the dylan bob", "Bob Dylan & The Band", 8},
+		{"bob dylan", "Bob Dylan & The Band", 12},
+		{"who the", "The Who", 2},
+		{"the who", "The Who", 2},
+		{"dylan band", "Bob Dylan & The Band", 16},
+		{"dylan bob", "Bob Dylan", 2},
+		{"dylan springsteen", "Bob Dylan", -1},
+		{"who the", "The Band", -1},
+	}
+
+	defer func() { matchTokens = false }()
+	matchTokens = true
+	for _, test := range tests {
+		s := match(test.pattern, test.s)
+		if s != test.score {
+			t.Errorf("With -tokens, match(%q, %q) should be %d, but got %d", test.pattern, test.s, test.score, s)
+		}
+	}
+
+	matchTokens = false
+	if s := match("who the", "The Who"); s >= 0 {
+		t.Error("Without -tokens, words out of order shouldn't match, but got", s)
+	}
+
+	matchTokens = true
+	fi := fileInfos("The Band", "Bob Dylan", "Bob Dylan & The Band", "The Who")
+	if i := find(fi, "the band dylan"); i != 2 {
+		t.Error("find(the band dylan) should pick Bob Dylan & The Band, but got", i)
+	}
+}
+
+func TestFindExcept(t *testing.T) {
+	fi := fileInfos("Unplugged (Live)", "Live Through This", "Live Acoustic Sessions")
+	tests := []struct {
+		pattern string
+		not     []string
+		all     []int
+	}{
+		{"live", nil, []int{0, 1, 2}},
+		{"live", []string{"acoustic"}, []int{0, 1}},
+		{"live", []string{"ACOUSTIC", "unplugged"}, []int{1}},
+		{"live", []string{"live"}, nil},
+		{"live", []string{""}, []int{0, 1, 2}},
+	}
+	for _, test := range tests {
+		all := findAllExcept(fi, test.pattern, test.not)
+		if len(all) == 0 && len(test.all) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(all, test.all) {
+			t.Errorf("findAllExcept(%q, %q) should be %v, but got %v", test.pattern, test.not, test.all, all)
+		}
+	}
+
+	l := mapLibrary(
+		"Nirvana/Unplugged (Live Acoustic)/1 About a Girl.ogg",
+		"Nirvana/From the Muddy Banks of the Wishkah (Live)/1 Intro.ogg",
+	)
+	m, err := l.LocateAlbum("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || filepath.Base(m.Path()) != "Unplugged (Live Acoustic)" {
+		t.Error("Expected live to find Unplugged, but got", m)
+	}
+
+	defer func() { excludeTerms = nil }()
+	excludeTerms = []string{"acoustic"}
+	m, err = l.LocateAlbum("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || filepath.Base(m.Path()) != "From the Muddy Banks of the Wishkah (Live)" {
+		t.Error("Expected -not acoustic to leave the other live album, but got", m)
+	}
+}
+
+func TestMatchCase(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"The Who", "The Who", true},
+		{"the who", "The Who", false},
+		{"Björk", "Bjork", true},
+		{"björk", "Bjork", false},
+		{"AC/DC", "AC/DC", true},
+		{"acdc", "AC/DC", false},
+	}
+
+	defer func() { matchCase, matchRegexp = false, false }()
+	for _, test := range tests {
+		if s := match(test.pattern, test.s); s < 0 {
+			t.Errorf("match(%q, %q) should match without -case-sensitive, but got %d", test.pattern, test.s, s)
+		}
+		matchCase = true
+		if s := match(test.pattern, test.s); (s >= 0) != test.match {
+			t.Errorf("With -case-sensitive, match(%q, %q) should be %v, but got %d", test.pattern, test.s, test.match, s)
+		}
+		matchCase = false
+	}
+
+	matchRegexp = true
+	if s := match("^the", "The Who"); s < 0 {
+		t.Error("The regexp ^the should match The Who without -case-sensitive, but got", s)
+	}
+	matchCase = true
+	if s := match("^the", "The Who"); s >= 0 {
+		t.Error("With -case-sensitive, the regexp ^the shouldn't match The Who, but got", s)
+	}
+}
+
+func TestIgnoreThe(t *testing.T) {
+	defer func() { ignoreThe = false }()
+	ignoreThe = true
+
+	tests := []struct {
+		pattern, s string
+		score      int
+	}{
+		{"beatles", "The Beatles", 0},
+		{"the beatles", "The Beatles", 0},
+		{"the beatles", "Beatles", 0},
+		{"the", "The The", 0},
+		{"theatre", "Theatre of Tragedy", 11},
+	}
+	for _, test := range tests {
+		if s := match(test.pattern, test.s); s != test.score {
+			t.Errorf("With -ignore-the, match(%q, %q) should be %d, but got %d", test.pattern, test.s, test.score, s)
+		}
+	}
+
+	names := []string{"Talking Heads", "The Beatles", "Blur", "The Who"}
+	sort.SliceStable(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+	want := []string{"The Beatles", "Blur", "Talking Heads", "The Who"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("With -ignore-the, names should sort as %q, but got %q", want, names)
+	}
+
+	if i := initial("The Beatles"); i != "B" {
+		t.Errorf("With -ignore-the, The Beatles should be under B, but got %s", i)
+	}
+}
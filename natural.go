@@ -0,0 +1,63 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// sortNatural sorts files by their names, in natural order.
+func sortNatural(files []os.FileInfo) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return naturalLess(files[i].Name(), files[j].Name())
+	})
+}
+
+// naturalLess returns true iff a comes before b in natural order,
+// which ignores case and compares runs of digits by their value,
+// so that e.g. "Track 2" comes before "track 10". With ignoreThe,
+// it ignores a leading "The", too.
+func naturalLess(a, b string) bool {
+	x, y := strings.ToLower(withoutThe(a)), strings.ToLower(withoutThe(b))
+	for x != "" && y != "" {
+		if isDigit(x[0]) && isDigit(y[0]) {
+			i, j := digits(x), digits(y)
+			m, n := strings.TrimLeft(x[:i], "0"), strings.TrimLeft(y[:j], "0")
+			if len(m) != len(n) {
+				return len(m) < len(n)
+			}
+			if m != n {
+				return m < n
+			}
+			x, y = x[i:], y[j:]
+			continue
+		}
+
+		r, i := utf8.DecodeRuneInString(x)
+		s, j := utf8.DecodeRuneInString(y)
+		if r != s {
+			return r < s
+		}
+		x, y = x[i:], y[j:]
+	}
+	if x != "" || y != "" {
+		return x == ""
+	}
+	return a < b
+}
+
+// digits returns the length of the run of digits at the start of s.
+func digits(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,70 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"2 - b.mp3", "10 - c.mp3", true},
+		{"10 - c.mp3", "2 - b.mp3", false},
+		{"Track 2", "track 10", true},
+		{"track 02", "Track 1", false},
+		{"Disc 1", "Disc 01", false},
+		{"apple", "Zebra", true},
+		{"Zebra", "apple", false},
+		{"CD1", "CD1 Bonus", true},
+		{"CD9", "CD10", true},
+		{"same", "same", false},
+	}
+	for _, test := range tests {
+		if less := naturalLess(test.a, test.b); less != test.less {
+			t.Errorf("naturalLess(%q, %q) should be %v, but got %v", test.a, test.b, test.less, less)
+		}
+	}
+}
+
+func TestSortNatural(t *testing.T) {
+	l := mapLibrary(
+		"10 - c.mp3",
+		"2 - b.mp3",
+		"1 - a.mp3",
+		"CD10/1.mp3",
+		"CD2/1.mp3",
+		"cd1/1.mp3",
+	)
+
+	files, err := l.subFiles(l.root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1 - a.mp3", "2 - b.mp3", "10 - c.mp3"}
+	if got := names(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("subFiles should be in the order %q, but got %q", want, got)
+	}
+
+	dirs, err := l.subDirs(l.root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"cd1", "CD2", "CD10"}
+	if got := names(dirs); !reflect.DeepEqual(got, want) {
+		t.Errorf("subDirs should be in the order %q, but got %q", want, got)
+	}
+}
+
+// names returns the names of files.
+func names(files []os.FileInfo) []string {
+	var ns []string
+	for _, f := range files {
+		ns = append(ns, f.Name())
+	}
+	return ns
+}
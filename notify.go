@@ -0,0 +1,80 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// A notifier announces each track as it starts, given the names
+// of its artist, album, and song.
+type notifier interface {
+	Notify(artist, album, song string) error
+}
+
+// A desktopNotifier announces tracks with desktop notifications,
+// shown by notify-send, or by osascript on macOS.
+type desktopNotifier struct {
+	goos string
+
+	// run runs a command to completion. It is replaced in tests.
+	run func(*exec.Cmd) error
+}
+
+func newDesktopNotifier(goos string) *desktopNotifier {
+	return &desktopNotifier{goos: goos, run: (*exec.Cmd).Run}
+}
+
+func (n *desktopNotifier) Notify(artist, album, song string) error {
+	title, text := song, artist+" – "+album
+	if n.goos == "darwin" {
+		script := "display notification " + appleScriptString(text) + " with title " + appleScriptString(title)
+		return n.run(exec.Command("osascript", "-e", script))
+	}
+	return n.run(exec.Command("notify-send", "--app-name=splay", title, text))
+}
+
+// appleScriptString returns s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// A statusFile announces tracks by writing a line naming each one,
+// e.g. "Pixies – Doolittle – Debaser", to the file at its path, in place
+// of the last. If it's a named pipe, each line is written after the last.
+type statusFile string
+
+func (f statusFile) Notify(artist, album, song string) error {
+	return f.write(artist + " – " + album + " – " + song + "\n")
+}
+
+// Clear empties the file, or writes an empty line to a named pipe,
+// to say that nothing is playing.
+func (f statusFile) Clear() error {
+	if fi, err := os.Stat(string(f)); err == nil && fi.Mode()&fs.ModeNamedPipe != 0 {
+		return f.write("\n")
+	}
+	return f.write("")
+}
+
+// write replaces the contents of the file with s. A named pipe is
+// only written to if something is reading from it, so that splay
+// doesn't wait for one.
+func (f statusFile) write(s string) error {
+	file, err := os.OpenFile(string(f), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NONBLOCK, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, s)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
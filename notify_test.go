@@ -0,0 +1,115 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// A fakeNotifier records the notifications it's asked for,
+// and fails them all if err isn't nil.
+type fakeNotifier struct {
+	notes [][3]string
+	err   error
+}
+
+func (f *fakeNotifier) Notify(artist, album, song string) error {
+	f.notes = append(f.notes, [3]string{artist, album, song})
+	return f.err
+}
+
+func TestDesktopNotifier(t *testing.T) {
+	tests := []struct {
+		goos string
+		args []string
+	}{
+		{"linux", []string{"notify-send", "--app-name=splay", `Say "Hi"`, "Pixies – Doolittle"}},
+		{"freebsd", []string{"notify-send", "--app-name=splay", `Say "Hi"`, "Pixies – Doolittle"}},
+		{"darwin", []string{"osascript", "-e", `display notification "Pixies – Doolittle" with title "Say \"Hi\""`}},
+	}
+	for _, test := range tests {
+		var ran []string
+		n := newDesktopNotifier(test.goos)
+		n.run = func(c *exec.Cmd) error {
+			ran = c.Args
+			return nil
+		}
+		if err := n.Notify("Pixies", "Doolittle", `Say "Hi"`); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ran, test.args) {
+			t.Errorf("On %s, expected to run %q, but ran %q", test.goos, test.args, ran)
+		}
+	}
+}
+
+func TestPlayNotify(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+	)
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+
+	for _, fail := range []error{nil, errors.New("no notification daemon")} {
+		n := &fakeNotifier{err: fail}
+		p, ran := fakePlayer(t, "mpg123")
+		p.Notifiers = []notifier{n}
+		if err := doolittle.Play(context.Background(), p, ""); err != nil {
+			t.Fatal("Notifying shouldn't stop playback, but got", err)
+		}
+		want := [][3]string{
+			{"Pixies", "Doolittle", "1 Debaser"},
+			{"Pixies", "Doolittle", "2 Tame"},
+		}
+		if !reflect.DeepEqual(n.notes, want) {
+			t.Errorf("Expected the notifications %q, but got %q", want, n.notes)
+		}
+		if len(*ran) != 2 {
+			t.Errorf("Expected to play both tracks, but played %q", *ran)
+		}
+	}
+}
+
+func TestStatusFile(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+	)
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+	status := filepath.Join(t.TempDir(), "playing")
+
+	var seen []string
+	p, _ := fakePlayer(t, "mpg123")
+	p.Notifiers = []notifier{statusFile(status)}
+	p.run = func(*exec.Cmd) error {
+		b, err := os.ReadFile(status)
+		if err != nil {
+			return err
+		}
+		seen = append(seen, string(b))
+		return nil
+	}
+	if err := doolittle.Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Pixies – Doolittle – 1 Debaser\n",
+		"Pixies – Doolittle – 2 Tame\n",
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Expected the status file to say %q as each track played, but it said %q", want, seen)
+	}
+
+	if err := statusFile(status).Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(status); err != nil || len(b) != 0 {
+		t.Errorf("Expected the status file to be cleared, but it says %q, %v", b, err)
+	}
+}
@@ -0,0 +1,44 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestStatusFIFO(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "playing")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skip("Can't make a named pipe:", err)
+	}
+
+	if err := statusFile(fifo).Notify("Pixies", "Doolittle", "Debaser"); err == nil {
+		t.Error("Expected writing to a named pipe with no reader to fail, rather than wait")
+	}
+
+	r, err := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := statusFile(fifo).Notify("Pixies", "Doolittle", "Debaser"); err != nil {
+		t.Fatal(err)
+	}
+	if err := statusFile(fifo).Clear(); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Pixies – Doolittle – Debaser\n\n"; string(b[:n]) != want {
+		t.Errorf("Expected to read %q from the pipe, but got %q", want, b[:n])
+	}
+}
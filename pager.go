@@ -0,0 +1,68 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A pager writes to w, pausing after every n lines until
+// the user presses Enter.
+type pager struct {
+	w     io.Writer
+	in    *bufio.Reader
+	n     int
+	lines int
+}
+
+func newPager(w io.Writer, in io.Reader, n int) io.Writer {
+	return &pager{w: w, in: bufio.NewReader(in), n: n}
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		if p.n > 0 && p.lines == p.n {
+			p.wait()
+			p.lines = 0
+		}
+
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			n, err := p.w.Write(b)
+			return written + n, err
+		}
+
+		n, err := p.w.Write(b[:i+1])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[i+1:]
+		p.lines++
+	}
+	return written, nil
+}
+
+// wait prompts for and reads a line of input. If there's nothing
+// left to read, paging is turned off.
+func (p *pager) wait() {
+	fmt.Fprint(p.w, "-- more --")
+	if _, err := p.in.ReadString('\n'); err != nil {
+		p.n = 0
+		fmt.Fprintln(p.w)
+	}
+}
+
+// isTerminal returns true iff f refers to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
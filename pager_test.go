@@ -0,0 +1,34 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPager(t *testing.T) {
+	var out bytes.Buffer
+	p := newPager(&out, strings.NewReader("\n\n"), 2)
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintln(p, i)
+	}
+
+	want := "1\n2\n-- more --3\n4\n-- more --5\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, but got %q", want, out.String())
+	}
+}
+
+func TestPagerEOF(t *testing.T) {
+	var out bytes.Buffer
+	p := newPager(&out, strings.NewReader(""), 1)
+	fmt.Fprint(p, "1\n2\n3\n")
+
+	want := "1\n-- more --\n2\n3\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, but got %q", want, out.String())
+	}
+}
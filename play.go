@@ -3,63 +3,1005 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
+var showVersion = flag.Bool("version", false, "Print the version of splay and exit")
+var musicdirs stringList
 var byartist = flag.Bool("artist", true, "Prefer artist name matches")
 var byalbum = flag.Bool("album", false, "Prefer album name matches")
+var search = flag.Bool("search", false, "Play whatever matches best, be it an artist, an album, or a track; of equally good matches, the most specific")
+var bytrack = flag.Bool("track", false, "Match a single track by name")
+var regex = flag.Bool("regex", false, "Treat patterns as regular expressions")
+var not stringList
+var repeat = repeatFlag(1)
+var colors = colorFlag("auto")
+var caseSensitive = flag.Bool("case-sensitive", false, "Match patterns only to names with the same upper- and lower-case letters")
+var noThe = flag.Bool("ignore-the", false, "Ignore a leading \"The\" in names, when matching and sorting them")
+var tagsFlag = flag.Bool("tags", false, "Match and list tracks by the titles in their tags, rather than their file names")
+var tokens = flag.Bool("tokens", false, "Let the words of patterns match in any order")
+var fuzzy = flag.Int("fuzzy", 0, "Tolerate up to `n` typos in patterns")
+var threshold = flag.Int("threshold", -1, "Reject matches worse than this `score`, which counts the letters a name has beyond the pattern, plus 3 if the pattern starts a later word of it, or 10 if it starts mid-word, and 10 for each typo; -1 accepts any match")
+var candidates = flag.Bool("candidates", false, "If more than one thing matches, print them all instead of playing the best")
+var noPrompt = flag.Bool("no-prompt", false, "If more than one thing matches, play the best instead of asking which")
 var start = flag.String("from", "", "The album or track to start playing from")
+var end = flag.String("to", "", "The track of an album to stop playing after")
 var list = flag.Bool("list", false, "Print the playlist instead of playing it")
+var durations = flag.Bool("durations", false, "With -list, print how long each track of an album is, and the whole album")
+var total = flag.Bool("total", false, "Print how long everything would take to play, instead of playing it")
+var count = flag.Bool("count", false, "Print how many albums and tracks would be played, instead of playing them")
+var playlistFile = flag.String("playlist", "", "Play the tracks in this M3U playlist `file`")
+var m3u = flag.Bool("m3u", false, "With -list, print the playlist as an extended M3U file")
+var jsonList = flag.Bool("json", false, "With -list, print the artist, albums, and tracks as JSON")
+var player = flag.String("player", "", "The `command` which plays a track, given its path; by default, the first of afplay (on macOS), mpv, mpg123, ffplay, or cvlc found")
+var volume = flag.Int("volume", 100, "Play at this `percent` of the full volume, if the player allows it")
+var playerMap = flag.String("player-map", "", "A comma-separated `list` of extensions and the commands which play them instead of -player, e.g. flac=ogg123,mp3=mpg123")
+var withHidden = flag.Bool("include-hidden", false, "Don't ignore dotfiles and the likes of Thumbs.db and desktop.ini")
+var exts = flag.String("ext", "", "A comma-separated `list` of the extensions of audio files, replacing the usual ones")
+var shuffled = flag.Bool("shuffle", true, "Play albums in random order; -shuffle=false plays them in order of their names")
+var chrono = flag.Bool("chronological", false, "Play an artist's albums in order of the years their names start with, e.g. 1996 Pinkerton; implies -shuffle=false")
+var reverseOrder = flag.Bool("reverse", false, "Play albums and tracks in reverse order; with -from, the ones from there on")
+var firstOnlyFlag = flag.Bool("first-only", false, "When playing an artist, play only the first track of each album")
+var shuffledTracks = flag.Bool("shuffle-tracks", false, "Play the tracks of each album in random order")
+var seed = flag.Int64("seed", 0, "Seed the shuffling, so that the same seed always gives the same order")
+var repeatTrack = flag.Int("repeat-track", 1, "Play a single track, chosen with -track, `n` times; 0 means forever")
+var batch = flag.Bool("batch", false, "Run the player just once, with every track, for players which accept more than one file")
+var batchArgs = flag.String("batch-args", "", "With -batch, a comma-separated `list` of extensions and extra arguments for the player when playing tracks with them, e.g. flac=--gapless-audio=yes")
+var resumeFlag = flag.Bool("resume", false, "Play what was left when splay was last stopped partway through, from the track it stopped in; with mpv, from where in the track it stopped")
+var dryRunFlag = flag.Bool("dry-run", false, "Print the player command for each track instead of running it")
+var notify = flag.Bool("notify", false, "Show a desktop notification as each track starts, with notify-send, or osascript on macOS")
+var statusPath = flag.String("status-file", "", "Write the name of each track to this `file`, or named pipe, as it starts")
+var scrobble = flag.Bool("scrobble", false, "Scrobble each track played to Last.fm, with the API key, secret, and session key in $SPLAY_LASTFM_KEY, $SPLAY_LASTFM_SECRET, and $SPLAY_LASTFM_SESSION")
+var historyPath = flag.String("history", "", "Append each track played to this `file`, instead of splay/history.tsv in $XDG_DATA_HOME, or ~/.local/share")
+var noHistory = flag.Bool("no-history", false, "Don't keep a history of the tracks played, or count how many times each is")
+var stats = flag.Int("stats", 0, "Print the `n` tracks played the most, and how many times each was")
+var freshFor = flag.Duration("fresh", 0, "When shuffling tracks, skip those played within this `duration`, e.g. 24h, according to the history")
+var weighted = flag.Bool("weighted-shuffle", false, "When shuffling tracks, favor those played fewer times, according to the play counts")
+var rate = flag.Int("rate", 0, "Rate the track at the path given, or matching the pattern, from 1 to 5; 0 forgets its rating")
+var minRatingFlag = flag.Int("min-rating", 0, "Only play tracks rated at least this, from 1 to 5")
+var check = flag.Bool("check", false, "Check how the Music folder is laid out, and report any problems, such as albums without tracks")
+var summaryFlag = flag.Bool("summary", false, "Print how many artists, albums, and tracks there are, and which artist has the most tracks")
+var exportFormat = flag.String("export", "", "Print a record of every track in the library, with its artist, album, and path, as `csv` or json")
+var watchLib = flag.Bool("watch", false, "While playing, notice artists and albums being added to or removed from the library, e.g. with -serve or -repeat")
+var interactive = flag.Bool("i", false, "Read commands, such as \"play weezer\" or \"skip\", from a prompt; type help to see them all")
+var queueFlag = flag.Bool("queue", false, "Play the things matching each argument, rather than all of them together, one after another, e.g. -queue \"weezer blue\" \"pixies doolittle\"")
+var mustMatch = flag.Bool("must-match", false, "With -queue, stop if nothing matches one of the arguments, rather than skipping it")
+var saveAs = flag.String("save-as", "", "Save the tracks matched as the playlist with this `name`, rather than playing them")
+var playList = flag.String("play-list", "", "Play the playlist with this `name`, saved by -save-as")
+var showPlaylists = flag.Bool("playlists", false, "Print the names of the playlists saved by -save-as")
+var listPaths = flag.Bool("path", false, "With -list, print the full path of each track, rather than the names of things")
+var newest = flag.Bool("newest", false, "Play the album added to the library most recently")
+var random = flag.Bool("random", false, "Play an album picked at random, or an artist, with -artist")
+var spread = flag.Bool("spread", true, "With -shuffle-all, keep the tracks of each artist apart, so the same artist rarely plays twice in a row")
+var completion = flag.String("completion", "", "Print a script which completes the names of artists and albums in the `shell`, bash or zsh, e.g. source <(splay -completion bash)")
+var serveAddr = flag.String("serve", "", "Serve HTTP at this `address`, e.g. :8080, to see the track playing (GET /now), skip it (POST /skip), or stop (POST /stop)")
+var progress = flag.Bool("progress", false, "While each track plays, show how much of it has played, and how much is left, if its length can be told")
 var tracks = flag.Bool("tracks", false, "Print the name of each track before it is played")
+var quiet = flag.Bool("quiet", false, "Print nothing but errors and what was asked for, e.g. with -list")
+var maxTracks = flag.Int("max", 0, "Stop after playing `n` tracks; 0 means no limit")
+var stopAfter = flag.Duration("stop-after", 0, "Stop at the end of the track playing once `duration` has passed, e.g. 30m")
+var keepGoing = flag.Bool("keep-going", false, "If a track fails to play, say so and play the next one, instead of stopping")
+var gap = flag.Duration("gap", 0, "Wait for `duration` between tracks, e.g. 2s")
+var page = flag.Int("page", 0, "Pause after every `n` lines of a listing, when printing to a terminal")
+var browse = flag.Bool("browse", false, "Print every artist, grouped by first letter, instead of playing anything")
+var confirm = flag.Bool("confirm", false, "Ask before playing anything")
+var yes = flag.Bool("yes", false, "Never ask before playing, even for large selections")
+var byDecade = flag.String("decade", "", "Only play albums from this decade, e.g. 1990s, across the library or an artist")
+var albumBlocks = flag.Bool("album-blocks", false, "Play every album in the library, one whole album at a time, in random order")
+var shuffleAll = flag.Bool("shuffle-all", false, "Play every track in the library, in random order; with -album-blocks, keep albums together")
+
+// version is the version of splay. Builds can set it with
+// -ldflags "-X main.version=…".
+var version = "devel"
+
+func init() {
+	flag.Var(&musicdirs, "dir", "A music `folder`, overriding $SPLAY_MUSIC_DIR and ~/Music; may be repeated")
+	flag.Var(&not, "not", "Don't play anything whose name contains this `term`; may be repeated")
+	flag.Var(&repeat, "repeat", "Play everything over and over; -repeat=n plays it `n` times")
+	flag.Var(&colors, "color", "Color the names of artists and albums, and of the track playing: `when`, auto, always, or never; auto colors them when printing to a terminal")
+}
+
+// A stringList is a flag which may be given more than once,
+// collecting each value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// A repeatFlag is how many times to play everything, where 0 means
+// forever. It may be given without a value, as -repeat, to mean forever.
+type repeatFlag int
+
+func (r *repeatFlag) String() string {
+	return strconv.Itoa(int(*r))
+}
+
+func (r *repeatFlag) Set(s string) error {
+	if s == "true" {
+		*r = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return newError("-repeat should be a number of times, like -repeat=3, but got %q", s)
+	}
+	*r = repeatFlag(n)
+	return nil
+}
+
+func (r *repeatFlag) IsBoolFlag() bool {
+	return true
+}
+
+// Selections with more than confirmLimit tracks aren't played
+// until the user confirms them, or at all if stdin isn't a terminal.
+const confirmLimit = 500
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		printQuickCompletions(logs.Out, os.Args[2:])
+		return
+	}
 	flag.Parse()
+	commandLine = givenFlags(flag.CommandLine)
+	if err := loadConfig(flag.CommandLine); err != nil {
+		logs.Error(err)
+		os.Exit(1)
+	}
+	logs.Quiet = *quiet
+	ignoreThe = *noThe
+	includeHidden = *withHidden
+
+	if *showVersion {
+		printVersion(logs.Out)
+		return
+	}
+
+	if *completion != "" {
+		script, err := completionScript(*completion)
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		fmt.Fprint(logs.Out, script)
+		return
+	}
+
+	if *browse {
+		if err := Browse(logs.Out); err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *stats > 0 {
+		path, err := defaultCounts()
+		if err == nil {
+			err = printStats(logs.Out, playCounts(path), *stats)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	if flag.NArg() == 0 {
-		fmt.Fprintln(os.Stderr, "Please provide the name of the thing to play.")
+	if isFlagSet("rate") {
+		if err := rateTrack(*rate, strings.Join(flag.Args(), " ")); err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *chrono && isFlagSet("shuffle") && *shuffled {
+		logs.Error(newError("-chronological and -shuffle can't be used together."))
+		os.Exit(1)
+	}
+	chronological = *chrono
+	shuffleAlbums = *shuffled && !chronological
+	shuffleTracks = *shuffledTracks
+	firstOnly = *firstOnlyFlag
+	spreadArtists = *spread
+	reversed = *reverseOrder
+	if isFlagConfigured("seed") {
+		shuffleSeed = *seed
+	}
+	if *minRatingFlag > 0 {
+		path, err := defaultRatings()
+		if err == nil {
+			trackRatings, err = ratings(path).Read()
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		minRating = *minRatingFlag
+	}
+	if *weighted {
+		path, err := defaultCounts()
+		if err == nil {
+			shufflePlays, err = playCounts(path).Read()
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+	}
+	if *freshFor > 0 {
+		path, err := historyFileName()
+		if err == nil {
+			stale, err = recentlyPlayed(path, time.Now().Add(-*freshFor))
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+	}
+
+	matchRegexp = *regex
+	maxTypos = *fuzzy
+	maxScore = *threshold
+	matchTokens = *tokens
+	matchCase = *caseSensitive
+	useTags = *tagsFlag
+	excludeTerms = not
+	for _, p := range []string{*start, *end} {
+		if err := checkPattern(p); err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+	}
+
+	useColor = colors.enabled(isTerminal(os.Stdout), os.Getenv("NO_COLOR"))
+	listJSON = *jsonList
+	listDurations = *durations
+
+	if *exts != "" {
+		audioExts = parseExts(*exts)
+	}
+
+	if *byDecade != "" {
+		d, err := parseDecade(*byDecade)
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		decade = d
+	}
+
+	if *check {
+		lib, err := DefaultLibrary()
+		if err == nil {
+			err = printCheck(logs.Out, lib)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *exportFormat != "" {
+		lib, err := DefaultLibrary()
+		if err == nil {
+			err = export(logs.Out, lib, *exportFormat)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *summaryFlag {
+		lib, err := DefaultLibrary()
+		if err == nil {
+			err = printSummary(logs.Out, lib)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *showPlaylists {
+		dir, err := playlistDir()
+		if err == nil {
+			err = printPlaylists(logs.Out, dir)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *playList != "" {
+		dir, err := playlistDir()
+		if err == nil {
+			*playlistFile, err = playlistFileIn(dir, *playList)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+	}
+
+	if *interactive {
+		lib, err := DefaultLibrary()
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		p, err := configurePlayer()
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		p.Lib = lib
+		if *watchLib {
+			w := lib.watch(5*time.Second, 2*time.Second)
+			defer w.Stop()
+		}
+		ctx, _ := handleSignals(p.Skip)
+		err = newSession(lib, p, logs.Out).run(ctx, os.Stdin)
+		flushScrobblers(p.Scrobblers, 5*time.Second)
+		if err == context.Canceled {
+			os.Exit(1)
+		}
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() == 0 && !*albumBlocks && !*shuffleAll && decade == 0 && *playlistFile == "" && !*newest && !*random && !*resumeFlag {
+		fmt.Fprintln(logs.Err, "Please provide the name of the thing to play.")
 		os.Exit(1)
 	}
 
 	pattern := strings.Join(flag.Args(), " ")
-	m, err := locate(pattern)
+	var m Music
+	var err error
+	var point resumePoint
+	if *resumeFlag {
+		var file string
+		file, err = defaultResume()
+		if err == nil {
+			point, err = loadResume(file)
+		}
+		if err == nil {
+			m = newPlaylist(point.Paths)
+		}
+	} else if *queueFlag {
+		m, err = locateAll(flag.Args(), locate, *mustMatch)
+	} else {
+		m, err = locate(pattern)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		logs.Error(err)
 		os.Exit(1)
 	}
 	if m == nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to find %q\n", pattern)
+		logs.Error(newError("Failed to find %q", pattern))
 		os.Exit(1)
 	}
 
+	if *random {
+		logs.Info(relName(m))
+	}
+
+	if *end != "" {
+		a, ok := m.(*album)
+		if !ok {
+			logs.Error(newError("-to only works when playing an album."))
+			os.Exit(1)
+		}
+		a.end = *end
+	}
+
+	if *batch && isFlagSet("repeat") {
+		logs.Error(newError("-batch and -repeat can't be used together."))
+		os.Exit(1)
+	}
+	times := int(repeat)
+	if isFlagSet("repeat-track") {
+		if _, ok := m.(*track); !ok {
+			logs.Error(newError("-repeat-track only works when playing a single track, e.g. with -track."))
+			os.Exit(1)
+		}
+		if *batch || isFlagSet("repeat") {
+			logs.Error(newError("-repeat-track can't be used with -batch or -repeat."))
+			os.Exit(1)
+		}
+		times = *repeatTrack
+	}
+
+	if *saveAs != "" {
+		if err := saveSelection(m, *start, *saveAs); err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *count {
+		if err := printCount(logs.Out, m, *start); err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *total {
+		if err := printTotal(logs.Out, m, *start); err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *list {
-		err = m.List(*start)
+		w := logs.Out
+		if *page > 0 && isTerminal(os.Stdout) {
+			w = newPager(logs.Out, os.Stdin, *page)
+		}
+		if *m3u {
+			var paths []string
+			paths, err = m.Tracks(*start)
+			if err == nil {
+				err = writeM3U(w, paths)
+			}
+		} else if *listPaths {
+			err = writePaths(w, m, *start)
+		} else {
+			err = m.List(w, *start)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			logs.Error(err)
 			os.Exit(1)
 		}
 		return
 	}
 
-	err = m.Play(*start, *tracks)
+	if !*yes {
+		paths, err := m.Tracks(*start)
+		if err != nil {
+			logs.Error(err)
+			os.Exit(1)
+		}
+		if *maxTracks > 0 && len(paths) > *maxTracks {
+			paths = paths[:*maxTracks]
+		}
+		n := len(paths)
+		if *confirm || n > confirmLimit {
+			if !isTerminal(os.Stdin) {
+				logs.Error(newError("I'd ask before playing %d tracks, but there's no terminal to ask at; use -yes to play them anyway.", n))
+				os.Exit(1)
+			}
+			var total time.Duration
+			duration := durationsOf(m)
+			for _, path := range paths {
+				d, _ := duration(path)
+				total += d
+			}
+			ok, err := confirmPlay(os.Stdin, os.Stdout, n, total)
+			if err != nil {
+				logs.Error(err)
+				os.Exit(1)
+			}
+			if !ok {
+				return
+			}
+		}
+	}
+
+	p, err := configurePlayer()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		logs.Error(err)
 		os.Exit(1)
 	}
+	p.Lib = libraryOf(m)
+	p.StartAt = point.Position
+	p.Resumable = !*batch && !*dryRunFlag
+
+	if *watchLib && p.Lib != nil {
+		w := p.Lib.watch(5*time.Second, 2*time.Second)
+		defer w.Stop()
+	}
+
+	ctx, cancelCause := handleSignals(p.Skip)
+
+	if *serveAddr != "" {
+		ln, err := net.Listen("tcp", *serveAddr)
+		if err != nil {
+			logs.Error(newError("Can't serve at %s: %v", *serveAddr, err))
+			os.Exit(1)
+		}
+		srv := &http.Server{Handler: controlHandler(p, func() { cancelCause(errStopped) })}
+		go srv.Serve(ln)
+		defer srv.Close()
+	}
+
+	if *batch {
+		var paths []string
+		paths, err = m.Tracks(*start)
+		if err == nil {
+			err = p.PlayAll(ctx, paths)
+		}
+	} else {
+		err = playRepeatedly(ctx, m, p, *start, times)
+	}
+	if err == nil || err == errEnough {
+		if *resumeFlag {
+			forgetResumePoint()
+		}
+		err = p.Failures()
+	}
+	if p.Resumable {
+		keepResumePoint(p, m, *start)
+	}
+	flushScrobblers(p.Scrobblers, 5*time.Second)
+	if *statusPath != "" {
+		statusFile(*statusPath).Clear()
+	}
+	if err == context.Canceled {
+		if context.Cause(ctx) == errStopped {
+			return
+		}
+		os.Exit(1)
+	}
+	if err != nil && err != errEnough {
+		logs.Error(err)
+		os.Exit(1)
+	}
+}
+
+// configurePlayer returns a Player set up as the flags say.
+func configurePlayer() (*Player, error) {
+	cmd := *player
+	if cmd == "" {
+		var err error
+		cmd, err = detectPlayer()
+		if err != nil {
+			return nil, err
+		}
+	}
+	p, err := newPlayer(cmd)
+	if err != nil {
+		return nil, err
+	}
+	p.Tracks = *tracks
+	if *progress {
+		p.Progress = logs.Err
+	}
+	if *playerMap != "" {
+		p.ByExt, err = parsePlayerMap(*playerMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *batchArgs != "" {
+		p.BatchArgs, err = parseBatchArgs(*batchArgs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if isFlagConfigured("volume") {
+		if *volume < 0 || *volume > 100 {
+			return nil, newError("-volume should be from 0 to 100, but it's %d.", *volume)
+		}
+		p.Cmd = withVolume(p.Cmd, *volume)
+		for ext, cmd := range p.ByExt {
+			p.ByExt[ext] = withVolume(cmd, *volume)
+		}
+	}
+	if *dryRunFlag {
+		p.run = dryRun(logs.Out)
+	}
+	p.Max = *maxTracks
+	p.StopAfter = *stopAfter
+	p.Gap = *gap
+	p.KeepGoing = *keepGoing
+	if *notify {
+		p.Notifiers = append(p.Notifiers, newDesktopNotifier(runtime.GOOS))
+	}
+	if *statusPath != "" {
+		p.Notifiers = append(p.Notifiers, statusFile(*statusPath))
+	}
+	if *scrobble {
+		l, err := lastfmFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		p.Scrobblers = append(p.Scrobblers, inBackground(l, 100))
+	}
+	if !*noHistory {
+		path, err := historyFileName()
+		if err != nil {
+			return nil, err
+		}
+		p.Scrobblers = append(p.Scrobblers, historyFile(path))
+		path, err = defaultCounts()
+		if err != nil {
+			return nil, err
+		}
+		p.Scrobblers = append(p.Scrobblers, playCounts(path))
+	}
+	return p, nil
+}
+
+// rateTrack gives the track at path, or else the one which best
+// matches it as a pattern, the rating.
+func rateTrack(rating int, path string) error {
+	if path == "" {
+		return newError("Please provide the track to rate.")
+	}
+	if _, err := os.Stat(path); err == nil {
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+	} else {
+		lib, err := DefaultLibrary()
+		if err != nil {
+			return err
+		}
+		t, err := lib.LocateTrack(path)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return newError("I failed to find a track matching this pattern: %q", path)
+		}
+		path = t.Path()
+	}
+	file, err := defaultRatings()
+	if err != nil {
+		return err
+	}
+	return ratings(file).Rate(path, rating)
+}
+
+// saveSelection saves the tracks of m, from start, as the
+// playlist with the given name.
+func saveSelection(m Music, start, name string) error {
+	paths, err := m.Tracks(start)
+	if err != nil {
+		return err
+	}
+	dir, err := playlistDir()
+	if err != nil {
+		return err
+	}
+	file, err := savePlaylist(dir, name, paths)
+	if err != nil {
+		return err
+	}
+	logs.Info(fmt.Sprintf("Saved %d tracks in %s", len(paths), file))
+	return nil
+}
+
+// historyFileName returns the name of the file holding the
+// history of what's played: the one given by -history, if any.
+func historyFileName() (string, error) {
+	if *historyPath != "" {
+		return *historyPath, nil
+	}
+	return defaultHistory()
 }
 
 func locate(pattern string) (Music, error) {
+	if *playlistFile != "" {
+		return LocatePlaylist(*playlistFile)
+	}
+
+	lib, err := DefaultLibrary()
+	if err != nil {
+		return nil, err
+	}
+
+	if *newest {
+		return lib.newestAlbum()
+	}
+	if *random && isFlagSet("artist") && *byartist {
+		return lib.randomArtist()
+	}
+	if *random {
+		return lib.randomAlbum()
+	}
+
+	if *albumBlocks || *shuffleAll || pattern == "" {
+		return lib.All(*shuffleAll && !*albumBlocks), nil
+	}
+
+	ms, err := matches(lib, pattern)
+	if err != nil || len(ms) == 0 {
+		return nil, err
+	}
+	if len(ms) > 1 && *candidates {
+		printCandidates(logs.Out, ms)
+		os.Exit(1)
+	}
+	if len(ms) > 1 && !*noPrompt && isTerminal(os.Stdin) {
+		return choose(os.Stdin, os.Stdout, ms)
+	}
+	return ms[0], nil
+}
+
+// libraryOf returns the Library which m is in,
+// or nil if it isn't in one.
+func libraryOf(m Music) *Library {
+	switch m := m.(type) {
+	case *artist:
+		return m.lib
+	case *album:
+		return m.lib
+	case *collection:
+		return m.lib
+	case *track:
+		return m.lib
+	}
+	return nil
+}
+
+// matches returns everything in lib that locate could pick
+// for pattern, best match first.
+func matches(lib *Library, pattern string) ([]Music, error) {
+	if *search {
+		m, err := lib.Search(pattern)
+		if err != nil || m == nil {
+			return nil, err
+		}
+		return []Music{m}, nil
+	}
+
+	if *bytrack {
+		paths, err := lib.trackMatches(pattern)
+		return musics(paths, func(path string) Music {
+			return newTrack(lib, path)
+		}), err
+	}
+
 	if *byartist && !*byalbum {
-		m, err := LocateArtist(pattern)
+		paths, err := lib.artistMatches(pattern)
+		if err != nil || len(paths) > 0 {
+			return musics(paths, func(path string) Music {
+				return newArtist(lib, path)
+			}), err
+		}
+	}
+
+	paths, err := lib.albumMatches(pattern)
+	return musics(paths, func(path string) Music {
+		return newAlbum(lib, path, false)
+	}), err
+}
+
+// musics returns a Music object for each path, made by newMusic.
+func musics(paths []string, newMusic func(string) Music) []Music {
+	ms := make([]Music, len(paths))
+	for i, p := range paths {
+		ms[i] = newMusic(p)
+	}
+	return ms
+}
+
+// printCandidates prints the names of the things that were matched.
+func printCandidates(w io.Writer, ms []Music) {
+	fmt.Fprintln(w, "Did you mean one of these?")
+	for _, m := range ms {
+		fmt.Fprintln(w, "\t"+relName(m))
+	}
+}
+
+// choose asks which of the things that were matched should be played,
+// and returns the one whose number is read from in. An empty answer
+// chooses the first, best match.
+func choose(in io.Reader, out io.Writer, ms []Music) (Music, error) {
+	for i, m := range ms {
+		fmt.Fprintf(out, "%d) %s\n", i+1, relName(m))
+	}
+
+	r := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Which one? [1] ")
+		answer, err := r.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" && err == nil {
+			return ms[0], nil
+		}
+		if n, cerr := strconv.Atoi(answer); cerr == nil && n >= 1 && n <= len(ms) {
+			return ms[n-1], nil
+		}
 		if err != nil {
-			return nil, err
+			fmt.Fprintln(out)
+			return nil, newError("I didn't get a choice.")
+		}
+		fmt.Fprintf(out, "Please choose a number from 1 to %d.\n", len(ms))
+	}
+}
+
+// relName returns the path of m relative to the music folder holding it.
+func relName(m Music) string {
+	mlocs, err := musiclocs()
+	if err != nil {
+		return m.Path()
+	}
+	for _, mloc := range mlocs {
+		rel, err := filepath.Rel(mloc, m.Path())
+		if err == nil && filepath.IsLocal(rel) {
+			return rel
 		}
-		if m != nil {
-			return m, nil
+	}
+	return m.Path()
+}
+
+// printCount prints how many tracks playing m from start would play,
+// and, for an artist or the whole library, how many albums, e.g.
+// "Pixies: 2 albums, 5 tracks".
+func printCount(w io.Writer, m Music, start string) error {
+	tracks, err := m.Tracks(start)
+	if err != nil {
+		return err
+	}
+
+	albums := 0
+	switch m := m.(type) {
+	case *artist:
+		err = m.doPerAlbum(start, func(os.FileInfo, string) error {
+			albums++
+			return nil
+		})
+	case *collection:
+		var as []os.FileInfo
+		as, _, err = m.albums()
+		albums = len(as)
+	}
+	if err != nil {
+		return err
+	}
+
+	name := selectionName(m)
+
+	if albums > 0 {
+		fmt.Fprintf(w, "%s: %s, %s\n", name, plural(albums, "album"), plural(len(tracks), "track"))
+	} else {
+		fmt.Fprintf(w, "%s: %s\n", name, plural(len(tracks), "track"))
+	}
+	return nil
+}
+
+// printTotal prints how long playing m from start would take, e.g.
+// "Doolittle: 38:41". Tracks whose durations can't be told are
+// counted as taking no time, with a warning.
+func printTotal(w io.Writer, m Music, start string) error {
+	tracks, err := m.Tracks(start)
+	if err != nil {
+		return err
+	}
+
+	duration := durationsOf(m)
+	var total time.Duration
+	for _, t := range tracks {
+		d, ok := duration(t)
+		if !ok {
+			logs.Warn(newError("I can't tell how long %s is, so it's counted as 00:00.", t))
+		}
+		total += d
+	}
+	fmt.Fprintf(w, "%s: %s\n", selectionName(m), formatDuration(total, true))
+	return nil
+}
+
+// durationsOf returns the function which tells how long the tracks
+// of m are: through its Library, if it's in one.
+func durationsOf(m Music) func(string) (time.Duration, bool) {
+	if lib := libraryOf(m); lib != nil {
+		return lib.duration
+	}
+	return fileDuration
+}
+
+// selectionName returns the name of m for printCount and printTotal.
+func selectionName(m Music) string {
+	switch m := m.(type) {
+	case *collection:
+		return "Everything"
+	case *track:
+		return m.name()
+	case *playlist:
+		return "The playlist"
+	}
+	return filepath.Base(m.Path())
+}
+
+// plural returns n and thing, pluralized if n isn't 1, e.g. "3 tracks".
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
+
+// printVersion prints the version of splay, and of Go it was built with.
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "splay %s (%s)\n", version, runtime.Version())
+}
+
+// playRepeatedly plays m from start n times, or forever if n <= 0,
+// until ctx is done. Each time is shuffled differently, if shuffling
+// is on. It stops early if a whole time around plays nothing.
+func playRepeatedly(ctx context.Context, m Music, p *Player, start string, n int) error {
+	seed := shuffleSeed
+	defer func() { shuffleSeed = seed }()
+
+	for i := 0; n <= 0 || i < n; i++ {
+		shuffleSeed = seed + int64(i)
+		played := p.played
+		if err := m.Play(ctx, p, start); err != nil {
+			return err
+		}
+		if p.played == played {
+			return nil
 		}
 	}
+	return nil
+}
+
+// commandLine holds the names of the flags given on the command line,
+// as opposed to those set by the config file.
+var commandLine map[string]bool
+
+// isFlagSet returns true iff the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	return commandLine[name]
+}
 
-	return LocateAlbum(pattern)
+// isFlagConfigured returns true iff the named flag was given on the
+// command line or in the config file.
+func isFlagConfigured(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// confirmPlay asks whether to go ahead with playing n tracks, lasting
+// about d, and returns true iff the answer read from in is yes. It's
+// an error if in ends without any answer.
+func confirmPlay(in io.Reader, out io.Writer, n int, d time.Duration) (bool, error) {
+	fmt.Fprintf(out, "This will play %d tracks (~%dh). Continue? [y/N] ", n, int(d.Round(time.Hour)/time.Hour))
+	var answer string
+	if _, err := fmt.Fscanln(in, &answer); err == io.EOF {
+		fmt.Fprintln(out)
+		return false, newError("There was no answer, so nothing was played; use -yes to play without asking.")
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
 }
@@ -0,0 +1,344 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestConfirmPlay(t *testing.T) {
+	tests := []struct {
+		answer string
+		ok     bool
+		err    bool
+	}{
+		{"y\n", true, false},
+		{"Yes\n", true, false},
+		{"n\n", false, false},
+		{"\n", false, false},
+		{"", false, true},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		ok, err := confirmPlay(strings.NewReader(test.answer), &out, 600, 39*time.Hour+40*time.Minute)
+		if ok != test.ok || (err != nil) != test.err {
+			t.Errorf("confirmPlay with answer %q should be %v, with error %v, but got %v, %v", test.answer, test.ok, test.err, ok, err)
+		}
+		if !strings.HasPrefix(out.String(), "This will play 600 tracks (~40h). Continue? [y/N] ") {
+			t.Errorf("Unexpected prompt: %q", out.String())
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	root := mkLibrary(t,
+		"Weezer/Pinkerton/1.ogg",
+		"Ween/The Mollusk/1.ogg",
+		"Pixies/Doolittle/1.ogg",
+	)
+	musicdirs = stringList{root}
+	defer func() { musicdirs = nil }()
+
+	ms, err := matches(dirLibrary(root), "wee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printCandidates(&buf, ms)
+	want := "Did you mean one of these?\n\tWeen\n\tWeezer\n"
+	if buf.String() != want {
+		t.Errorf("Expected the candidates %q, but got %q", want, buf.String())
+	}
+
+	ms, err = matches(dirLibrary(root), "mollusk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Path() != filepath.Join(root, "Ween", "The Mollusk") {
+		t.Error("Expected to fall back to the one matching album, but got", ms)
+	}
+}
+
+func TestChoose(t *testing.T) {
+	root := mkLibrary(t,
+		"Weezer/Pinkerton/1.ogg",
+		"Ween/The Mollusk/1.ogg",
+		"Weekend/Pink/1.ogg",
+	)
+	musicdirs = stringList{root}
+	defer func() { musicdirs = nil }()
+
+	ms, err := matches(dirLibrary(root), "wee")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		answer string
+		path   string
+	}{
+		{"2\n", filepath.Join(root, "Weezer")},
+		{"\n", filepath.Join(root, "Ween")},
+		{"0\nfour\n3\n", filepath.Join(root, "Weekend")},
+		{"3", filepath.Join(root, "Weekend")},
+		{"", ""},
+		{"9\n", ""},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		m, err := choose(strings.NewReader(test.answer), &out, ms)
+		if test.path == "" {
+			if err == nil {
+				t.Errorf("Answering %q should fail, but chose %s", test.answer, m.Path())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Answering %q failed: %v", test.answer, err)
+		} else if m.Path() != test.path {
+			t.Errorf("Answering %q should choose %s, but chose %s", test.answer, test.path, m.Path())
+		}
+		if !strings.HasPrefix(out.String(), "1) Ween\n2) Weezer\n3) Weekend\nWhich one? [1] ") {
+			t.Errorf("Unexpected prompt: %q", out.String())
+		}
+	}
+}
+
+func TestPrintCount(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+		"Pixies/Surfer Rosa/cover.jpg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+	doolittle := filepath.Join(pixies, "Doolittle")
+
+	tests := []struct {
+		m     Music
+		start string
+		count string
+	}{
+		{newArtist(l, pixies), "", "Pixies: 2 albums, 5 tracks\n"},
+		{newArtist(l, pixies), "surfer", "Pixies: 2 albums, 5 tracks\n"},
+		{newAlbum(l, doolittle, false), "", "Doolittle: 3 tracks\n"},
+		{newAlbum(l, doolittle, false), "tame", "Doolittle: 2 tracks\n"},
+		{newTrack(l, filepath.Join(doolittle, "2 Tame.ogg")), "", "Pixies/Doolittle/2 Tame: 1 track\n"},
+		{l.All(false), "", "Everything: 3 albums, 6 tracks\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := printCount(&buf, test.m, test.start); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.count {
+			t.Errorf("The count of %s from %q should be %q, but got %q", test.m.Path(), test.start, test.count, buf.String())
+		}
+	}
+}
+
+func TestPrintTotal(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Pixies/Doolittle/1 Debaser.flac":        &fstest.MapFile{Data: flacOf(44100*172, 44100)},
+		"Pixies/Doolittle/2 Tame.ogg":            &fstest.MapFile{Data: oggOf(vorbisHead(48000), 48000*115)},
+		"Pixies/Surfer Rosa/1 Bone Machine.flac": &fstest.MapFile{Data: flacOf(48000*183, 48000)},
+		"Pixies/Surfer Rosa/2 Break My Body.mp3": &fstest.MapFile{},
+	}
+	l := NewLibrary(fsys, filepath.FromSlash("/music"))
+	pixies := filepath.Join(l.root(), "Pixies")
+
+	defer func(l *logger) { logs = l }(logs)
+	var errs bytes.Buffer
+	logs = &logger{Out: io.Discard, Err: &errs}
+
+	tests := []struct {
+		m     Music
+		total string
+		warns int
+	}{
+		{newAlbum(l, filepath.Join(pixies, "Doolittle"), false), "Doolittle: 04:47\n", 0},
+		{newAlbum(l, filepath.Join(pixies, "Surfer Rosa"), false), "Surfer Rosa: 03:03\n", 1},
+		{newArtist(l, pixies), "Pixies: 07:50\n", 1},
+		{l.All(false), "Everything: 07:50\n", 1},
+	}
+	for _, test := range tests {
+		errs.Reset()
+		var buf bytes.Buffer
+		if err := printTotal(&buf, test.m, ""); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.total {
+			t.Errorf("The total of %s should be %q, but got %q", test.m.Path(), test.total, buf.String())
+		}
+		if n := strings.Count(errs.String(), "Warning:"); n != test.warns {
+			t.Errorf("Expected %d warnings for %s, but got %q", test.warns, test.m.Path(), errs.String())
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	defer func() { *showVersion = false }()
+	if err := flag.CommandLine.Parse([]string{"-version"}); err != nil {
+		t.Fatal(err)
+	}
+	if !*showVersion {
+		t.Fatal("Expected -version to be set")
+	}
+
+	defer func(v string) { version = v }(version)
+	version = "1.2.3"
+	var buf bytes.Buffer
+	printVersion(&buf)
+	if want := "splay 1.2.3 (" + runtime.Version() + ")\n"; buf.String() != want {
+		t.Errorf("Expected the version %q, but got %q", want, buf.String())
+	}
+}
+
+func TestRepeatFlag(t *testing.T) {
+	tests := []struct {
+		args   []string
+		repeat int
+		ok     bool
+	}{
+		{nil, 1, true},
+		{[]string{"-repeat"}, 0, true},
+		{[]string{"-repeat=3"}, 3, true},
+		{[]string{"-repeat=0"}, 0, true},
+		{[]string{"-repeat=-2"}, 1, false},
+		{[]string{"-repeat=often"}, 1, false},
+	}
+	for _, test := range tests {
+		r := repeatFlag(1)
+		fs := flag.NewFlagSet("splay", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Var(&r, "repeat", "")
+		err := fs.Parse(test.args)
+		if (err == nil) != test.ok {
+			t.Errorf("Parsing %q should succeed: %v, but got %v", test.args, test.ok, err)
+		}
+		if test.ok && int(r) != test.repeat {
+			t.Errorf("Parsing %q should repeat %d times, but got %d", test.args, test.repeat, r)
+		}
+	}
+}
+
+func TestPlayRepeatedly(t *testing.T) {
+	var files []string
+	for i := 1; i <= 8; i++ {
+		files = append(files, fmt.Sprintf("Pixies/Doolittle/%d Track.ogg", i))
+	}
+	l := mapLibrary(files...)
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+
+	defer func(s int64) { shuffleTracks, shuffleSeed = false, s }(shuffleSeed)
+	shuffleSeed = 1
+
+	// passes splits the tracks that were played into passes of 8.
+	passes := func(ran [][]string) []string {
+		var ps []string
+		for i := 0; i+8 <= len(ran); i += 8 {
+			var pass []string
+			for _, args := range ran[i : i+8] {
+				pass = append(pass, filepath.Base(args[1]))
+			}
+			ps = append(ps, strings.Join(pass, ","))
+		}
+		return ps
+	}
+
+	p, ran := fakePlayer(t, "mpg123")
+	if err := playRepeatedly(context.Background(), doolittle, p, "", 3); err != nil {
+		t.Fatal(err)
+	}
+	if len(*ran) != 24 {
+		t.Fatalf("Expected to play 3 times 8 tracks, but played %d", len(*ran))
+	}
+	ps := passes(*ran)
+	if ps[0] != ps[1] || ps[1] != ps[2] {
+		t.Errorf("Expected every unshuffled pass to be in order, but got %q", ps)
+	}
+
+	shuffleTracks = true
+	p, ran = fakePlayer(t, "mpg123")
+	if err := playRepeatedly(context.Background(), doolittle, p, "", 3); err != nil {
+		t.Fatal(err)
+	}
+	ps = passes(*ran)
+	if len(ps) != 3 {
+		t.Fatalf("Expected to play 3 passes, but played %d tracks", len(*ran))
+	}
+	if ps[0] == ps[1] || ps[1] == ps[2] || ps[0] == ps[2] {
+		t.Errorf("Expected each shuffled pass to be ordered differently, but got %q", ps)
+	}
+	if shuffleSeed != 1 {
+		t.Error("Repeating changed the shuffle seed to", shuffleSeed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p, ran = fakePlayer(t, "mpg123")
+	p.run = func(c *exec.Cmd) error {
+		*ran = append(*ran, c.Args)
+		if len(*ran) == 20 {
+			cancel()
+		}
+		return nil
+	}
+	if err := playRepeatedly(ctx, doolittle, p, "", 0); err != context.Canceled {
+		t.Error("Expected repeating forever to stop when cancelled, but got", err)
+	}
+	if len(*ran) != 20 {
+		t.Errorf("Expected to play 20 tracks before being cancelled, but played %d", len(*ran))
+	}
+}
+
+func TestRepeatTrack(t *testing.T) {
+	l := mapLibrary("Pixies/Doolittle/2 Tame.ogg")
+	tame := newTrack(l, filepath.Join(l.root(), "Pixies", "Doolittle", "2 Tame.ogg"))
+
+	p, ran := fakePlayer(t, "mpg123")
+	if err := playRepeatedly(context.Background(), tame, p, "", 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(*ran) != 4 {
+		t.Errorf("Expected to play the track 4 times, but played it %d times", len(*ran))
+	}
+	for _, args := range *ran {
+		if args[1] != tame.Path() {
+			t.Errorf("Expected to play only %s, but played %s", tame.Path(), args[1])
+		}
+	}
+
+	for _, n := range []int{0, -1} {
+		ctx, cancel := context.WithCancel(context.Background())
+		p, ran = fakePlayer(t, "mpg123")
+		p.run = func(c *exec.Cmd) error {
+			*ran = append(*ran, c.Args)
+			if len(*ran) == 10 {
+				cancel()
+			}
+			return nil
+		}
+		if err := playRepeatedly(ctx, tame, p, "", n); err != context.Canceled {
+			t.Errorf("Expected repeating the track %d times to stop when cancelled, but got %v", n, err)
+		}
+		if len(*ran) != 10 {
+			t.Errorf("Expected to play the track 10 times before being cancelled, but played it %d times", len(*ran))
+		}
+	}
+}
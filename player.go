@@ -0,0 +1,501 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Player plays tracks by running an external program for each one.
+type Player struct {
+	// Cmd is the program and its leading arguments. The path of
+	// each track is appended to them.
+	Cmd []string
+
+	// ByExt maps the lower-case extensions of tracks, such as ".flac",
+	// to the programs which play them instead of Cmd.
+	ByExt map[string][]string
+
+	// BatchArgs maps the lower-case extensions of tracks to extra
+	// arguments which PlayAll gives Cmd, before the paths, if any of
+	// the tracks have them, e.g. to have mpv play FLAC gaplessly.
+	BatchArgs map[string][]string
+
+	// Tracks, if true, means the name of each track is printed
+	// before it is played.
+	Tracks bool
+
+	// Max, if positive, is the most tracks that will be played.
+	Max int
+
+	// StopAfter, if positive, is how long to keep playing. No track
+	// is started once that long has passed since the first started.
+	StopAfter time.Duration
+
+	// Gap, if positive, is how long to wait between tracks.
+	Gap time.Duration
+
+	// KeepGoing, if true, means a track which fails to play is
+	// logged and skipped, rather than stopping everything.
+	KeepGoing bool
+
+	// Notifiers announce each track as it starts. They're
+	// best-effort: if they fail, the track plays anyway.
+	Notifiers []notifier
+
+	// Progress, if not nil, is where a line saying how much of each
+	// track has played, and how much is left, is kept up to date while
+	// it plays, as long as the length of the track can be told.
+	Progress io.Writer
+
+	// Lib, if not nil, is the Library holding the tracks played,
+	// through which their tags are read.
+	Lib *Library
+
+	// Resumable, if true, means how far into each track the player is
+	// is kept track of, with players which can say, so that Stopped can
+	// tell where to resume. Only mpv can, so far.
+	Resumable bool
+
+	// StartAt, if positive, is how far into the next track played to
+	// start, if the player can; otherwise the track starts from the top.
+	StartAt time.Duration
+
+	// Scrobblers record each track which played for long enough, as
+	// playedEnough says. If they fail, it's logged, and playing goes on.
+	Scrobblers []scrobbler
+
+	played int              // the number of tracks played so far
+	failed []string         // the paths of the tracks which failed, if KeepGoing
+	start  time.Time        // when the first track started
+	now    func() time.Time // gives the time; it is replaced in tests
+
+	// length gives how long a track is, if it can be told.
+	// It is replaced in tests.
+	length func(path string) (time.Duration, bool)
+
+	// run runs a command to completion. It is replaced in tests.
+	run func(*exec.Cmd) error
+
+	// sleep waits for a while, or until ctx is done. It is replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu      sync.Mutex
+	skip    context.CancelFunc // stops the track being played
+	playing string             // the path of the track being played
+	started int                // the number of tracks started so far
+
+	stopped   string        // the path of the track being played when ctx was done
+	stoppedAt time.Duration // how far into it the player had got
+}
+
+// newPlayer returns a Player which runs the given command line,
+// which is split into words as by splitArgs.
+func newPlayer(cmd string) (*Player, error) {
+	args, err := splitArgs(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, newError("Please provide a player command.")
+	}
+	return &Player{Cmd: args, run: (*exec.Cmd).Run, now: time.Now, sleep: sleep, length: fileDuration}, nil
+}
+
+// sleep waits for d to pass, returning early with ctx's error
+// if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parsePlayerMap parses a comma-separated list of extensions and
+// the commands which play them, e.g. "flac=ogg123, mp3=mpg123 -q",
+// into a map for Player.ByExt. Empty entries are ignored.
+func parsePlayerMap(list string) (map[string][]string, error) {
+	return parseExtMap(list, "player map", "flac=ogg123")
+}
+
+// parseBatchArgs parses a comma-separated list of extensions and
+// extra arguments for the player, e.g. "flac=--gapless-audio=yes",
+// into a map for Player.BatchArgs. Empty entries are ignored.
+func parseBatchArgs(list string) (map[string][]string, error) {
+	return parseExtMap(list, "batch arguments", "flac=--gapless-audio=yes")
+}
+
+// parseExtMap parses a comma-separated list of extensions and the
+// arguments for them, quoted as by splitArgs, into a map from each
+// extension, as by parseExts. What the list is, and an example of an
+// entry, are given for its errors.
+func parseExtMap(list, what, example string) (map[string][]string, error) {
+	m := map[string][]string{}
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		ext, cmd, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, newError("There's nothing for %q in the %s (try something like %s)", strings.TrimSpace(entry), what, example)
+		}
+		args, err := splitArgs(cmd)
+		if err != nil {
+			return nil, err
+		}
+		exts := parseExts(ext)
+		if len(exts) == 0 || len(args) == 0 {
+			return nil, newError("I don't understand %q in the %s (try something like %s)", strings.TrimSpace(entry), what, example)
+		}
+		for e := range exts {
+			m[e] = args
+		}
+	}
+	return m, nil
+}
+
+// errEnough is returned by Player.Play once as many tracks have
+// been played, or for as long, as was asked for.
+var errEnough = newError("That's enough for now.")
+
+// Play plays the track at path, returning once it has finished or
+// been skipped. If ctx is done, the track isn't played, or the player
+// is killed if it's already playing, and ctx's error is returned.
+// If that was the last track which may be played, errEnough is returned.
+// Every track but the first waits for p.Gap before it starts.
+func (p *Player) Play(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.Gap > 0 && p.played > 0 {
+		if err := p.sleep(ctx, p.Gap); err != nil {
+			return err
+		}
+	}
+
+	if p.start.IsZero() {
+		p.start = p.now()
+	}
+
+	if len(p.Notifiers) > 0 {
+		artist, album, song := newTrack(p.Lib, path).(*track).names()
+		for _, n := range p.Notifiers {
+			n.Notify(artist, album, song)
+		}
+	}
+
+	cmd := p.Cmd
+	if c, ok := p.ByExt[strings.ToLower(filepath.Ext(path))]; ok {
+		cmd = c
+	}
+	from := time.Duration(0)
+	if p.StartAt > 0 {
+		var ok bool
+		if cmd, ok = withStart(cmd, p.StartAt); ok {
+			from = p.StartAt
+		}
+		p.StartAt = 0
+	}
+	position := func() time.Duration { return from }
+	if p.Resumable {
+		cmd, position = watchPosition(cmd, from)
+	}
+	p.mu.Lock()
+	p.playing = path
+	p.started++
+	p.mu.Unlock()
+	began := p.now()
+	stopProgress := p.showProgress(path, began)
+	err := p.runSkippable(ctx, cmd, path)
+	stopProgress()
+	at := position()
+	p.mu.Lock()
+	p.playing = ""
+	if ctx.Err() != nil {
+		p.stopped, p.stoppedAt = path, at
+	}
+	p.mu.Unlock()
+	if err != nil {
+		if !p.KeepGoing || ctx.Err() != nil {
+			return err
+		}
+		logs.Error(newError("Couldn't play %s: %v", path, err))
+		p.failed = append(p.failed, path)
+		return nil
+	}
+	p.scrobble(path, began)
+
+	p.played++
+	if p.Max > 0 && p.played >= p.Max {
+		return errEnough
+	}
+	if p.StopAfter > 0 && p.now().Sub(p.start) >= p.StopAfter {
+		return errEnough
+	}
+	return nil
+}
+
+// scrobble gives the track at path, which began playing at the given
+// time, to p.Scrobblers, if it played for long enough.
+func (p *Player) scrobble(path string, began time.Time) {
+	if len(p.Scrobblers) == 0 {
+		return
+	}
+	length, known := p.length(path)
+	if !playedEnough(p.now().Sub(began), length, known) {
+		return
+	}
+	artist, album, song := newTrack(p.Lib, path).(*track).names()
+	for _, s := range p.Scrobblers {
+		if err := s.Scrobble(path, artist, album, song, began); err != nil {
+			logs.Warn(err)
+		}
+	}
+}
+
+// reset forgets the tracks played so far, when the first of them
+// started, and which failed, so that p.Max and p.StopAfter count
+// afresh, e.g. for each thing played at the prompt of -i.
+func (p *Player) reset() {
+	p.played = 0
+	p.start = time.Time{}
+	p.failed = nil
+}
+
+// Failures returns an error saying how many tracks failed to play,
+// if p.KeepGoing is set and any did, or nil.
+func (p *Player) Failures() error {
+	switch len(p.failed) {
+	case 0:
+		return nil
+	case 1:
+		return newError("1 track couldn't be played: %s", p.failed[0])
+	}
+	return newError("%d tracks couldn't be played.", len(p.failed))
+}
+
+// PlayAll plays the tracks at paths with a single run of the player,
+// which must accept more than one file, returning once it has finished
+// or been skipped. If ctx is done, the player is killed, and ctx's
+// error is returned. The names of all the tracks are printed first,
+// if p.Tracks is set. Only the first p.Max tracks are played, if it's
+// positive, but p.ByExt and p.StopAfter are ignored. p.Cmd is given
+// the p.BatchArgs of the tracks' extensions, as by batchCommand.
+func (p *Player) PlayAll(ctx context.Context, paths []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if p.Max > 0 && len(paths) > p.Max {
+		paths = paths[:p.Max]
+	}
+	if p.Tracks {
+		for _, path := range paths {
+			artist, album, song := newTrack(p.Lib, path).(*track).names()
+			logs.Info(paintTrack(artist, album, song, false))
+		}
+	}
+	return p.runSkippable(ctx, p.batchCommand(paths), paths...)
+}
+
+// batchCommand returns p.Cmd with the p.BatchArgs of the extensions
+// of paths added, each once, in the order the extensions first appear.
+func (p *Player) batchCommand(paths []string) []string {
+	cmd := p.Cmd
+	seen := map[string]bool{}
+	for _, path := range paths {
+		ext := strings.ToLower(filepath.Ext(path))
+		if args, ok := p.BatchArgs[ext]; ok && !seen[ext] {
+			seen[ext] = true
+			cmd = append(cmd[:len(cmd):len(cmd)], args...)
+		}
+	}
+	return cmd
+}
+
+// runSkippable runs cmd with the paths of tracks appended, returning
+// once it has finished or been skipped. If ctx is done, it is killed,
+// and ctx's error is returned. If it fails, the last of what it wrote
+// to stderr is given with the error, to say why.
+func (p *Player) runSkippable(ctx context.Context, cmd []string, paths ...string) error {
+	tctx, skip := context.WithCancel(ctx)
+	defer skip()
+	p.mu.Lock()
+	p.skip = skip
+	p.mu.Unlock()
+
+	args := append(cmd[1:len(cmd):len(cmd)], paths...)
+	c := exec.CommandContext(tctx, cmd[0], args...)
+	ownProcessGroup(c)
+	stderr := &tailBuffer{n: stderrTail}
+	c.Stderr = stderr
+	err := p.run(c)
+
+	p.mu.Lock()
+	p.skip = nil
+	p.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if tctx.Err() != nil {
+		return nil
+	}
+	if why := stderr.lastLines(3); err != nil && why != "" {
+		return newError("%v: %s", err, why)
+	}
+	return err
+}
+
+// stderrTail is how much of what a player writes to stderr is
+// kept, in case it fails.
+const stderrTail = 4096
+
+// A tailBuffer keeps the last n bytes written to it.
+type tailBuffer struct {
+	n   int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > t.n {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.n:]...)
+	}
+	return len(b), nil
+}
+
+// lastLines returns up to the last n non-blank lines written to t,
+// joined with "; ".
+func (t *tailBuffer) lastLines(n int) string {
+	var lines []string
+	for _, line := range strings.Split(string(t.buf), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "; ")
+}
+
+// dryRun returns a replacement for Player.run which prints each
+// command line to w, instead of running it.
+func dryRun(w io.Writer) func(*exec.Cmd) error {
+	return func(c *exec.Cmd) error {
+		_, err := fmt.Fprintln(w, joinArgs(c.Args))
+		return err
+	}
+}
+
+// Playing returns the path of the track being played, and how many
+// tracks were started before it, or false if none is being played.
+func (p *Player) Playing() (index int, path string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.playing == "" {
+		return 0, "", false
+	}
+	return p.started - 1, p.playing, true
+}
+
+// Stopped returns the path of the track which was being played when
+// the context given to Play was done, and how far into it the player
+// had got, as far as can be told, or false if that didn't happen.
+func (p *Player) Stopped() (path string, at time.Duration, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped, p.stoppedAt, p.stopped != ""
+}
+
+// Skip kills the player of the track being played, if there is one,
+// so that the next track starts.
+func (p *Player) Skip() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.skip != nil {
+		p.skip()
+	}
+}
+
+// withVolume returns the command line cmd, plus the arguments which
+// make it play at the given volume, from 0 to 100 percent. If splay
+// doesn't know how to set the volume of the player, it says so, and
+// returns cmd as it is.
+func withVolume(cmd []string, volume int) []string {
+	args, ok := volumeArgs(cmd[0], volume)
+	if !ok {
+		logs.Warn(newError("I don't know how to set the volume of %s, so -volume is ignored.", cmd[0]))
+		return cmd
+	}
+	return append(cmd[:len(cmd):len(cmd)], args...)
+}
+
+// volumeArgs returns the arguments which make the given player play at
+// the given volume, from 0 to 100 percent, or false if splay doesn't
+// know them.
+func volumeArgs(player string, volume int) ([]string, bool) {
+	name := strings.TrimSuffix(filepath.Base(player), ".exe")
+	switch name {
+	case "mpv":
+		return []string{fmt.Sprintf("--volume=%d", volume)}, true
+	case "ffplay":
+		return []string{"-volume", strconv.Itoa(volume)}, true
+	case "mpg123":
+		// mpg123 scales samples by a factor out of 32768.
+		return []string{"-f", strconv.Itoa(volume * 32768 / 100)}, true
+	case "afplay":
+		return []string{"-v", strconv.FormatFloat(float64(volume)/100, 'g', -1, 64)}, true
+	case "vlc", "cvlc":
+		return []string{"--gain", strconv.FormatFloat(float64(volume)/100, 'g', -1, 64)}, true
+	}
+	return nil, false
+}
+
+// lookPath finds the named program. It is replaced in tests.
+var lookPath = exec.LookPath
+
+// detectPlayer returns the command line of the first of the players
+// splay knows about which is installed, or an error naming the ones
+// it looked for if none are.
+func detectPlayer() (string, error) {
+	var tried []string
+	for _, cmd := range knownPlayers(runtime.GOOS) {
+		if _, err := lookPath(cmd[0]); err == nil {
+			return joinArgs(cmd), nil
+		}
+		tried = append(tried, cmd[0])
+	}
+	return "", newError("I couldn't find a player; I looked for %s. Please install one, or give one with -player.", strings.Join(tried, ", "))
+}
+
+// knownPlayers returns the command lines of the players splay knows
+// how to use on the given OS, in order of preference.
+func knownPlayers(goos string) [][]string {
+	players := [][]string{
+		{"mpv", "--no-video"},
+		{"mpg123"},
+		{"ffplay", "-nodisp", "-autoexit"},
+		{"cvlc", "--play-and-exit"},
+	}
+	if goos == "darwin" {
+		players = append([][]string{{"afplay"}}, players...)
+	}
+	return players
+}
@@ -0,0 +1,686 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePlayer returns a Player for cmd which records the arguments of
+// each command it would run, instead of running it.
+func fakePlayer(t *testing.T, cmd string) (*Player, *[][]string) {
+	p, err := newPlayer(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ran [][]string
+	p.run = func(c *exec.Cmd) error {
+		ran = append(ran, c.Args)
+		return nil
+	}
+	return p, &ran
+}
+
+func TestNewPlayer(t *testing.T) {
+	p, err := newPlayer(`mpv --no-video --title "splay it"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mpv", "--no-video", "--title", "splay it"}
+	if !reflect.DeepEqual(p.Cmd, want) {
+		t.Errorf("Expected the command %q, but got %q", want, p.Cmd)
+	}
+
+	if _, err := newPlayer("  "); err == nil {
+		t.Error("Expected an error for an empty player command")
+	}
+}
+
+func TestPlayerCommand(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+	)
+	dir := filepath.Join(root, "Pixies", "Doolittle")
+
+	p, ran := fakePlayer(t, "mpv --no-video")
+	if err := newAlbum(dirLibrary(root), dir, false).Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"mpv", "--no-video", filepath.Join(dir, "1 Debaser.ogg")},
+		{"mpv", "--no-video", filepath.Join(dir, "2 Tame.ogg")},
+	}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("Expected to run %q, but ran %q", want, *ran)
+	}
+	if !reflect.DeepEqual(p.Cmd, []string{"mpv", "--no-video"}) {
+		t.Error("Playing changed the player's command:", p.Cmd)
+	}
+}
+
+func TestPlayFromMissing(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+	)
+
+	p, ran := fakePlayer(t, "mpg123")
+	if err := newAlbum(dirLibrary(root), filepath.Join(root, "Pixies", "Doolittle"), false).Play(context.Background(), p, "tme"); err == nil {
+		t.Error("Playing an album from a missing song should fail")
+	}
+	if err := newArtist(dirLibrary(root), filepath.Join(root, "Pixies")).Play(context.Background(), p, "trompe"); err == nil {
+		t.Error("Playing an artist from a missing album should fail")
+	}
+	if len(*ran) != 0 {
+		t.Error("Nothing should have played, but played", *ran)
+	}
+}
+
+func TestPlayCancel(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+
+	tests := []struct {
+		m      Music
+		cancel int
+	}{
+		{newAlbum(dirLibrary(root), filepath.Join(root, "Pixies", "Doolittle"), false), 2},
+		{newArtist(dirLibrary(root), filepath.Join(root, "Pixies")), 2},
+		{newArtist(dirLibrary(root), filepath.Join(root, "Pixies")), 3},
+		{newCollection(dirLibrary(root), true), 1},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		p, ran := fakePlayer(t, "mpg123")
+		p.run = func(c *exec.Cmd) error {
+			*ran = append(*ran, c.Args)
+			if len(*ran) == test.cancel {
+				cancel()
+			}
+			return nil
+		}
+
+		err := test.m.Play(ctx, p, "")
+		if err != context.Canceled {
+			t.Errorf("Playing %s should have been canceled, but got %v", test.m.Path(), err)
+		}
+		if len(*ran) != test.cancel {
+			t.Errorf("Playing %s should stop after %d tracks, but played %q", test.m.Path(), test.cancel, *ran)
+		}
+		cancel()
+	}
+}
+
+func TestPlayerKilled(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("There's no sleep command to stand in for a player.")
+	}
+	p, err := newPlayer(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := p.Play(ctx, "10"); err != context.DeadlineExceeded {
+		t.Error("Expected the player to be stopped by the deadline, but got", err)
+	}
+	if time.Since(begin) > 5*time.Second {
+		t.Error("The player wasn't killed when its context was done")
+	}
+}
+
+func TestPlayerSkip(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("There's no sleep command to stand in for a player.")
+	}
+	root := mkLibrary(t, "Pixies/Doolittle/1.ogg", "Pixies/Doolittle/2.ogg")
+	p, err := newPlayer(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sleep can't sleep for a path, so run it with an argument it
+	// understands while keeping track of which tracks started.
+	var started []string
+	p.run = func(c *exec.Cmd) error {
+		started = append(started, c.Args[1])
+		c.Args[1] = "10"
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			p.Skip()
+		}()
+		return c.Run()
+	}
+
+	begin := time.Now()
+	err = newAlbum(dirLibrary(root), filepath.Join(root, "Pixies", "Doolittle"), false).Play(context.Background(), p, "")
+	if err != nil {
+		t.Error("Skipping tracks shouldn't be an error, but got", err)
+	}
+	if len(started) != 2 {
+		t.Error("Expected both tracks to start after skipping, but started", started)
+	}
+	if time.Since(begin) > 5*time.Second {
+		t.Error("The skipped players weren't killed")
+	}
+}
+
+func TestPlayMax(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+
+	for _, max := range []int{1, 2, 4, 5} {
+		p, ran := fakePlayer(t, "mpg123")
+		p.Max = max
+		err := newArtist(l, pixies).Play(context.Background(), p, "")
+		if err != errEnough {
+			t.Errorf("With -max %d, expected to stop, but got %v", max, err)
+		}
+		if len(*ran) != max {
+			t.Errorf("With -max %d, expected to play %d tracks, but played %q", max, max, *ran)
+		}
+	}
+
+	for _, max := range []int{0, -1, 6} {
+		p, ran := fakePlayer(t, "mpg123")
+		p.Max = max
+		if err := newArtist(l, pixies).Play(context.Background(), p, ""); err != nil {
+			t.Errorf("With -max %d, expected to play everything, but got %v", max, err)
+		}
+		if len(*ran) != 5 {
+			t.Errorf("With -max %d, expected to play all 5 tracks, but played %q", max, *ran)
+		}
+	}
+}
+
+func TestPlayStopAfter(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+
+	defer func() { shuffleAlbums = true }()
+	shuffleAlbums = false
+
+	tests := []struct {
+		start     string
+		stopAfter time.Duration
+		played    []string
+	}{
+		{"", 5 * time.Minute, []string{"1 Debaser.ogg", "2 Tame.ogg"}},
+		{"", 7 * time.Minute, []string{"1 Debaser.ogg", "2 Tame.ogg", "3 Wave of Mutilation.ogg"}},
+		{"surfer", 7 * time.Minute, []string{"1 Bone Machine.ogg", "2 Break My Body.ogg", "1 Debaser.ogg"}},
+		{"", time.Hour, []string{"1 Debaser.ogg", "2 Tame.ogg", "3 Wave of Mutilation.ogg", "1 Bone Machine.ogg", "2 Break My Body.ogg"}},
+	}
+	for _, test := range tests {
+		now := time.Date(2012, 6, 1, 12, 0, 0, 0, time.UTC)
+		p, ran := fakePlayer(t, "mpg123")
+		p.now = func() time.Time { return now }
+		p.run = func(c *exec.Cmd) error {
+			*ran = append(*ran, c.Args)
+			now = now.Add(3 * time.Minute)
+			return nil
+		}
+		p.StopAfter = test.stopAfter
+
+		err := newArtist(l, pixies).Play(context.Background(), p, test.start)
+		if err != nil && err != errEnough {
+			t.Fatal(err)
+		}
+		var played []string
+		for _, args := range *ran {
+			played = append(played, filepath.Base(args[1]))
+		}
+		if !reflect.DeepEqual(played, test.played) {
+			t.Errorf("With -from %q -stop-after %v, expected to play %q, but played %q", test.start, test.stopAfter, test.played, played)
+		}
+	}
+}
+
+func TestPlayGap(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+
+	p, ran := fakePlayer(t, "mpg123")
+	p.Gap = time.Millisecond
+	var slept []int
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		if d != p.Gap {
+			t.Errorf("Expected to sleep for %v, but slept for %v", p.Gap, d)
+		}
+		slept = append(slept, len(*ran))
+		return sleep(ctx, d)
+	}
+	if err := newArtist(l, pixies).Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("Expected to sleep after tracks %v, but slept after %v", want, slept)
+	}
+
+	p, ran = fakePlayer(t, "mpg123")
+	p.Gap = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		go cancel()
+		return sleep(ctx, d)
+	}
+	done := make(chan error, 1)
+	go func() { done <- newArtist(l, pixies).Play(ctx, p, "") }()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Error("Expected a cancelled gap to stop playing, but got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Cancelling didn't interrupt the gap")
+	}
+	if len(*ran) != 1 {
+		t.Errorf("Expected to play only the first track, but played %q", *ran)
+	}
+}
+
+func TestPlayKeepGoing(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+	)
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+	tame := filepath.Join(l.root(), "Pixies", "Doolittle", "2 Tame.ogg")
+
+	defer func(l *logger) { logs = l }(logs)
+	var errs bytes.Buffer
+	logs = &logger{Out: io.Discard, Err: &errs}
+
+	broken := func(ran *[][]string) func(*exec.Cmd) error {
+		return func(c *exec.Cmd) error {
+			*ran = append(*ran, c.Args)
+			if c.Args[1] == tame {
+				return errors.New("exit status 1")
+			}
+			return nil
+		}
+	}
+
+	p, ran := fakePlayer(t, "mpg123")
+	p.run = broken(ran)
+	if err := doolittle.Play(context.Background(), p, ""); err == nil {
+		t.Error("Expected a failing track to stop everything")
+	}
+	if len(*ran) != 2 {
+		t.Errorf("Expected to stop after the failing track, but played %q", *ran)
+	}
+
+	p, ran = fakePlayer(t, "mpg123")
+	p.run = broken(ran)
+	p.KeepGoing = true
+	if err := doolittle.Play(context.Background(), p, ""); err != nil {
+		t.Fatal("Expected to keep going past the failing track, but got", err)
+	}
+	if len(*ran) != 3 {
+		t.Errorf("Expected to play all 3 tracks, but played %q", *ran)
+	}
+	if !strings.Contains(errs.String(), tame) {
+		t.Errorf("Expected the failing track to be logged, but got %q", errs.String())
+	}
+	if err := p.Failures(); err == nil || !strings.Contains(err.Error(), tame) {
+		t.Error("Expected the failure to be summed up, but got", err)
+	}
+
+	p, _ = fakePlayer(t, "mpg123")
+	p.KeepGoing = true
+	if err := doolittle.Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Failures(); err != nil {
+		t.Error("Expected no failures, but got", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+	)
+	doolittle := filepath.Join(l.root(), "Pixies", "Doolittle")
+
+	p, _ := fakePlayer(t, `mpv --title "splay it"`)
+	var buf bytes.Buffer
+	p.run = dryRun(&buf)
+	if err := newAlbum(l, doolittle, false).Play(context.Background(), p, "tame"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "mpv --title 'splay it' '" + filepath.Join(doolittle, "2 Tame.ogg") + "'\n" +
+		"mpv --title 'splay it' '" + filepath.Join(doolittle, "3 Wave of Mutilation.ogg") + "'\n"
+	if buf.String() != want {
+		t.Errorf("Expected the dry run %q, but got %q", want, buf.String())
+	}
+}
+
+func TestDetectPlayer(t *testing.T) {
+	defer func(lp func(string) (string, error)) { lookPath = lp }(lookPath)
+
+	tests := []struct {
+		installed []string
+		cmd       string
+	}{
+		{[]string{"mpv", "mpg123", "ffplay", "cvlc"}, "mpv --no-video"},
+		{[]string{"cvlc", "mpg123"}, "mpg123"},
+		{[]string{"cvlc", "ffplay"}, "ffplay -nodisp -autoexit"},
+		{[]string{"cvlc"}, "cvlc --play-and-exit"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		var looked []string
+		lookPath = func(file string) (string, error) {
+			looked = append(looked, file)
+			for _, f := range test.installed {
+				if f == file {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		}
+
+		cmd, err := detectPlayer()
+		if test.cmd == "" {
+			if err == nil {
+				t.Errorf("With %q installed, detectPlayer should fail, but got %q", test.installed, cmd)
+			} else if !strings.Contains(err.Error(), strings.Join(looked, ", ")) {
+				t.Errorf("The error should name the players looked for, %q, but got %v", looked, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "darwin" && cmd != test.cmd {
+			t.Errorf("With %q installed, detectPlayer should pick %q, but got %q", test.installed, test.cmd, cmd)
+		}
+	}
+}
+
+func TestKnownPlayers(t *testing.T) {
+	if ps := knownPlayers("darwin"); ps[0][0] != "afplay" {
+		t.Error("afplay should be preferred on macOS, but got", ps)
+	}
+	for _, p := range knownPlayers("linux") {
+		if p[0] == "afplay" {
+			t.Error("afplay shouldn't be tried on Linux")
+		}
+	}
+}
+
+func TestWithVolume(t *testing.T) {
+	defer func(l *logger) { logs = l }(logs)
+	var errs bytes.Buffer
+	logs = &logger{Out: io.Discard, Err: &errs}
+
+	tests := []struct {
+		cmd    []string
+		volume int
+		want   []string
+	}{
+		{[]string{"mpv", "--no-video"}, 50, []string{"mpv", "--no-video", "--volume=50"}},
+		{[]string{"/usr/bin/mpv"}, 0, []string{"/usr/bin/mpv", "--volume=0"}},
+		{[]string{"ffplay", "-nodisp", "-autoexit"}, 75, []string{"ffplay", "-nodisp", "-autoexit", "-volume", "75"}},
+		{[]string{"mpg123"}, 50, []string{"mpg123", "-f", "16384"}},
+		{[]string{"mpg123", "-q"}, 100, []string{"mpg123", "-q", "-f", "32768"}},
+		{[]string{"afplay"}, 25, []string{"afplay", "-v", "0.25"}},
+		{[]string{"cvlc", "--play-and-exit"}, 80, []string{"cvlc", "--play-and-exit", "--gain", "0.8"}},
+		{[]string{`C:\Program Files\mpv\mpv.exe`}, 30, []string{`C:\Program Files\mpv\mpv.exe`, "--volume=30"}},
+	}
+	for _, test := range tests {
+		if runtime.GOOS != "windows" && strings.Contains(test.cmd[0], `\`) {
+			continue
+		}
+		cmd := append([]string{}, test.cmd...)
+		got := withVolume(cmd, test.volume)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q at volume %d should be %q, but got %q", test.cmd, test.volume, test.want, got)
+		}
+		if !reflect.DeepEqual(cmd, test.cmd) {
+			t.Errorf("Setting the volume changed the command %q to %q", test.cmd, cmd)
+		}
+	}
+	if errs.Len() != 0 {
+		t.Errorf("Expected no warnings for known players, but got %q", errs.String())
+	}
+
+	cmd := []string{"ogg123", "-q"}
+	if got := withVolume(cmd, 50); !reflect.DeepEqual(got, cmd) {
+		t.Errorf("Expected an unknown player's command to be left alone, but got %q", got)
+	}
+	if !strings.Contains(errs.String(), "Warning:") || !strings.Contains(errs.String(), "ogg123") {
+		t.Errorf("Expected a warning about ogg123, but got %q", errs.String())
+	}
+}
+
+func TestParsePlayerMap(t *testing.T) {
+	m, err := parsePlayerMap(" flac = ogg123 -q ,, MP3=mpg123,\t.ogg='my player' ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		".flac": {"ogg123", "-q"},
+		".mp3":  {"mpg123"},
+		".ogg":  {"my player"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Expected the player map %q, but got %q", want, m)
+	}
+
+	for _, s := range []string{"flac", "flac=", "=ogg123", "flac='ogg123"} {
+		if _, err := parsePlayerMap(s); err == nil {
+			t.Errorf("parsePlayerMap(%q) should fail", s)
+		}
+	}
+}
+
+func TestParseBatchArgs(t *testing.T) {
+	m, err := parseBatchArgs("flac=--gapless-audio=yes,, MP3 = --af='volume=2' -q,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		".flac": {"--gapless-audio=yes"},
+		".mp3":  {"--af=volume=2", "-q"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Expected the batch arguments %q, but got %q", want, m)
+	}
+
+	for _, s := range []string{"flac", "flac=", "=--gapless-audio=yes", "flac='-q"} {
+		if _, err := parseBatchArgs(s); err == nil {
+			t.Errorf("parseBatchArgs(%q) should fail", s)
+		}
+	}
+}
+
+func TestBatchCommand(t *testing.T) {
+	p, _ := fakePlayer(t, "mpv --no-video")
+	var err error
+	p.BatchArgs, err = parseBatchArgs("flac=--gapless-audio=yes,mp3=--audio-samplerate=44100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		paths []string
+		want  []string
+	}{
+		{[]string{"1.flac", "2.FLAC"}, []string{"mpv", "--no-video", "--gapless-audio=yes"}},
+		{[]string{"1.ogg", "2.mp3", "3.flac", "4.mp3"}, []string{"mpv", "--no-video", "--audio-samplerate=44100", "--gapless-audio=yes"}},
+		{[]string{"1.ogg"}, []string{"mpv", "--no-video"}},
+		{nil, []string{"mpv", "--no-video"}},
+	}
+	for _, test := range tests {
+		if got := p.batchCommand(test.paths); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expected to play %q with %q, but got %q", test.paths, test.want, got)
+		}
+	}
+	if want := []string{"mpv", "--no-video"}; !reflect.DeepEqual(p.Cmd, want) {
+		t.Errorf("The player's command shouldn't change, but it's %q", p.Cmd)
+	}
+}
+
+func TestPlayerByExt(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.flac",
+		"Pixies/Doolittle/2 Tame.MP3",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+	)
+	doolittle := filepath.Join(l.root(), "Pixies", "Doolittle")
+
+	p, ran := fakePlayer(t, "mpv")
+	var err error
+	p.ByExt, err = parsePlayerMap("flac=ogg123,mp3=mpg123 -q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newAlbum(l, doolittle, false).Play(context.Background(), p, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"ogg123", filepath.Join(doolittle, "1 Debaser.flac")},
+		{"mpg123", "-q", filepath.Join(doolittle, "2 Tame.MP3")},
+		{"mpv", filepath.Join(doolittle, "3 Wave of Mutilation.ogg")},
+	}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("Expected to run %q, but ran %q", want, *ran)
+	}
+}
+
+func TestPlayAll(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+	)
+	pixies := filepath.Join(l.root(), "Pixies")
+
+	defer func(l *logger) { logs, shuffleAlbums = l, true }(logs)
+	var out bytes.Buffer
+	logs = &logger{Out: &out, Err: &out}
+	shuffleAlbums = false
+
+	paths, err := newArtist(l, pixies).Tracks("surfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ran := fakePlayer(t, "mpv --no-video")
+	p.Tracks = true
+	if err := p.PlayAll(context.Background(), paths); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{
+		"mpv", "--no-video",
+		filepath.Join(pixies, "Surfer Rosa", "1 Bone Machine.ogg"),
+		filepath.Join(pixies, "Doolittle", "1 Debaser.ogg"),
+		filepath.Join(pixies, "Doolittle", "2 Tame.ogg"),
+	}}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("Expected to run just %q, but ran %q", want, *ran)
+	}
+	names := "Pixies/Surfer Rosa/1 Bone Machine\nPixies/Doolittle/1 Debaser\nPixies/Doolittle/2 Tame\n"
+	if out.String() != names {
+		t.Errorf("Expected the names of the tracks first, %q, but got %q", names, out.String())
+	}
+
+	*ran = nil
+	p.Max = 2
+	if err := p.PlayAll(context.Background(), paths); err != nil {
+		t.Fatal(err)
+	}
+	if len(*ran) != 1 || len((*ran)[0]) != 4 {
+		t.Errorf("With -max 2, expected to run the player with 2 tracks, but ran %q", *ran)
+	}
+
+	*ran = nil
+	p.Max = 0
+	p.BatchArgs = map[string][]string{".ogg": {"--gapless-audio=yes"}}
+	if err := p.PlayAll(context.Background(), paths[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want = [][]string{{"mpv", "--no-video", "--gapless-audio=yes", paths[0]}}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("Expected the batch arguments before the tracks, running %q, but ran %q", want, *ran)
+	}
+}
+
+func TestPlayerStderr(t *testing.T) {
+	p, _ := fakePlayer(t, "mpg123")
+	fail := errors.New("exit status 2")
+	for _, err := range []error{fail, nil} {
+		p.run = func(c *exec.Cmd) error {
+			fmt.Fprint(c.Stderr, "mpg123 1.32\n\nTrying the default device\nNo such audio device\n")
+			return err
+		}
+		got := p.Play(context.Background(), "/music/Pixies/Doolittle/1 Debaser.mp3")
+		if err == nil {
+			if got != nil {
+				t.Error("Expected what a player says on stderr not to matter if it succeeds, but got", got)
+			}
+			continue
+		}
+		want := "exit status 2: mpg123 1.32; Trying the default device; No such audio device"
+		if got == nil || got.Error() != want {
+			t.Errorf("Expected the player's failure to say %q, but got %v", want, got)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{n: 8}
+	fmt.Fprint(b, "first\nsecond\n")
+	fmt.Fprint(b, "third\n")
+	if got := string(b.buf); got != "d\nthird\n" {
+		t.Errorf("Expected to keep the last 8 bytes, but kept %q", got)
+	}
+	if got := b.lastLines(1); got != "third" {
+		t.Errorf("Expected the last line to be third, but got %q", got)
+	}
+}
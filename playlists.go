@@ -0,0 +1,88 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// playlistDir returns the folder where named playlists are kept:
+// playlists in the configDir.
+func playlistDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "playlists"), nil
+}
+
+// playlistFileIn returns the path of the playlist with the given name
+// in dir. Names can't hold separators, so that they stay in dir.
+func playlistFileIn(dir, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", newError("%q can't be the name of a playlist; try a name without slashes.", name)
+	}
+	return filepath.Join(dir, name+".m3u"), nil
+}
+
+// savePlaylist saves the tracks at paths as the playlist with the
+// given name in dir, replacing any it had before, and returns the
+// path of its file.
+func savePlaylist(dir, name string, paths []string) (string, error) {
+	file, err := playlistFileIn(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", newError("There are no tracks to save in the playlist %s.", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := writeM3U(&b, paths); err != nil {
+		return "", err
+	}
+	return file, replaceFile(file, []byte(b.String()))
+}
+
+// playlistNames returns the names of the playlists in dir, in order.
+func playlistNames(dir string) ([]string, error) {
+	es, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range es {
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".m3u") {
+			names = append(names, trimExt(e.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// printPlaylists prints the names of the playlists in dir to w.
+func printPlaylists(w io.Writer, dir string) error {
+	names, err := playlistNames(dir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return newError("There aren't any playlists yet. Save one with -save-as.")
+	}
+	for _, n := range names {
+		fmt.Fprintln(w, n)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSavePlaylist(t *testing.T) {
+	root := mkLibrary(t,
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+	)
+	lib := dirLibrary(root)
+	selection := newQueue([]Music{
+		newAlbum(lib, filepath.Join(root, "Weezer", "Pinkerton"), false),
+		newAlbum(lib, filepath.Join(root, "Pixies", "Doolittle"), false),
+	})
+	want, err := selection.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "splay", "playlists")
+	file, err := savePlaylist(dir, "roadtrip", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != filepath.Join(dir, "roadtrip.m3u") {
+		t.Errorf("Expected the playlist to be saved in roadtrip.m3u, but it's in %s", file)
+	}
+
+	loaded, err := playlistFileIn(dir, "roadtrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LocatePlaylist(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Tracks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the playlist to hold\n%q\nbut it held\n%q", want, got)
+	}
+
+	if _, err := savePlaylist(dir, "road trip", want[:1]); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := printPlaylists(&b, dir); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "road trip\nroadtrip\n" {
+		t.Errorf("Expected both playlists to be listed, but got %q", b.String())
+	}
+
+	for _, bad := range []string{"", "..", "trips/road"} {
+		if _, err := savePlaylist(dir, bad, want); err == nil {
+			t.Errorf("Expected an error saving a playlist named %q", bad)
+		}
+	}
+	if err := printPlaylists(&b, filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Error("Expected an error when there are no playlists")
+	}
+}
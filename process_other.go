@@ -0,0 +1,11 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// ownProcessGroup does nothing, since process groups are peculiar to
+// Unix. Cancelling c kills only the player.
+func ownProcessGroup(c *exec.Cmd) {}
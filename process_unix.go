@@ -0,0 +1,21 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ownProcessGroup makes c run in a process group of its own, so that
+// interrupting splay from the terminal interrupts only splay, which
+// then decides what to do with the player, and so that when c is
+// cancelled, whatever the player has started is killed along with it.
+func ownProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+}
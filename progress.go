@@ -0,0 +1,54 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// formatProgress formats how much of a track of the given length has
+// played, and how much is left, e.g. "01:05 / 03:30, 02:25 left".
+func formatProgress(elapsed, length time.Duration) string {
+	elapsed = min(max(elapsed, 0), length)
+	return fmt.Sprintf("%s / %s, %s left",
+		formatDuration(elapsed, true), formatDuration(length, true), formatDuration(length-elapsed, true))
+}
+
+// showProgress keeps a line on p.Progress, saying how much of the track
+// at path has played since began, up to date every second, until the
+// returned function is called, which clears it. Nothing is shown if
+// p.Progress is nil, or the length of the track can't be told.
+func (p *Player) showProgress(path string, began time.Time) (stop func()) {
+	if p.Progress == nil {
+		return func() {}
+	}
+	length, known := p.length(path)
+	if !known {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	cleared := make(chan struct{})
+	go func() {
+		defer close(cleared)
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		width := 0
+		for {
+			line := formatProgress(p.now().Sub(began), length)
+			width = max(width, len(line))
+			fmt.Fprintf(p.Progress, "\r%-*s", width, line)
+			select {
+			case <-tick.C:
+			case <-done:
+				fmt.Fprintf(p.Progress, "\r%*s\r", width, "")
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-cleared
+	}
+}
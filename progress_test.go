@@ -0,0 +1,55 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		elapsed, length time.Duration
+		want            string
+	}{
+		{0, 3*time.Minute + 30*time.Second, "00:00 / 03:30, 03:30 left"},
+		{65 * time.Second, 3*time.Minute + 30*time.Second, "01:05 / 03:30, 02:25 left"},
+		{65*time.Second + 400*time.Millisecond, 2 * time.Minute, "01:05 / 02:00, 00:55 left"},
+		{5 * time.Minute, 2 * time.Minute, "02:00 / 02:00, 00:00 left"},
+		{-time.Second, time.Minute, "00:00 / 01:00, 01:00 left"},
+		{time.Hour, 70 * time.Minute, "60:00 / 70:00, 10:00 left"},
+	}
+	for _, test := range tests {
+		if got := formatProgress(test.elapsed, test.length); got != test.want {
+			t.Errorf("Expected %v of %v to be %q, but got %q", test.elapsed, test.length, test.want, got)
+		}
+	}
+}
+
+func TestShowProgress(t *testing.T) {
+	p, _ := fakePlayer(t, "mpv")
+	began := time.Now()
+	p.now = func() time.Time { return began.Add(65 * time.Second) }
+	p.length = func(string) (time.Duration, bool) { return 3 * time.Minute, true }
+
+	// Without somewhere to show it, there's no progress.
+	p.showProgress("/music/Pixies/Doolittle/1 Debaser.ogg", began)()
+
+	var b bytes.Buffer
+	p.Progress = &b
+	p.showProgress("/music/Pixies/Doolittle/1 Debaser.ogg", began)()
+	line := "01:05 / 03:00, 01:55 left"
+	want := "\r" + line + "\r" + strings.Repeat(" ", len(line)) + "\r"
+	if b.String() != want {
+		t.Errorf("Expected the progress %q, then for it to be cleared, but got %q", line, b.String())
+	}
+
+	b.Reset()
+	p.length = func(string) (time.Duration, bool) { return 0, false }
+	p.showProgress("/music/Pixies/Doolittle/1 Debaser.ogg", began)()
+	if b.Len() != 0 {
+		t.Errorf("Expected no progress for a track of unknown length, but got %q", b.String())
+	}
+}
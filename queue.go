@@ -0,0 +1,112 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// A queue represents several things, played one after another.
+type queue struct {
+	ms []Music
+}
+
+func newQueue(ms []Music) Music {
+	return &queue{ms}
+}
+
+// Path returns the path of the first thing in the queue.
+func (q *queue) Path() string {
+	return q.ms[0].Path()
+}
+
+func (q *queue) Kind() string {
+	return "queue"
+}
+
+// String returns the kind and path of everything in the queue, in turn,
+// e.g. "queue: album: /music/Weezer/Blue, artist: /music/Pixies".
+func (q *queue) String() string {
+	s := make([]string, len(q.ms))
+	for i, m := range q.ms {
+		s[i] = m.String()
+	}
+	return "queue: " + strings.Join(s, ", ")
+}
+
+// Play plays everything in the queue, in turn. Only the first
+// thing starts at the track matching start.
+func (q *queue) Play(ctx context.Context, p *Player, start string) error {
+	for _, m := range q.ms {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := m.Play(ctx, p, start); err != nil {
+			return err
+		}
+		start = ""
+	}
+	return nil
+}
+
+func (q *queue) List(w io.Writer, start string) error {
+	if listJSON {
+		paths, err := q.Tracks(start)
+		if err != nil {
+			return err
+		}
+		ts, err := listTracks(paths)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, ts)
+	}
+	for _, m := range q.ms {
+		if err := m.List(w, start); err != nil {
+			return err
+		}
+		start = ""
+	}
+	return nil
+}
+
+func (q *queue) Tracks(start string) ([]string, error) {
+	var paths []string
+	for _, m := range q.ms {
+		ps, err := m.Tracks(start)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, ps...)
+		start = ""
+	}
+	return paths, nil
+}
+
+// locateAll returns a queue of the things found by locate for each of
+// the patterns, in order. If nothing is found for a pattern, it's an
+// error if strict is set, and otherwise the pattern is skipped, with
+// a warning.
+func locateAll(patterns []string, locate func(string) (Music, error), strict bool) (Music, error) {
+	var ms []Music
+	for _, pattern := range patterns {
+		m, err := locate(pattern)
+		if err == nil && m == nil {
+			err = newError("Failed to find %q", pattern)
+		}
+		if err != nil {
+			if strict {
+				return nil, err
+			}
+			logs.Warn(newError("%v, so it's skipped.", err))
+			continue
+		}
+		ms = append(ms, m)
+	}
+	if len(ms) == 0 {
+		return nil, newError("I failed to find anything to play.")
+	}
+	return newQueue(ms), nil
+}
@@ -0,0 +1,80 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	l := mapLibrary(
+		"Pavement/Slanted and Enchanted/1 Summer Babe.ogg",
+		"Pavement/Slanted and Enchanted/2 Trigger Cut.ogg",
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+	)
+	locate := func(pattern string) (Music, error) {
+		ms, err := matches(l, pattern)
+		if err != nil || len(ms) == 0 {
+			return nil, err
+		}
+		return ms[0], nil
+	}
+
+	tests := []struct {
+		patterns []string
+		strict   bool
+		played   []string
+		ok       bool
+	}{
+		{
+			[]string{"blue", "slanted", "doolittle"},
+			false,
+			[]string{"1 My Name Is Jonas.ogg", "1 Summer Babe.ogg", "2 Trigger Cut.ogg", "1 Debaser.ogg", "2 Tame.ogg"},
+			true,
+		},
+		{
+			[]string{"doolittle", "the who", "pinkerton"},
+			false,
+			[]string{"1 Debaser.ogg", "2 Tame.ogg", "1 Tired of Sex.ogg"},
+			true,
+		},
+		{[]string{"doolittle", "the who", "pinkerton"}, true, nil, false},
+		{[]string{"the who", "the kinks"}, false, nil, false},
+	}
+	for _, test := range tests {
+		m, err := locateAll(test.patterns, locate, test.strict)
+		if (err == nil) != test.ok {
+			t.Errorf("Queueing %q gave the error %v", test.patterns, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		p, ran := fakePlayer(t, "mpg123")
+		if err := m.Play(context.Background(), p, ""); err != nil {
+			t.Fatal(err)
+		}
+		var played []string
+		for _, args := range *ran {
+			played = append(played, filepath.Base(args[1]))
+		}
+		if !reflect.DeepEqual(played, test.played) {
+			t.Errorf("Queueing %q, expected to play %q, but played %q", test.patterns, test.played, played)
+		}
+
+		tracks, err := m.Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tracks) != len(test.played) {
+			t.Errorf("Queueing %q, expected Tracks to give what was played, but got %q", test.patterns, tracks)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitArgs splits a command line into its words, like a shell would.
+// Words are separated by spaces, unless the spaces are within single
+// or double quotes or escaped with a backslash. Backslashes escape any
+// rune outside of single quotes.
+//
+// E.g. splitArgs(`"my player" --title 'A B' C\ D`) returns
+// ["my player", "--title", "A B", "C D"].
+func splitArgs(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && quote != '\'':
+			i++
+			if i == len(rs) {
+				return nil, newError("There's a trailing backslash in %q", s)
+			}
+			word.WriteRune(rs[i])
+			inWord = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, newError("There's an unterminated %c quote in %q", quote, s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// joinArgs returns a command line for the words of args, quoting
+// them as needed, such that splitArgs would return args.
+//
+// E.g. joinArgs(["mpv", "1 Debaser.ogg"]) returns `mpv '1 Debaser.ogg'`.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && !strings.ContainsFunc(a, needsQuote) {
+			quoted[i] = a
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// needsQuote returns true iff r must be quoted in a word of a
+// command line.
+func needsQuote(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`'"\$&|;<>()*?[]{}~#!`+"`", r)
+}
+
+// parseValue returns the value of a setting, with surrounding space
+// removed. A value may be quoted, in which case it is unquoted as by
+// splitArgs and must be the only word.
+func parseValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) && !strings.HasPrefix(s, "'") {
+		return s, nil
+	}
+
+	words, err := splitArgs(s)
+	if err != nil {
+		return "", err
+	}
+	if len(words) != 1 {
+		return "", newError("There's more than one quoted value in %q", s)
+	}
+	return words[0], nil
+}
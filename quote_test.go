@@ -0,0 +1,94 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s     string
+		words []string
+	}{
+		{"mpg123", []string{"mpg123"}},
+		{"  mpv   --no-video ", []string{"mpv", "--no-video"}},
+		{`"my player" --flag`, []string{"my player", "--flag"}},
+		{`'my player' --title 'A "B"'`, []string{"my player", "--title", `A "B"`}},
+		{`my\ player --x="a b"`, []string{"my player", "--x=a b"}},
+		{`"say \"hi\""`, []string{`say "hi"`}},
+		{`'C:\Music'`, []string{`C:\Music`}},
+		{`""`, []string{""}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		words, err := splitArgs(test.s)
+		if err != nil {
+			t.Errorf("splitArgs(%q) failed: %v", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(words, test.words) {
+			t.Errorf("splitArgs(%q) should be %q, but got %q", test.s, test.words, words)
+		}
+	}
+
+	for _, s := range []string{`"unterminated`, `'unterminated`, `trailing\`} {
+		if _, err := splitArgs(s); err == nil {
+			t.Errorf("splitArgs(%q) should fail", s)
+		}
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	tests := []struct {
+		words []string
+		s     string
+	}{
+		{[]string{"mpg123", "/music/Debaser.ogg"}, "mpg123 /music/Debaser.ogg"},
+		{[]string{"mpv", "--no-video", "/music/1 Debaser.ogg"}, "mpv --no-video '/music/1 Debaser.ogg'"},
+		{[]string{"mpv", "It's Me.ogg"}, `mpv 'It'\''s Me.ogg'`},
+		{[]string{"play", ""}, "play ''"},
+		{[]string{"play", `$HOME\a"b`}, `play '$HOME\a"b'`},
+	}
+
+	for _, test := range tests {
+		s := joinArgs(test.words)
+		if s != test.s {
+			t.Errorf("joinArgs(%q) should be %q, but got %q", test.words, test.s, s)
+		}
+		words, err := splitArgs(s)
+		if err != nil || !reflect.DeepEqual(words, test.words) {
+			t.Errorf("splitArgs(joinArgs(%q)) should give them back, but got %q, %v", test.words, words, err)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		s, v string
+	}{
+		{" AC/DC ", "AC/DC"},
+		{"Bob Dylan & The Band", "Bob Dylan & The Band"},
+		{`"  Bob Dylan  "`, "  Bob Dylan  "},
+		{`'AC/DC'`, "AC/DC"},
+		{`"Guns N' Roses"`, "Guns N' Roses"},
+		{`"\"Weird Al\" Yankovic"`, `"Weird Al" Yankovic`},
+	}
+
+	for _, test := range tests {
+		v, err := parseValue(test.s)
+		if err != nil {
+			t.Errorf("parseValue(%q) failed: %v", test.s, err)
+			continue
+		}
+		if v != test.v {
+			t.Errorf("parseValue(%q) should be %q, but got %q", test.s, test.v, v)
+		}
+	}
+
+	if _, err := parseValue(`"a" "b"`); err == nil {
+		t.Error("parseValue should reject more than one quoted value")
+	}
+}
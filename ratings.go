@@ -0,0 +1,75 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultRatings returns where the ratings of tracks are kept:
+// ratings.json in the dataDir.
+func defaultRatings() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ratings.json"), nil
+}
+
+// maxRating is the best rating a track can have. The worst is 1,
+// and tracks which haven't been rated are rated 0.
+const maxRating = 5
+
+// A ratings keeps the ratings of tracks, keyed by the tracks' paths,
+// as a JSON object in the file at its path.
+type ratings string
+
+// Rate rates the track at path, from 1 to maxRating, or forgets
+// its rating if rating is 0.
+func (r ratings) Rate(path string, rating int) error {
+	if rating < 0 || rating > maxRating {
+		return newError("Ratings go from 1 to %d, or 0 to forget one, so I can't rate a track %d.", maxRating, rating)
+	}
+	err := updateTrackNumbers(string(r), func(rs map[string]int) {
+		if rating == 0 {
+			delete(rs, path)
+		} else {
+			rs[path] = rating
+		}
+	})
+	if err != nil {
+		return newError("Couldn't rate %s: %v", path, err)
+	}
+	return nil
+}
+
+// Read returns the rating of each track which has one, by path.
+func (r ratings) Read() (map[string]int, error) {
+	return readTrackNumbers(string(r))
+}
+
+// minRating is the least rating of the tracks which are played.
+// Tracks rated less, or not at all, are left out.
+var minRating = 0
+
+// trackRatings holds the rating of each track which has one, by path.
+// It's only needed if minRating is positive.
+var trackRatings map[string]int
+
+// rated returns the songs, and their paths, which are rated at
+// least minRating.
+func rated(songs []os.FileInfo, paths []string) ([]os.FileInfo, []string) {
+	if minRating <= 0 {
+		return songs, paths
+	}
+	var rsongs []os.FileInfo
+	var rpaths []string
+	for i, path := range paths {
+		if trackRatings[path] >= minRating {
+			rsongs = append(rsongs, songs[i])
+			rpaths = append(rpaths, path)
+		}
+	}
+	return rsongs, rpaths
+}
@@ -0,0 +1,105 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRatings(t *testing.T) {
+	r := ratings(filepath.Join(t.TempDir(), "new", "ratings.json"))
+	debaser := filepath.FromSlash("/music/Pixies/Doolittle/1 Debaser.ogg")
+	tame := filepath.FromSlash("/music/Pixies/Doolittle/2 Tame.ogg")
+
+	for _, rate := range []struct {
+		path   string
+		rating int
+	}{
+		{debaser, 3},
+		{tame, 4},
+		{debaser, 5},
+	} {
+		if err := r.Rate(rate.path, rate.rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, bad := range []int{-1, 6} {
+		if err := r.Rate(tame, bad); err == nil {
+			t.Errorf("Expected an error for the rating %d", bad)
+		}
+	}
+
+	rs, err := ratings(string(r)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{debaser: 5, tame: 4}; !reflect.DeepEqual(rs, want) {
+		t.Errorf("Expected the ratings %v, but got %v", want, rs)
+	}
+
+	if err := r.Rate(tame, 0); err != nil {
+		t.Fatal(err)
+	}
+	rs, err = r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{debaser: 5}; !reflect.DeepEqual(rs, want) {
+		t.Errorf("Expected rating a track 0 to forget its rating, but got %v", rs)
+	}
+}
+
+func TestMinRating(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+		"Pixies/Surfer Rosa/1 Bone Machine.ogg",
+		"Pixies/Surfer Rosa/2 Break My Body.ogg",
+	)
+	path := func(p string) string { return filepath.Join(l.root(), filepath.FromSlash(p)) }
+
+	defer func() { minRating, trackRatings = 0, nil }()
+	trackRatings = map[string]int{
+		path("Pixies/Doolittle/1 Debaser.ogg"):            5,
+		path("Pixies/Doolittle/2 Tame.ogg"):               3,
+		path("Pixies/Doolittle/3 Wave of Mutilation.ogg"): 4,
+		path("Pixies/Surfer Rosa/2 Break My Body.ogg"):    1,
+	}
+
+	tests := []struct {
+		min   int
+		music Music
+		want  []string
+	}{
+		{0, newAlbum(l, path("Pixies/Doolittle"), false), []string{"1 Debaser.ogg", "2 Tame.ogg", "3 Wave of Mutilation.ogg"}},
+		{4, newAlbum(l, path("Pixies/Doolittle"), false), []string{"1 Debaser.ogg", "3 Wave of Mutilation.ogg"}},
+		{4, newCollection(l, true), []string{"1 Debaser.ogg", "3 Wave of Mutilation.ogg"}},
+		{1, newCollection(l, true), []string{"1 Debaser.ogg", "2 Break My Body.ogg", "2 Tame.ogg", "3 Wave of Mutilation.ogg"}},
+		{4, newAlbum(l, path("Pixies/Surfer Rosa"), false), nil},
+	}
+	for _, test := range tests {
+		minRating = test.min
+		paths, err := test.music.Tracks("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range paths {
+			got = append(got, filepath.Base(p))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Rated at least %d, expected %q from %s, but got %q", test.min, test.want, test.music.Path(), got)
+		}
+	}
+
+	minRating = 5
+	trackRatings = map[string]int{}
+	if _, err := newCollection(l, true).Tracks(""); err == nil {
+		t.Error("Expected an error when no tracks are rated well enough")
+	}
+}
@@ -0,0 +1,194 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A command is something asked for at the prompt of -i.
+type command struct {
+	verb string // what to do
+	arg  string // what to do it to, if anything
+}
+
+// The verbs of commands, and the help for each.
+var commandHelp = []struct{ verb, help string }{
+	{"play", "play PATTERN: play the artist or album matching PATTERN"},
+	{"album", "album PATTERN: play the album matching PATTERN"},
+	{"list", "list: list what's playing"},
+	{"skip", "skip: skip to the next track"},
+	{"next", "next: the same as skip"},
+	{"stop", "stop: stop playing"},
+	{"help", "help: print this"},
+	{"quit", "quit: stop playing, and quit"},
+}
+
+// parseCommand parses a line typed at the prompt into a command.
+// An empty line is an empty command.
+func parseCommand(line string) (command, error) {
+	verb, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	c := command{strings.ToLower(verb), strings.TrimSpace(arg)}
+	switch c.verb {
+	case "":
+		return c, nil
+	case "play", "album":
+		if c.arg == "" {
+			return command{}, newError("What should I %s? Try something like: %s pinkerton", c.verb, c.verb)
+		}
+		return c, nil
+	case "list", "skip", "next", "stop", "help", "quit":
+		if c.arg != "" {
+			return command{}, newError("%s doesn't take anything after it.", c.verb)
+		}
+		return c, nil
+	}
+	return command{}, newError("I don't know how to %q. Type help to see what I can do.", c.verb)
+}
+
+// A session is the state of -i: what's selected, and
+// whether it's being played.
+type session struct {
+	lib *Library
+	p   *Player
+	out io.Writer
+
+	current Music              // what was last selected
+	stop    context.CancelFunc // stops the playing of current, if it's playing
+	done    chan error         // gives the result of playing current
+
+	// play plays m, and skip skips the track being played.
+	// They're replaced in tests.
+	play func(ctx context.Context, m Music) error
+	skip func()
+}
+
+func newSession(lib *Library, p *Player, out io.Writer) *session {
+	return &session{
+		lib: lib,
+		p:   p,
+		out: out,
+		play: func(ctx context.Context, m Music) error {
+			p.reset()
+			return m.Play(ctx, p, "")
+		},
+		skip: p.Skip,
+	}
+}
+
+// run reads commands from r, one per line, and does them, until r
+// is done, it's told to quit, or ctx is done, when ctx's error is
+// returned. Whatever is playing is stopped before it returns.
+func (s *session) run(ctx context.Context, r io.Reader) error {
+	defer s.halt()
+	lines := make(chan string)
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		in := bufio.NewScanner(r)
+		for in.Scan() {
+			select {
+			case lines <- in.Text():
+			case <-stopped:
+				return
+			}
+		}
+		done <- in.Err()
+	}()
+	for {
+		fmt.Fprint(s.out, "splay> ")
+		var line string
+		select {
+		case line = <-lines:
+		case err := <-done:
+			fmt.Fprintln(s.out)
+			return err
+		case <-ctx.Done():
+			fmt.Fprintln(s.out)
+			return ctx.Err()
+		}
+		c, err := parseCommand(line)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			continue
+		}
+		quit, err := s.do(c)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// do does the command c, returning true if it's time to quit.
+func (s *session) do(c command) (quit bool, err error) {
+	switch c.verb {
+	case "play", "album":
+		var m Music
+		if c.verb == "album" {
+			m, err = s.lib.LocateAlbum(c.arg)
+		} else {
+			var ms []Music
+			ms, err = matches(s.lib, c.arg)
+			if len(ms) > 0 {
+				m = ms[0]
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		if m == nil {
+			return false, newError("Failed to find %q", c.arg)
+		}
+		s.halt()
+		s.current = m
+		s.start()
+	case "list":
+		if s.current == nil {
+			return false, newError("Nothing's been picked to play yet.")
+		}
+		return false, s.current.List(s.out, "")
+	case "skip", "next":
+		s.skip()
+	case "stop":
+		s.halt()
+	case "help":
+		for _, h := range commandHelp {
+			fmt.Fprintln(s.out, h.help)
+		}
+	case "quit":
+		return true, nil
+	}
+	return false, nil
+}
+
+// start starts playing the current selection.
+func (s *session) start() {
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	s.done = make(chan error, 1)
+	go func(m Music, done chan<- error) {
+		err := s.play(ctx, m)
+		if err != nil && err != context.Canceled && err != errEnough {
+			logs.Error(err)
+		}
+		done <- err
+	}(s.current, s.done)
+}
+
+// halt stops playing, if anything is, and waits for it to stop.
+func (s *session) halt() {
+	if s.stop == nil {
+		return
+	}
+	s.stop()
+	<-s.done
+	s.stop, s.done = nil, nil
+}
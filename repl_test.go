@@ -0,0 +1,170 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want command
+		ok   bool
+	}{
+		{"play weezer", command{"play", "weezer"}, true},
+		{"  PLAY  the pixies ", command{"play", "the pixies"}, true},
+		{"album pinkerton", command{"album", "pinkerton"}, true},
+		{"skip", command{"skip", ""}, true},
+		{"", command{}, true},
+		{"play", command{}, false},
+		{"skip 2", command{}, false},
+		{"dance", command{}, false},
+	}
+	for _, test := range tests {
+		c, err := parseCommand(test.line)
+		if (err == nil) != test.ok || c != test.want {
+			t.Errorf("parseCommand(%q) = %v, %v; expected %v, ok=%v", test.line, c, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+	)
+	var out bytes.Buffer
+	s := newSession(l, nil, &out)
+
+	// Each thing played plays until it's stopped, and skipping
+	// waits for it to start.
+	var mu sync.Mutex
+	var actions []string
+	act := func(a string) {
+		mu.Lock()
+		actions = append(actions, a)
+		mu.Unlock()
+	}
+	playing := make(chan bool, 1)
+	s.play = func(ctx context.Context, m Music) error {
+		act("play " + filepath.Base(m.Path()))
+		playing <- true
+		<-ctx.Done()
+		act("stopped " + filepath.Base(m.Path()))
+		return ctx.Err()
+	}
+	s.skip = func() {
+		<-playing
+		act("skip")
+	}
+
+	script := []string{
+		"list",
+		"play weezer",
+		"skip",
+		"album pinkerton",
+		"next",
+		"list",
+		"dance",
+		"stop",
+		"stop",
+		"play pixies",
+		"quit",
+		"play weezer",
+	}
+	if err := s.run(context.Background(), strings.NewReader(strings.Join(script, "\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"play Weezer",
+		"skip",
+		"stopped Weezer",
+		"play Pinkerton",
+		"skip",
+		"stopped Pinkerton",
+		"play Pixies",
+		"stopped Pixies",
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("Expected the actions\n%q\nbut got\n%q", want, actions)
+	}
+	for _, said := range []string{"Nothing's been picked", "1 Tired of Sex", "I don't know how to \"dance\""} {
+		if !strings.Contains(out.String(), said) {
+			t.Errorf("Expected the output to say %q, but it was:\n%s", said, out.String())
+		}
+	}
+}
+
+func TestSessionCancelled(t *testing.T) {
+	l := mapLibrary("Weezer/Blue/1 My Name Is Jonas.ogg")
+	var out bytes.Buffer
+	s := newSession(l, nil, &out)
+	playing := make(chan bool, 1)
+	stopped := make(chan bool, 1)
+	s.play = func(ctx context.Context, m Music) error {
+		playing <- true
+		<-ctx.Done()
+		stopped <- true
+		return ctx.Err()
+	}
+
+	// The prompt is left waiting for more, as at a terminal,
+	// when splay is told to quit.
+	r, w := io.Pipe()
+	defer w.Close()
+	go io.WriteString(w, "play weezer\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-playing
+		cancel()
+	}()
+	if err := s.run(ctx, r); err != context.Canceled {
+		t.Errorf("Expected the session to be cancelled, but got %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("Expected playing to be stopped when the session was")
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Blue/2 No One Else.ogg",
+	)
+	p, ran := fakePlayer(t, "mpg123")
+	p.Max = 2
+	p.StopAfter = time.Minute
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	s := newSession(l, p, io.Discard)
+
+	// Each thing played gets the whole of -max and -stop-after.
+	for _, album := range []string{"Doolittle", "Blue", "Doolittle"} {
+		m, err := l.LocateAlbum(album)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.play(context.Background(), m); err != errEnough {
+			t.Errorf("Expected playing %s to stop after its 2 tracks, but got %v", album, err)
+		}
+		now = now.Add(time.Hour)
+	}
+	if len(*ran) != 6 {
+		t.Errorf("Expected both tracks of each album to be played, but played %q", *ran)
+	}
+}
@@ -0,0 +1,209 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// A resumePoint is where playing was stopped: the tracks which were
+// left to play, starting with the one which was playing, and how far
+// into that one it had got, if that could be told.
+type resumePoint struct {
+	Paths    []string      `json:"paths"`
+	Position time.Duration `json:"position"`
+}
+
+// defaultResume returns where the resumePoint is kept: resume.json
+// in the dataDir.
+func defaultResume() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "resume.json"), nil
+}
+
+// resumeFrom returns the resumePoint for having stopped at pos in the
+// track at path, the first of plan's tracks to be it, or false if
+// it isn't one of them.
+func resumeFrom(plan []string, path string, pos time.Duration) (resumePoint, bool) {
+	for i, p := range plan {
+		if p == path {
+			return resumePoint{plan[i:], pos}, true
+		}
+	}
+	return resumePoint{}, false
+}
+
+// saveResume keeps r in file, replacing whatever was there.
+func saveResume(file string, r resumePoint) error {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// loadResume returns the resumePoint kept in file.
+func loadResume(file string) (resumePoint, error) {
+	var r resumePoint
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, newError("There's nothing to resume; splay hasn't been stopped partway through anything.")
+	}
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, newError("I don't understand %s: %v", file, err)
+	}
+	if len(r.Paths) == 0 {
+		return r, newError("There's nothing to resume in %s", file)
+	}
+	return r, nil
+}
+
+// keepResumePoint saves where p was stopped, in the tracks of m from
+// start, for -resume. It's warned about if that can't be done.
+func keepResumePoint(p *Player, m Music, start string) {
+	path, pos, ok := p.Stopped()
+	if !ok {
+		return
+	}
+	plan, err := m.Tracks(start)
+	if err != nil {
+		logs.Warn(err)
+		return
+	}
+	r, ok := resumeFrom(plan, path, pos)
+	if !ok {
+		return
+	}
+	// It may be resumed from elsewhere.
+	for i, path := range r.Paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			r.Paths[i] = abs
+		}
+	}
+	file, err := defaultResume()
+	if err == nil {
+		err = saveResume(file, r)
+	}
+	if err != nil {
+		logs.Warn(newError("Couldn't keep where playing stopped, to resume it: %v", err))
+	}
+}
+
+// forgetResumePoint removes the saved resumePoint, once what was left
+// of it has been played.
+func forgetResumePoint() {
+	file, err := defaultResume()
+	if err == nil {
+		err = os.Remove(file)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logs.Warn(err)
+	}
+}
+
+// isMPV returns true iff cmd runs mpv, which can say how far into a
+// track it is, and start partway through one.
+func isMPV(cmd []string) bool {
+	name := filepath.Base(cmd[0])
+	return name == "mpv" || name == "mpv.exe"
+}
+
+// withStart returns cmd with the argument which has it start playing d
+// into the track, or false if it's not known to be able to.
+func withStart(cmd []string, d time.Duration) ([]string, bool) {
+	if !isMPV(cmd) {
+		return cmd, false
+	}
+	s := strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+	return append(cmd[:len(cmd):len(cmd)], "--start="+s), true
+}
+
+// positionEvery is how often mpv is asked how far into a track it is.
+// It is shortened in tests.
+var positionEvery = time.Second
+
+// watchPosition returns cmd with the argument which has mpv listen for
+// questions on a socket, if it's mpv, and starts asking it how far into
+// the track it is, as of from, every positionEvery. The returned function
+// stops the asking, and returns the last answer.
+func watchPosition(cmd []string, from time.Duration) ([]string, func() time.Duration) {
+	if !isMPV(cmd) {
+		return cmd, func() time.Duration { return from }
+	}
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("splay-%d.sock", os.Getpid()))
+	cmd = append(cmd[:len(cmd):len(cmd)], "--input-ipc-server="+socket)
+
+	pos := make(chan time.Duration, 1)
+	done := make(chan struct{})
+	go func() {
+		last := from
+		defer func() { pos <- last }()
+		t := time.NewTicker(positionEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if d, ok := mpvPosition(socket); ok {
+					last = d
+				}
+			}
+		}
+	}()
+	return cmd, func() time.Duration {
+		close(done)
+		os.Remove(socket)
+		return <-pos
+	}
+}
+
+// mpvPosition asks the mpv listening on socket how far into its
+// track it is.
+func mpvPosition(socket string) (time.Duration, bool) {
+	c, err := net.DialTimeout("unix", socket, 200*time.Millisecond)
+	if err != nil {
+		return 0, false
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	if _, err := fmt.Fprintln(c, `{"command":["get_property","time-pos"],"request_id":1}`); err != nil {
+		return 0, false
+	}
+
+	// mpv tells every client of its events, too, so skip those.
+	s := bufio.NewScanner(c)
+	for s.Scan() {
+		var reply struct {
+			Data      *float64 `json:"data"`
+			RequestID int      `json:"request_id"`
+			Error     string   `json:"error"`
+		}
+		if json.Unmarshal(s.Bytes(), &reply) != nil || reply.RequestID != 1 {
+			continue
+		}
+		if reply.Error != "success" || reply.Data == nil {
+			return 0, false
+		}
+		return time.Duration(*reply.Data * float64(time.Second)), true
+	}
+	return 0, false
+}
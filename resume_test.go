@@ -0,0 +1,186 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeFrom(t *testing.T) {
+	plan := []string{"a.ogg", "b.ogg", "c.ogg", "b.ogg"}
+	tests := []struct {
+		path string
+		want []string
+		ok   bool
+	}{
+		{"a.ogg", plan, true},
+		{"b.ogg", []string{"b.ogg", "c.ogg", "b.ogg"}, true},
+		{"c.ogg", []string{"c.ogg", "b.ogg"}, true},
+		{"d.ogg", nil, false},
+	}
+	for _, test := range tests {
+		r, ok := resumeFrom(plan, test.path, time.Minute)
+		if ok != test.ok || !reflect.DeepEqual(r.Paths, test.want) {
+			t.Errorf("Expected resuming from %s to give %q, %v, but got %q, %v", test.path, test.want, test.ok, r.Paths, ok)
+		}
+		if ok && r.Position != time.Minute {
+			t.Errorf("Expected resuming from %s at 1m0s, but got %v", test.path, r.Position)
+		}
+	}
+}
+
+func TestSaveResume(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "splay", "resume.json")
+	if _, err := loadResume(file); err == nil || !strings.Contains(err.Error(), "nothing to resume") {
+		t.Errorf("Expected there to be nothing to resume, but got %v", err)
+	}
+
+	want := resumePoint{[]string{"/Music/Weezer/Pinkerton/02 No Other One.ogg", "/Music/Weezer/Pinkerton/03 Why Bother.ogg"}, 95 * time.Second}
+	if err := saveResume(file, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadResume(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected to resume %v, but got %v", want, got)
+	}
+}
+
+func TestWithStart(t *testing.T) {
+	tests := []struct {
+		cmd  []string
+		want []string
+		ok   bool
+	}{
+		{[]string{"mpv", "--no-video"}, []string{"mpv", "--no-video", "--start=95.500"}, true},
+		{[]string{"/usr/bin/mpv"}, []string{"/usr/bin/mpv", "--start=95.500"}, true},
+		{[]string{"mpg123", "-q"}, []string{"mpg123", "-q"}, false},
+	}
+	for _, test := range tests {
+		got, ok := withStart(test.cmd, 95500*time.Millisecond)
+		if ok != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expected %q to start with %q, %v, but got %q, %v", test.cmd, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+// fakeMPV listens on a socket as mpv does with --input-ipc-server,
+// telling each client of an event, then answering that it's pos
+// seconds into the track.
+func fakeMPV(t *testing.T, socket string, pos float64) {
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				fmt.Fprintln(c, `{"event":"playback-restart"}`)
+				if bufio.NewScanner(c).Scan() {
+					fmt.Fprintf(c, `{"data":%g,"request_id":1,"error":"success"}`+"\n", pos)
+				}
+			}()
+		}
+	}()
+}
+
+func TestMPVPosition(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mpv.sock")
+	if _, ok := mpvPosition(socket); ok {
+		t.Errorf("Expected no position without mpv")
+	}
+	fakeMPV(t, socket, 95.5)
+	d, ok := mpvPosition(socket)
+	if !ok || d != 95500*time.Millisecond {
+		t.Errorf("Expected mpv to be 1m35.5s in, but got %v, %v", d, ok)
+	}
+}
+
+func TestPlayerStartAt(t *testing.T) {
+	p, ran := fakePlayer(t, "mpv --no-video")
+	p.StartAt = 95 * time.Second
+	for _, path := range []string{"a.ogg", "b.ogg"} {
+		if err := p.Play(context.Background(), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := [][]string{
+		{"mpv", "--no-video", "--start=95.000", "a.ogg"},
+		{"mpv", "--no-video", "b.ogg"},
+	}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("Expected to run %q, but ran %q", want, *ran)
+	}
+}
+
+func TestPlayerStopped(t *testing.T) {
+	p, _ := fakePlayer(t, "mpg123")
+	if _, _, ok := p.Stopped(); ok {
+		t.Errorf("Expected nothing to have been stopped yet")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.run = func(c *exec.Cmd) error {
+		if c.Args[len(c.Args)-1] == "b.ogg" {
+			cancel()
+		}
+		return nil
+	}
+	p.Resumable = true
+	p.StartAt = time.Minute
+	for _, path := range []string{"a.ogg", "b.ogg", "c.ogg"} {
+		if err := p.Play(ctx, path); err != nil {
+			break
+		}
+	}
+	path, at, ok := p.Stopped()
+	if !ok || path != "b.ogg" || at != 0 {
+		t.Errorf("Expected to have stopped at the start of b.ogg, since mpg123 can't say where it is, but got %s, %v, %v", path, at, ok)
+	}
+}
+
+func TestPlayerStoppedMidTrack(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	defer func(d time.Duration) { positionEvery = d }(positionEvery)
+	positionEvery = 10 * time.Millisecond
+
+	p, _ := fakePlayer(t, "mpv")
+	p.Resumable = true
+	ctx, cancel := context.WithCancel(context.Background())
+	p.run = func(c *exec.Cmd) error {
+		want := "--input-ipc-server=" + filepath.Join(dir, fmt.Sprintf("splay-%d.sock", os.Getpid()))
+		if c.Args[1] != want {
+			t.Errorf("Expected mpv to be given %s, but got %q", want, c.Args)
+		}
+		fakeMPV(t, strings.TrimPrefix(c.Args[1], "--input-ipc-server="), 95.5)
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		return nil
+	}
+	if err := p.Play(ctx, "a.ogg"); err != context.Canceled {
+		t.Errorf("Expected playing to be canceled, but got %v", err)
+	}
+	path, at, ok := p.Stopped()
+	if !ok || path != "a.ogg" || at != 95500*time.Millisecond {
+		t.Errorf("Expected to have stopped 1m35.5s into a.ogg, but got %s, %v, %v", path, at, ok)
+	}
+}
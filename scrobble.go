@@ -0,0 +1,177 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A scrobbler records each track which was played for long enough, given
+// its path, the names of its artist, album, and song, and when it started.
+type scrobbler interface {
+	Scrobble(path, artist, album, song string, started time.Time) error
+}
+
+// playedEnough reports whether a track which played for the given
+// time should be scrobbled, following Last.fm's rules: it must be longer
+// than 30 seconds, and have played for half its length, or 4 minutes.
+// If its length isn't known, it must have played for 30 seconds.
+func playedEnough(played, length time.Duration, known bool) bool {
+	if !known {
+		return played >= 30*time.Second
+	}
+	return length > 30*time.Second && (played >= length/2 || played >= 4*time.Minute)
+}
+
+// A backgroundScrobbler gives the tracks scrobbled to another scrobbler,
+// e.g. a lastfm, which may be slow, one at a time in the background, so
+// that the next track needn't wait for it. Its failures are warned about.
+type backgroundScrobbler struct {
+	queue chan scrobbled
+	done  chan struct{}
+}
+
+// A scrobbled track is one waiting in a backgroundScrobbler's queue.
+type scrobbled struct {
+	path, artist, album, song string
+	started                   time.Time
+}
+
+// inBackground returns a backgroundScrobbler which gives tracks to s,
+// holding up to n waiting for it.
+func inBackground(s scrobbler, n int) *backgroundScrobbler {
+	b := &backgroundScrobbler{
+		queue: make(chan scrobbled, n),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(b.done)
+		for t := range b.queue {
+			if err := s.Scrobble(t.path, t.artist, t.album, t.song, t.started); err != nil {
+				logs.Warn(err)
+			}
+		}
+	}()
+	return b
+}
+
+func (b *backgroundScrobbler) Scrobble(path, artist, album, song string, started time.Time) error {
+	select {
+	case b.queue <- scrobbled{path, artist, album, song, started}:
+		return nil
+	default:
+		return newError("Too many tracks are waiting to be scrobbled, so %s won't be.", song)
+	}
+}
+
+// flushScrobblers waits, for up to timeout in all, for those of
+// scrobblers which work in the background to finish what's waiting.
+// They can't be given any more tracks afterward.
+func flushScrobblers(scrobblers []scrobbler, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for _, s := range scrobblers {
+		b, ok := s.(*backgroundScrobbler)
+		if !ok {
+			continue
+		}
+		close(b.queue)
+		select {
+		case <-b.done:
+		case <-deadline:
+			logs.Warn(newError("Gave up waiting for the last tracks to be scrobbled."))
+			return
+		}
+	}
+}
+
+// lastfmAPI is where Last.fm's API is served.
+const lastfmAPI = "https://ws.audioscrobbler.com/2.0/"
+
+// A lastfm scrobbles tracks to a Last.fm account.
+type lastfm struct {
+	key, secret, session string
+
+	// api is where the API is served, and client posts to it.
+	// They are replaced in tests.
+	api    string
+	client *http.Client
+}
+
+// lastfmFromEnv returns a lastfm which uses the API key, secret, and
+// session key in $SPLAY_LASTFM_KEY, $SPLAY_LASTFM_SECRET, and
+// $SPLAY_LASTFM_SESSION.
+func lastfmFromEnv() (*lastfm, error) {
+	l := &lastfm{
+		key:     os.Getenv("SPLAY_LASTFM_KEY"),
+		secret:  os.Getenv("SPLAY_LASTFM_SECRET"),
+		session: os.Getenv("SPLAY_LASTFM_SESSION"),
+		api:     lastfmAPI,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if l.key == "" || l.secret == "" || l.session == "" {
+		return nil, newError("To scrobble, set SPLAY_LASTFM_KEY, SPLAY_LASTFM_SECRET, and SPLAY_LASTFM_SESSION to your Last.fm API key, secret, and session key.")
+	}
+	return l, nil
+}
+
+func (l *lastfm) Scrobble(path, artist, album, song string, started time.Time) error {
+	form := url.Values{
+		"method":    {"track.scrobble"},
+		"artist":    {artist},
+		"track":     {song},
+		"timestamp": {strconv.FormatInt(started.Unix(), 10)},
+		"api_key":   {l.key},
+		"sk":        {l.session},
+	}
+	if album != "" {
+		form.Set("album", album)
+	}
+	form.Set("api_sig", l.sign(form))
+	form.Set("format", "json")
+
+	resp, err := l.client.PostForm(l.api, form)
+	if err != nil {
+		return newError("Couldn't scrobble %s: %v", song, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Error != 0 {
+		return newError("Last.fm wouldn't scrobble %s: %s", song, result.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newError("Last.fm wouldn't scrobble %s: %s", song, resp.Status)
+	}
+	return nil
+}
+
+// sign returns the signature of the parameters of a call to the API:
+// the MD5 sum of their names and values, in order by name, and the secret.
+func (l *lastfm) sign(form url.Values) string {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(form.Get(name))
+	}
+	b.WriteString(l.secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
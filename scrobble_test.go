@@ -0,0 +1,225 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlayedEnough(t *testing.T) {
+	tests := []struct {
+		played, length time.Duration
+		known          bool
+		want           bool
+	}{
+		{100 * time.Second, 200 * time.Second, true, true},
+		{99 * time.Second, 200 * time.Second, true, false},
+		{4 * time.Minute, 20 * time.Minute, true, true},
+		{3 * time.Minute, 20 * time.Minute, true, false},
+		{25 * time.Second, 25 * time.Second, true, false},
+		{30 * time.Second, 0, false, true},
+		{29 * time.Second, 0, false, false},
+	}
+	for _, test := range tests {
+		got := playedEnough(test.played, test.length, test.known)
+		if got != test.want {
+			t.Errorf("playedEnough(%v, %v, %v) = %v, but should be %v", test.played, test.length, test.known, got, test.want)
+		}
+	}
+}
+
+// A roundTripFunc stands in for an HTTP transport.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// fakeLastfm returns a lastfm whose requests are given to f, and
+// answered with the given status and body.
+func fakeLastfm(f func(url.Values), status int, body string) *lastfm {
+	return &lastfm{
+		key:     "key",
+		secret:  "secret",
+		session: "session",
+		api:     lastfmAPI,
+		client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if err := r.ParseForm(); err != nil {
+				return nil, err
+			}
+			f(r.PostForm)
+			return &http.Response{
+				StatusCode: status,
+				Status:     http.StatusText(status),
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		})},
+	}
+}
+
+func TestLastfmScrobble(t *testing.T) {
+	var got url.Values
+	l := fakeLastfm(func(form url.Values) { got = form }, http.StatusOK, `{"scrobbles":{}}`)
+	started := time.Unix(1338552000, 0)
+	if err := l.Scrobble("", "Pixies", "Doolittle", "Debaser", started); err != nil {
+		t.Fatal(err)
+	}
+
+	signed := "albumDoolittle" + "api_keykey" + "artistPixies" + "methodtrack.scrobble" +
+		"sksession" + "timestamp1338552000" + "trackDebaser" + "secret"
+	sum := md5.Sum([]byte(signed))
+	want := url.Values{
+		"method":    {"track.scrobble"},
+		"artist":    {"Pixies"},
+		"album":     {"Doolittle"},
+		"track":     {"Debaser"},
+		"timestamp": {"1338552000"},
+		"api_key":   {"key"},
+		"sk":        {"session"},
+		"api_sig":   {hex.EncodeToString(sum[:])},
+		"format":    {"json"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected to post\n%v\nbut posted\n%v", want, got)
+	}
+}
+
+func TestLastfmScrobbleFails(t *testing.T) {
+	ignore := func(url.Values) {}
+	tests := []*lastfm{
+		fakeLastfm(ignore, http.StatusForbidden, `{"error":9,"message":"Invalid session key"}`),
+		fakeLastfm(ignore, http.StatusInternalServerError, ``),
+		{api: lastfmAPI, client: &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("no network")
+		})}},
+	}
+	for i, l := range tests {
+		if err := l.Scrobble("", "Pixies", "Doolittle", "Debaser", time.Now()); err == nil {
+			t.Errorf("Expected scrobble %d to fail", i)
+		}
+	}
+}
+
+// A fakeScrobbler records the tracks it's given,
+// and fails them all if err isn't nil.
+type fakeScrobbler struct {
+	scrobbled [][3]string
+	err       error
+}
+
+func (f *fakeScrobbler) Scrobble(path, artist, album, song string, started time.Time) error {
+	f.scrobbled = append(f.scrobbled, [3]string{artist, album, song})
+	return f.err
+}
+
+func TestPlayScrobble(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/3 Wave of Mutilation.ogg",
+	)
+	doolittle := newAlbum(l, filepath.Join(l.root(), "Pixies", "Doolittle"), false)
+
+	// Debaser plays all the way through, Tame is skipped early,
+	// and Wave of Mutilation's length isn't known.
+	played := map[string]time.Duration{
+		"1 Debaser.ogg":            172 * time.Second,
+		"2 Tame.ogg":               10 * time.Second,
+		"3 Wave of Mutilation.ogg": 2 * time.Minute,
+	}
+	lengths := map[string]time.Duration{
+		"1 Debaser.ogg": 172 * time.Second,
+		"2 Tame.ogg":    116 * time.Second,
+	}
+
+	for _, fail := range []error{nil, errors.New("no network")} {
+		s := &fakeScrobbler{err: fail}
+		now := time.Date(2012, 6, 1, 12, 0, 0, 0, time.UTC)
+		p, _ := fakePlayer(t, "mpg123")
+		p.now = func() time.Time { return now }
+		p.run = func(c *exec.Cmd) error {
+			now = now.Add(played[filepath.Base(c.Args[1])])
+			return nil
+		}
+		p.length = func(path string) (time.Duration, bool) {
+			d, ok := lengths[filepath.Base(path)]
+			return d, ok
+		}
+		p.Scrobblers = []scrobbler{s}
+
+		if err := doolittle.Play(context.Background(), p, ""); err != nil {
+			t.Fatal("Scrobbling shouldn't stop playback, but got", err)
+		}
+		want := [][3]string{
+			{"Pixies", "Doolittle", "1 Debaser"},
+			{"Pixies", "Doolittle", "3 Wave of Mutilation"},
+		}
+		if !reflect.DeepEqual(s.scrobbled, want) {
+			t.Errorf("Expected to scrobble %q, but scrobbled %q", want, s.scrobbled)
+		}
+	}
+}
+
+// A slowScrobbler says when it's given each track, on waiting, then
+// scrobbles it once it's let go, by next.
+type slowScrobbler struct {
+	fakeScrobbler
+	waiting chan string
+	next    chan bool
+}
+
+func (s *slowScrobbler) Scrobble(path, artist, album, song string, started time.Time) error {
+	s.waiting <- song
+	<-s.next
+	return s.fakeScrobbler.Scrobble(path, artist, album, song, started)
+}
+
+func TestBackgroundScrobbler(t *testing.T) {
+	var errs bytes.Buffer
+	defer func(l *logger) { logs = l }(logs)
+	logs = &logger{Out: io.Discard, Err: &errs}
+
+	s := &slowScrobbler{fakeScrobbler{err: errors.New("no network")}, make(chan string, 2), make(chan bool)}
+	b := inBackground(s, 1)
+	started := time.Date(2012, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// The first is taken from the queue at once, but waits to be
+	// scrobbled; the second waits in the queue, which is then full.
+	for _, song := range []string{"1 Debaser", "2 Tame"} {
+		if err := b.Scrobble("", "Pixies", "Doolittle", song, started); err != nil {
+			t.Fatalf("Expected %s to be queued, but got %v", song, err)
+		}
+		if song == "1 Debaser" {
+			<-s.waiting
+		}
+	}
+	if err := b.Scrobble("", "Pixies", "Doolittle", "3 Wave of Mutilation", started); err == nil {
+		t.Error("Expected an error for a track scrobbled while the queue is full")
+	}
+
+	close(s.next)
+	flushScrobblers([]scrobbler{&fakeScrobbler{}, b}, time.Minute)
+	want := [][3]string{
+		{"Pixies", "Doolittle", "1 Debaser"},
+		{"Pixies", "Doolittle", "2 Tame"},
+	}
+	if !reflect.DeepEqual(s.scrobbled, want) {
+		t.Errorf("Expected to scrobble %q, but scrobbled %q", want, s.scrobbled)
+	}
+	if !strings.Contains(errs.String(), "no network") {
+		t.Errorf("Expected a warning for each failure, but got %q", errs.String())
+	}
+}
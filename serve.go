@@ -0,0 +1,47 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"net/http"
+)
+
+// errStopped is the cause of playback being cancelled by
+// a request to the control server to stop.
+var errStopped = newError("Stopped by request.")
+
+// A nowPlaying is the JSON answer to GET /now.
+type nowPlaying struct {
+	Playing bool   `json:"playing"`
+	Index   int    `json:"index"`
+	Path    string `json:"path,omitempty"`
+	Track   string `json:"track,omitempty"`
+}
+
+// controlHandler returns a handler which lets the playback of p be
+// controlled over HTTP:
+//
+//	GET /now	the track being played, as JSON
+//	POST /skip	skip to the next track
+//	POST /stop	stop playing, by calling stop
+func controlHandler(p *Player, stop func()) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /now", func(w http.ResponseWriter, r *http.Request) {
+		var now nowPlaying
+		now.Index, now.Path, now.Playing = p.Playing()
+		if now.Playing {
+			now.Track = newTrack(p.Lib, now.Path).(*track).name()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		writeJSON(w, now)
+	})
+	mux.HandleFunc("POST /skip", func(w http.ResponseWriter, r *http.Request) {
+		p.Skip()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		stop()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
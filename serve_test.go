@@ -0,0 +1,120 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestControlHandler(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("There's no sleep command to stand in for a player.")
+	}
+	root := mkLibrary(t, "Pixies/Doolittle/1 Debaser.ogg", "Pixies/Doolittle/2 Tame.ogg", "Pixies/Doolittle/3 Wave of Mutilation.ogg")
+	p, err := newPlayer(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sleep can't sleep for a path, so run it with an argument it
+	// understands, and say which track started.
+	started := make(chan string, 3)
+	p.run = func(c *exec.Cmd) error {
+		path := c.Args[1]
+		c.Args[1] = "10"
+		started <- path
+		return c.Run()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := httptest.NewServer(controlHandler(p, cancel))
+	defer srv.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newAlbum(dirLibrary(root), filepath.Join(root, "Pixies", "Doolittle"), false).Play(ctx, p, "")
+	}()
+
+	now := func() nowPlaying {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/now")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var n nowPlaying
+		if err := json.NewDecoder(resp.Body).Decode(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	post := func(path string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("POST %s gave %s", path, resp.Status)
+		}
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		select {
+		case got := <-started:
+			if filepath.Base(got) != want {
+				t.Errorf("Expected %s to start, but %s did", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s never started", want)
+		}
+	}
+
+	waitFor("1 Debaser.ogg")
+	n := now()
+	if !n.Playing || n.Index != 0 || filepath.Base(n.Path) != "1 Debaser.ogg" || n.Track != "Pixies/Doolittle/1 Debaser" {
+		t.Errorf("GET /now gave %+v while the first track played", n)
+	}
+
+	post("/skip")
+	waitFor("2 Tame.ogg")
+	n = now()
+	if !n.Playing || n.Index != 1 || filepath.Base(n.Path) != "2 Tame.ogg" {
+		t.Errorf("GET /now gave %+v after skipping to the second track", n)
+	}
+
+	resp, err := http.Get(srv.URL + "/skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /skip gave %s, but it should only be POSTed", resp.Status)
+	}
+
+	post("/stop")
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected stopping to cancel playing, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Playing didn't stop")
+	}
+	if len(started) != 0 {
+		t.Error("Tracks started after stopping:", <-started)
+	}
+	if n := now(); n.Playing {
+		t.Errorf("GET /now gave %+v after stopping", n)
+	}
+}
@@ -0,0 +1,82 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// A summary totals up what's in a Library.
+type summary struct {
+	Artists, Albums, Tracks int
+
+	// TopArtist is the artist with the most tracks, TopTracks of them.
+	// If several have as many, it's the first of them by name.
+	TopArtist string
+	TopTracks int
+}
+
+// summarize totals up the artists, albums, and tracks in l. Artists of
+// the same name in l's different folders are counted as one. Tracks
+// loose in an artist's folder are an album of their own, as when the
+// artist is played.
+func (l *Library) summarize() (summary, error) {
+	artists, paths, err := l.artists()
+	if err != nil {
+		return summary{}, err
+	}
+
+	var s summary
+	tracks := map[string]int{}
+	for i, artist := range artists {
+		name := artist.Name()
+		if _, ok := tracks[name]; !ok {
+			s.Artists++
+			tracks[name] = 0
+		}
+		albums, err := l.subDirs(paths[i])
+		if err != nil {
+			return summary{}, err
+		}
+		for _, al := range albums {
+			songs, _, err := (&album{lib: l, path: filepath.Join(paths[i], al.Name())}).songs()
+			if err != nil {
+				return summary{}, err
+			}
+			s.Albums++
+			s.Tracks += len(songs)
+			tracks[name] += len(songs)
+		}
+		loose, err := l.subFiles(paths[i])
+		if err != nil {
+			return summary{}, err
+		}
+		if len(loose) > 0 {
+			s.Albums++
+			s.Tracks += len(loose)
+			tracks[name] += len(loose)
+		}
+	}
+
+	for name, n := range tracks {
+		if n > s.TopTracks || n == s.TopTracks && (s.TopArtist == "" || name < s.TopArtist) {
+			s.TopArtist, s.TopTracks = name, n
+		}
+	}
+	return s, nil
+}
+
+// printSummary prints a summary of what's in lib to w.
+func printSummary(w io.Writer, lib *Library) error {
+	s, err := lib.summarize()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Artists: %d\n", s.Artists)
+	fmt.Fprintf(w, "Albums:  %d\n", s.Albums)
+	fmt.Fprintf(w, "Tracks:  %d\n", s.Tracks)
+	fmt.Fprintf(w, "Most tracks: %s (%d)\n", s.TopArtist, s.TopTracks)
+	return nil
+}
@@ -0,0 +1,52 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSummarize(t *testing.T) {
+	l := mapLibrary(
+		"Pixies/Doolittle/1 Debaser.ogg",
+		"Pixies/Doolittle/2 Tame.ogg",
+		"Pixies/Doolittle/cover.jpg",
+		"Pixies/Bossanova/Disc 1/1 Cecilia Ann.ogg",
+		"Pixies/Bossanova/Disc 2/1 Rock Music.ogg",
+		"Weezer/Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Blue/2 No One Else.ogg",
+		"Weezer/Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/Pinkerton/2 Getchoo.ogg",
+		"Weezer/Maladroit/.keep",
+		"Weezer/Undone.ogg",
+		"Pixies/notes.txt",
+		"The Who/.keep",
+	)
+	l.Add(fstest.MapFS{
+		"Weezer/Green/1 Don't Let Go.ogg": &fstest.MapFile{},
+		"Yes/Fragile/1 Roundabout.ogg":    &fstest.MapFile{},
+	}, filepath.FromSlash("/more"))
+
+	s, err := l.summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := summary{Artists: 4, Albums: 8, Tracks: 11, TopArtist: "Weezer", TopTracks: 6}
+	if s != want {
+		t.Errorf("Expected the summary %+v, but got %+v", want, s)
+	}
+
+	// Ties go to the first by name.
+	tied := mapLibrary("Weezer/Blue/1 My Name Is Jonas.ogg", "Pixies/Doolittle/1 Debaser.ogg", "The Who/.keep")
+	var b bytes.Buffer
+	if err := printSummary(&b, tied); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := "Artists: 3\nAlbums:  2\nTracks:  2\nMost tracks: Pixies (1)\n"
+	if b.String() != wantOut {
+		t.Errorf("Expected the summary\n%s\nbut got\n%s", wantOut, b.String())
+	}
+}
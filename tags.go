@@ -0,0 +1,340 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// useTags is true iff tracks are matched and listed by the titles,
+// artists, and albums in their tags, rather than by their file names.
+// Tracks without tags are still known by their file names.
+var useTags = false
+
+// trackTags are the names of a track, its artist, and its album,
+// as given by the track's tags.
+type trackTags struct {
+	Title  string
+	Artist string
+	Album  string
+}
+
+// maxTagSize is the most that is read of a block of tags; any
+// more is likely to be cover art, rather than names.
+const maxTagSize = 1 << 20
+
+// readTags reads the tags of the track whose contents are r, returning
+// false if it has none that splay understands. ID3 tags, as in MP3s, and
+// Vorbis comments, as in FLAC, Ogg Vorbis, and Opus files, are read.
+func readTags(r io.ReadSeeker) (trackTags, bool) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return trackTags{}, false
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return trackTags{}, false
+	}
+
+	var t trackTags
+	var ok bool
+	switch {
+	case string(magic[:3]) == "ID3":
+		t, ok = readID3v2(r)
+	case string(magic[:]) == "fLaC":
+		t, ok = readFLACTags(r)
+	case string(magic[:]) == "OggS":
+		t, ok = readOggTags(r)
+	}
+	if ok {
+		return t, true
+	}
+	return readID3v1(r)
+}
+
+// fileTags returns the tags of the track at path, if it has any.
+func fileTags(path string) (trackTags, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return trackTags{}, false
+	}
+	defer f.Close()
+	return readTags(f)
+}
+
+// readID3v2 reads an ID3v2.2, 2.3, or 2.4 tag from the start of r.
+func readID3v2(r io.Reader) (trackTags, bool) {
+	var h [10]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return trackTags{}, false
+	}
+	version := h[3]
+	if version < 2 || version > 4 {
+		return trackTags{}, false
+	}
+	size := syncsafe(h[6:10])
+	if size > maxTagSize {
+		size = maxTagSize
+	}
+	tag := make([]byte, size)
+	n, _ := io.ReadFull(r, tag)
+	tag = tag[:n]
+
+	if h[5]&0x40 != 0 && version > 2 {
+		// Skip the extended header.
+		if len(tag) < 4 {
+			return trackTags{}, false
+		}
+		ext := int(binary.BigEndian.Uint32(tag))
+		if version == 3 {
+			ext += 4
+		} else {
+			ext = syncsafe(tag[:4])
+		}
+		if ext > len(tag) {
+			return trackTags{}, false
+		}
+		tag = tag[ext:]
+	}
+
+	idLen, headLen := 4, 10
+	if version == 2 {
+		idLen, headLen = 3, 6
+	}
+
+	var t trackTags
+	for len(tag) >= headLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+		var size int
+		switch version {
+		case 2:
+			size = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(tag[4:8]))
+		case 4:
+			size = syncsafe(tag[4:8])
+		}
+		if size < 0 || size > len(tag)-headLen {
+			break
+		}
+		body := tag[headLen : headLen+size]
+		tag = tag[headLen+size:]
+
+		switch id {
+		case "TIT2", "TT2":
+			t.Title = id3Text(body)
+		case "TPE1", "TP1":
+			t.Artist = id3Text(body)
+		case "TALB", "TAL":
+			t.Album = id3Text(body)
+		}
+	}
+	return t, t != trackTags{}
+}
+
+// syncsafe returns the value of a 4 byte ID3 "syncsafe" integer,
+// which has 7 bits in each byte.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3Text returns the text of the body of an ID3v2 text frame,
+// whose first byte gives its encoding. Only the first of several
+// strings is returned.
+func id3Text(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	enc, text := body[0], body[1:]
+	var s string
+	switch enc {
+	case 0:
+		s = latin1(text)
+	case 1, 2:
+		s = utf16Text(text, enc == 2)
+	default:
+		s = string(text)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// utf16Text decodes UTF-16 text, which is big-endian if there's
+// no byte order mark saying otherwise and be is true.
+func utf16Text(b []byte, be bool) string {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if be {
+		order = binary.BigEndian
+	}
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xff && b[1] == 0xfe:
+			order, b = binary.LittleEndian, b[2:]
+		case b[0] == 0xfe && b[1] == 0xff:
+			order, b = binary.BigEndian, b[2:]
+		}
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// latin1 decodes ISO-8859-1 text.
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// readID3v1 reads an ID3v1 tag from the last 128 bytes of r.
+func readID3v1(r io.ReadSeeker) (trackTags, bool) {
+	if _, err := r.Seek(-128, io.SeekEnd); err != nil {
+		return trackTags{}, false
+	}
+	var tag [128]byte
+	if _, err := io.ReadFull(r, tag[:]); err != nil || string(tag[:3]) != "TAG" {
+		return trackTags{}, false
+	}
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(latin1(b))
+	}
+	t := trackTags{
+		Title:  field(tag[3:33]),
+		Artist: field(tag[33:63]),
+		Album:  field(tag[63:93]),
+	}
+	return t, t != trackTags{}
+}
+
+// readFLACTags reads the Vorbis comment block of the FLAC stream r.
+func readFLACTags(r io.Reader) (trackTags, bool) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return trackTags{}, false
+	}
+	for {
+		var h [4]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return trackTags{}, false
+		}
+		last, kind := h[0]&0x80 != 0, h[0]&0x7f
+		size := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		if kind == 4 {
+			if size > maxTagSize {
+				return trackTags{}, false
+			}
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return trackTags{}, false
+			}
+			return vorbisComments(block)
+		}
+		if last {
+			return trackTags{}, false
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return trackTags{}, false
+		}
+	}
+}
+
+// readOggTags reads the comment header, the second packet, of the
+// Ogg Vorbis or Opus stream r.
+func readOggTags(r io.Reader) (trackTags, bool) {
+	var packet []byte
+	packets := 0
+	for packets < 2 {
+		var h [27]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil || string(h[:4]) != "OggS" {
+			return trackTags{}, false
+		}
+		lacing := make([]byte, h[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return trackTags{}, false
+		}
+		for _, n := range lacing {
+			seg := make([]byte, n)
+			if _, err := io.ReadFull(r, seg); err != nil {
+				return trackTags{}, false
+			}
+			if packets == 1 && len(packet) < maxTagSize {
+				packet = append(packet, seg...)
+			}
+			if n < 255 {
+				packets++
+				if packets == 2 {
+					break
+				}
+			}
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		return vorbisComments(packet[7:])
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		return vorbisComments(packet[8:])
+	}
+	return trackTags{}, false
+}
+
+// vorbisComments reads the title, artist, and album from a
+// Vorbis comment block.
+func vorbisComments(b []byte) (trackTags, bool) {
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		s := b[4 : 4+n]
+		b = b[4+n:]
+		return s, true
+	}
+
+	if _, ok := next(); !ok { // the vendor
+		return trackTags{}, false
+	}
+	if len(b) < 4 {
+		return trackTags{}, false
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	var t trackTags
+	for i := uint32(0); i < count; i++ {
+		c, ok := next()
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(string(c), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			t.Title = value
+		case "ARTIST":
+			t.Artist = value
+		case "ALBUM":
+			t.Album = value
+		}
+	}
+	return t, t != trackTags{}
+}
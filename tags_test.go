@@ -0,0 +1,238 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// id3v2 returns an ID3v2 tag of the given version, holding frames,
+// which are pairs of IDs and bodies, followed by some audio.
+func id3v2(version byte, frames ...string) []byte {
+	var tag bytes.Buffer
+	for i := 0; i+1 < len(frames); i += 2 {
+		id, body := frames[i], frames[i+1]
+		tag.WriteString(id)
+		n := len(body)
+		switch version {
+		case 2:
+			tag.Write([]byte{byte(n >> 16), byte(n >> 8), byte(n)})
+		case 3:
+			binary.Write(&tag, binary.BigEndian, uint32(n))
+			tag.Write([]byte{0, 0})
+		case 4:
+			tag.Write(syncsafeBytes(n))
+			tag.Write([]byte{0, 0})
+		}
+		tag.WriteString(body)
+	}
+	tag.Write(make([]byte, 16)) // padding
+
+	var b bytes.Buffer
+	b.WriteString("ID3")
+	b.Write([]byte{version, 0, 0})
+	b.Write(syncsafeBytes(tag.Len()))
+	b.Write(tag.Bytes())
+	b.WriteString("\xff\xfb audio")
+	return b.Bytes()
+}
+
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+// id3v1 returns some audio followed by an ID3v1 tag.
+func id3v1(title, artist, album string) []byte {
+	field := func(s string) []byte {
+		b := make([]byte, 30)
+		copy(b, s)
+		return b
+	}
+	var b bytes.Buffer
+	b.WriteString("\xff\xfb audio")
+	b.WriteString("TAG")
+	b.Write(field(title))
+	b.Write(field(artist))
+	b.Write(field(album))
+	b.Write(make([]byte, 128-93))
+	return b.Bytes()
+}
+
+// comments returns a Vorbis comment block holding the given comments.
+func comments(cs ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len("splay")))
+	b.WriteString("splay")
+	binary.Write(&b, binary.LittleEndian, uint32(len(cs)))
+	for _, c := range cs {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// flac returns a FLAC stream with a Vorbis comment block holding cs.
+func flac(cs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	b.Write([]byte{0, 0, 0, 34}) // STREAMINFO
+	b.Write(make([]byte, 34))
+	c := comments(cs...)
+	n := len(c)
+	b.Write([]byte{0x80 | 4, byte(n >> 16), byte(n >> 8), byte(n)})
+	b.Write(c)
+	return b.Bytes()
+}
+
+// ogg returns an Ogg stream whose first page holds an identification
+// packet, and whose second holds a comment packet made of the given
+// prefix and a Vorbis comment block holding cs.
+func ogg(prefix string, cs ...string) []byte {
+	var b bytes.Buffer
+	page := func(packet []byte) {
+		b.WriteString("OggS")
+		b.Write(make([]byte, 22))
+		var lacing []byte
+		n := len(packet)
+		for ; n >= 255; n -= 255 {
+			lacing = append(lacing, 255)
+		}
+		lacing = append(lacing, byte(n))
+		b.WriteByte(byte(len(lacing)))
+		b.Write(lacing)
+		b.Write(packet)
+	}
+	page([]byte("\x01vorbis identification"))
+	page(append([]byte(prefix), comments(cs...)...))
+	return b.Bytes()
+}
+
+func TestReadTags(t *testing.T) {
+	pixies := trackTags{"Debaser", "Pixies", "Doolittle"}
+	long := strings.Repeat("Na ", 100) + "Batman"
+	tests := []struct {
+		name string
+		data []byte
+		tags trackTags
+		ok   bool
+	}{
+		{"ID3v2.2", id3v2(2, "TT2", "\x00Debaser", "TP1", "\x00Pixies", "TAL", "\x00Doolittle"), pixies, true},
+		{"ID3v2.3", id3v2(3, "TIT2", "\x00Debaser", "TPE1", "\x00Pixies", "TALB", "\x00Doolittle"), pixies, true},
+		{"ID3v2.4", id3v2(4, "TALB", "\x03Doolittle", "TIT2", "\x03Debaser\x00", "TPE1", "\x03Pixies"), pixies, true},
+		{"ID3v2 Latin-1", id3v2(3, "TIT2", "\x00Caf\xe9"), trackTags{Title: "Café"}, true},
+		{"ID3v2 UTF-16", id3v2(3, "TIT2", "\x01\xff\xfeT\x00a\x00m\x00e\x00"), trackTags{Title: "Tame"}, true},
+		{"ID3v2 UTF-16BE", id3v2(4, "TIT2", "\x02\x00T\x00a\x00m\x00e"), trackTags{Title: "Tame"}, true},
+		{"ID3v2 without names", id3v2(3, "TCON", "\x00Rock"), trackTags{}, false},
+		{"ID3v1", id3v1("Debaser", "Pixies", "Doolittle"), pixies, true},
+		{"FLAC", flac("TITLE=Debaser", "artist=Pixies", "Album=Doolittle", "DATE=1989"), pixies, true},
+		{"FLAC without comments", flac(), trackTags{}, false},
+		{"Ogg Vorbis", ogg("\x03vorbis", "TITLE=Debaser", "ARTIST=Pixies", "ALBUM=Doolittle"), pixies, true},
+		{"Opus", ogg("OpusTags", "TITLE="+long), trackTags{Title: long}, true},
+		{"untagged", []byte("\xff\xfb audio"), trackTags{}, false},
+		{"empty", nil, trackTags{}, false},
+	}
+	for _, test := range tests {
+		tags, ok := readTags(bytes.NewReader(test.data))
+		if tags != test.tags || ok != test.ok {
+			t.Errorf("The %s tags should be %+v, %v, but got %+v, %v", test.name, test.tags, test.ok, tags, ok)
+		}
+	}
+}
+
+func TestLibraryTags(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Pixies/Doolittle/01.mp3":         &fstest.MapFile{Data: id3v2(3, "TIT2", "\x00Debaser")},
+		"Pixies/Doolittle/02.mp3":         &fstest.MapFile{Data: id3v1("Tame", "Pixies", "Doolittle")},
+		"Pixies/Doolittle/03.ogg":         &fstest.MapFile{Data: ogg("\x03vorbis", "TITLE=Wave of Mutilation")},
+		"Pixies/Doolittle/04 I Bleed.mp3": &fstest.MapFile{Data: []byte("\xff\xfb audio")},
+	}
+	l := NewLibrary(fsys, filepath.FromSlash("/music"))
+	doolittle := filepath.Join(l.root(), "Pixies", "Doolittle")
+
+	defer func() { useTags = false }()
+	tests := []struct {
+		tags    bool
+		pattern string
+		path    string
+	}{
+		{true, "debaser", "01.mp3"},
+		{true, "tame", "02.mp3"},
+		{true, "wave", "03.ogg"},
+		{true, "bleed", "04 I Bleed.mp3"},
+		{true, "01", ""},
+		{false, "debaser", ""},
+		{false, "01", "01.mp3"},
+	}
+	for _, test := range tests {
+		useTags = test.tags
+		paths, err := l.trackMatches(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.path == "" {
+			if len(paths) > 0 {
+				t.Errorf("With -tags=%v, %q shouldn't match anything, but matched %q", test.tags, test.pattern, paths)
+			}
+			continue
+		}
+		if want := filepath.Join(doolittle, test.path); len(paths) == 0 || paths[0] != want {
+			t.Errorf("With -tags=%v, %q should match %s, but got %q", test.tags, test.pattern, want, paths)
+		}
+	}
+
+	useTags = true
+	var buf bytes.Buffer
+	if err := newAlbum(l, doolittle, false).List(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"Debaser", "Tame", "Wave of Mutilation", "04 I Bleed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("With -tags, Doolittle should be listed as %q, but got %q", want, got)
+	}
+}
+
+func TestTrackNameTags(t *testing.T) {
+	root := mkLibrary(t, "Pixies/Doolittle/03 Untagged.ogg")
+	path := filepath.Join(root, "Pixies", "Doolittle", "01.mp3")
+	if err := os.WriteFile(path, id3v2(4, "TIT2", "\x03Debaser", "TPE1", "\x03The Pixies"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { useTags = false }()
+	tests := []struct {
+		tags bool
+		path string
+		name string
+	}{
+		{false, path, "Pixies/Doolittle/01"},
+		{true, path, "The Pixies/Doolittle/Debaser"},
+		{true, filepath.Join(root, "Pixies", "Doolittle", "03 Untagged.ogg"), "Pixies/Doolittle/03 Untagged"},
+	}
+	for _, test := range tests {
+		useTags = test.tags
+		if n := newTrack(nil, test.path).(*track).name(); n != test.name {
+			t.Errorf("With -tags=%v, the name of %s should be %q, but got %q", test.tags, test.path, test.name, n)
+		}
+	}
+}
+
+func TestTrackNameTagsInLibrary(t *testing.T) {
+	l := NewLibrary(fstest.MapFS{
+		"Pixies/Doolittle/01.mp3": &fstest.MapFile{Data: id3v2(4, "TIT2", "\x03Debaser", "TPE1", "\x03The Pixies")},
+	}, filepath.FromSlash("/music"))
+	path := filepath.Join(l.root(), "Pixies", "Doolittle", "01.mp3")
+
+	defer func() { useTags = false }()
+	useTags = true
+	if n := newTrack(l, path).(*track).name(); n != "The Pixies/Doolittle/Debaser" {
+		t.Errorf("The tags of a track should be read through its Library, but got the name %q", n)
+	}
+}
@@ -0,0 +1,121 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A watcher watches the folders of a Library for artists and albums
+// being added or removed, and makes the Library forget what it read of
+// the folders which changed, so that it reads them again. Changes to
+// the tracks of albums aren't watched for.
+type watcher struct {
+	lib *Library
+
+	// quiet is how long to wait after the last change is seen before
+	// the Library forgets, so that a burst of changes, such as an album
+	// being copied, is only forgotten once.
+	quiet time.Duration
+
+	seen    map[string]string // the names in each folder watched, by path
+	changed map[string]bool   // the paths of the folders changed but not forgotten
+	last    time.Time         // when the last change was seen
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWatcher(l *Library, quiet time.Duration) *watcher {
+	return &watcher{lib: l, quiet: quiet, changed: map[string]bool{}}
+}
+
+// watch starts watching l's folders, looking at them every so often,
+// until the watcher is stopped.
+func (l *Library) watch(every, quiet time.Duration) *watcher {
+	w := newWatcher(l, quiet)
+	w.step(time.Now())
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				w.step(now)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// Stop stops watching, once any look at the folders is finished.
+func (w *watcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// step looks at the folders, at the time now, for any changes since
+// the last look. If there haven't been any changes for w.quiet, the
+// Library forgets the folders which changed before.
+func (w *watcher) step(now time.Time) {
+	names := w.scan()
+	if w.seen != nil {
+		for path, n := range names {
+			if old, ok := w.seen[path]; ok && old != n {
+				w.changed[path] = true
+				w.last = now
+			}
+		}
+	}
+	w.seen = names
+
+	if len(w.changed) > 0 && now.Sub(w.last) >= w.quiet {
+		paths := make([]string, 0, len(w.changed))
+		for p := range w.changed {
+			paths = append(paths, p)
+		}
+		w.lib.forget(paths...)
+		w.changed = map[string]bool{}
+	}
+}
+
+// scan returns the names of the entries in each of the Music folders
+// and artists of the Library, joined into one string, by path.
+func (w *watcher) scan() map[string]string {
+	names := map[string]string{}
+	for _, f := range w.lib.folders {
+		artists := scanFolder(f.fsys, ".", names, f.root)
+		for _, a := range artists {
+			scanFolder(f.fsys, a, names, filepath.Join(f.root, filepath.FromSlash(a)))
+		}
+	}
+	return names
+}
+
+// scanFolder records the names of the entries of the named folder of
+// fsys in names, by its path, p, and returns the names in fsys of the
+// folders within it. A folder which can't be read is left out.
+func scanFolder(fsys fs.FS, name string, names map[string]string, p string) []string {
+	es, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil
+	}
+	var ns, dirs []string
+	for _, e := range es {
+		ns = append(ns, e.Name())
+		if e.IsDir() || e.Type()&fs.ModeSymlink != 0 {
+			dirs = append(dirs, path.Join(name, e.Name()))
+		}
+	}
+	names[p] = strings.Join(ns, "\x00")
+	return dirs
+}
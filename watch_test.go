@@ -0,0 +1,72 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Pixies/Doolittle/1 Debaser.ogg":     &fstest.MapFile{},
+		"Weezer/Blue/1 My Name Is Jonas.ogg": &fstest.MapFile{},
+	}
+	l := NewLibrary(fsys, filepath.FromSlash("/music"))
+	pixies := filepath.Join(l.root(), "Pixies")
+	albums := func() []string {
+		t.Helper()
+		fis, err := l.subDirs(pixies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names(fis)
+	}
+	artists := func() []string {
+		t.Helper()
+		fis, _, err := l.artists()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names(fis)
+	}
+
+	begin := time.Date(2012, 6, 1, 12, 0, 0, 0, time.UTC)
+	w := newWatcher(l, time.Second)
+	w.step(begin)
+	if got := albums(); !reflect.DeepEqual(got, []string{"Doolittle"}) {
+		t.Fatalf("Expected Pixies to have Doolittle, but got %q", got)
+	}
+	artists()
+
+	// An album is copied in, bit by bit, and an artist removed.
+	fsys["Pixies/Surfer Rosa/1 Bone Machine.ogg"] = &fstest.MapFile{}
+	w.step(begin.Add(100 * time.Millisecond))
+	fsys["Pixies/Surfer Rosa/2 Break My Body.ogg"] = &fstest.MapFile{}
+	delete(fsys, "Weezer/Blue/1 My Name Is Jonas.ogg")
+	w.step(begin.Add(200 * time.Millisecond))
+
+	// Until things are quiet for a second, what was read is remembered.
+	w.step(begin.Add(900 * time.Millisecond))
+	if got := albums(); !reflect.DeepEqual(got, []string{"Doolittle"}) {
+		t.Errorf("Expected the new album not to be seen yet, but got %q", got)
+	}
+
+	w.step(begin.Add(1200 * time.Millisecond))
+	if got := albums(); !reflect.DeepEqual(got, []string{"Doolittle", "Surfer Rosa"}) {
+		t.Errorf("Expected the new album to be seen, but got %q", got)
+	}
+	if got := artists(); !reflect.DeepEqual(got, []string{"Pixies"}) {
+		t.Errorf("Expected the removed artist to be gone, but got %q", got)
+	}
+}
+
+func TestWatchStop(t *testing.T) {
+	l := mapLibrary("Pixies/Doolittle/1 Debaser.ogg")
+	w := l.watch(time.Millisecond, 0)
+	time.Sleep(10 * time.Millisecond)
+	w.Stop()
+}
@@ -0,0 +1,83 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decade, if non-zero, restricts the albums played by artists and
+// libraries to those from the ten years beginning with it.
+var decade int
+
+// chronological is true iff artists play their albums in order of
+// the years their names start with, rather than in order of their names.
+var chronological = false
+
+// yearPattern matches a year of the 20th or 21st century at the start
+// of a name. Years later in a name, e.g. of a reissue, don't count.
+var yearPattern = regexp.MustCompile(`^\s*((?:19|20)\d\d)\b`)
+
+// albumYear returns the release year at the start of an album's name,
+// such as "1975 - Blood on the Tracks", and whether there was one.
+func albumYear(name string) (int, bool) {
+	m := yearPattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n, true
+}
+
+// parseDecade returns the first year of a decade written like "1990s".
+func parseDecade(s string) (int, error) {
+	d, err := strconv.Atoi(strings.TrimSuffix(s, "s"))
+	if err != nil || d < 1000 || d%10 != 0 {
+		return 0, newError("I don't understand this decade: %q (try something like 1990s)", s)
+	}
+	return d, nil
+}
+
+// inDecade returns only the albums released in the current decade,
+// or all of them if there isn't one.
+func inDecade(albums []os.FileInfo) []os.FileInfo {
+	if decade == 0 {
+		return albums
+	}
+
+	kept := albums[:0]
+	for _, a := range albums {
+		if y, ok := albumYear(a.Name()); ok && y >= decade && y < decade+10 {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// byYear sorts albums, and their paths along with them, by the years
+// their names start with. Albums without a year come last.
+type byYear struct {
+	albums []os.FileInfo
+	paths  []string
+}
+
+func (b byYear) Len() int {
+	return len(b.albums)
+}
+
+func (b byYear) Less(i, j int) bool {
+	x, xok := albumYear(b.albums[i].Name())
+	y, yok := albumYear(b.albums[j].Name())
+	if xok && yok {
+		return x < y
+	}
+	return xok && !yok
+}
+
+func (b byYear) Swap(i, j int) {
+	b.albums[i], b.albums[j] = b.albums[j], b.albums[i]
+	b.paths[i], b.paths[j] = b.paths[j], b.paths[i]
+}
@@ -0,0 +1,123 @@
+// © 2012 Steve McCoy. Available under the MIT License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAlbumYear(t *testing.T) {
+	tests := []struct {
+		name string
+		year int
+		ok   bool
+	}{
+		{"1975 - Blood on the Tracks", 1975, true},
+		{"2001", 2001, true},
+		{" 1996 Pinkerton", 1996, true},
+		{"1999 (2015 Remaster)", 1999, true},
+		{"Pinkerton (1996)", 0, false},
+		{"Songs from 1984 (2005)", 0, false},
+		{"Blonde on Blonde", 0, false},
+		{"12345", 0, false},
+		{"1812 Overture", 0, false},
+	}
+
+	for _, test := range tests {
+		y, ok := albumYear(test.name)
+		if y != test.year || ok != test.ok {
+			t.Errorf("albumYear(%q) should be %d, %v, but got %d, %v", test.name, test.year, test.ok, y, ok)
+		}
+	}
+}
+
+func TestParseDecade(t *testing.T) {
+	if d, err := parseDecade("1990s"); d != 1990 || err != nil {
+		t.Error("parseDecade(1990s) should be 1990, but got", d, err)
+	}
+	if d, err := parseDecade("2000"); d != 2000 || err != nil {
+		t.Error("parseDecade(2000) should be 2000, but got", d, err)
+	}
+	for _, s := range []string{"", "90s", "1995", "the nineties"} {
+		if _, err := parseDecade(s); err == nil {
+			t.Errorf("parseDecade(%q) should fail", s)
+		}
+	}
+}
+
+func TestLibraryDecade(t *testing.T) {
+	root := mkLibrary(t,
+		"Weezer/1994 - Blue/1 My Name Is Jonas.ogg",
+		"Weezer/1996 Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/2001 - Green/1 Don't Let Go.ogg",
+		"Weezer/Maladroit/1 American Gigolo.ogg",
+	)
+
+	decade = 1990
+	defer func() { decade = 0 }()
+
+	var played []string
+	err := newCollection(dirLibrary(root), false).(*collection).doPerAlbum("", func(path string) error {
+		played = append(played, filepath.Base(path))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(played) != 2 {
+		t.Fatal("Expected only the 2 albums from the 1990s, but got", played)
+	}
+	for _, p := range played {
+		if p != "1994 - Blue" && p != "1996 Pinkerton" {
+			t.Error("Played an album from outside the 1990s:", p)
+		}
+	}
+
+	decade = 1980
+	err = newArtist(dirLibrary(root), filepath.Join(root, "Weezer")).(*artist).doPerAlbum("", func(os.FileInfo, string) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("Expected an error for an artist with no albums from the 1980s")
+	}
+}
+
+func TestChronological(t *testing.T) {
+	l := mapLibrary(
+		"Weezer/Maladroit/1 American Gigolo.ogg",
+		"Weezer/2001 - Green/1 Don't Let Go.ogg",
+		"Weezer/1996 Pinkerton/1 Tired of Sex.ogg",
+		"Weezer/1994 - Blue/1 My Name Is Jonas.ogg",
+		"Weezer/Make Believe/1 Beverly Hills.ogg",
+	)
+	a := newArtist(l, filepath.Join(l.root(), "Weezer")).(*artist)
+
+	defer func() { chronological, shuffleAlbums = false, true }()
+	chronological = true
+	shuffleAlbums = false
+
+	order := func(start string) []string {
+		var names []string
+		err := a.doPerAlbum(start, func(album os.FileInfo, path string) error {
+			names = append(names, album.Name())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	want := []string{"1994 - Blue", "1996 Pinkerton", "2001 - Green", "Make Believe", "Maladroit"}
+	if got := order(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("Chronological albums should be %q, but got %q", want, got)
+	}
+
+	want = []string{"2001 - Green", "Make Believe", "Maladroit", "1994 - Blue", "1996 Pinkerton"}
+	if got := order("green"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Chronological albums from Green should be %q, but got %q", want, got)
+	}
+}